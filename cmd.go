@@ -5,6 +5,9 @@ import (
 
 	"github.com/metarex-media/mrx-tool/decode"
 	"github.com/metarex-media/mrx-tool/folderscan"
+	"github.com/metarex-media/mrx-tool/lineage"
+	"github.com/metarex-media/mrx-tool/payload"
+	"github.com/metarex-media/mrx-tool/rewrap"
 	"github.com/metarex-media/mrx-tool/versionstr"
 	"github.com/spf13/cobra"
 )
@@ -32,6 +35,13 @@ Mrx Tool can:
 - Genereate a yaml/json file giving a breakdown of the mrx file sructure and its contents. Using the "decode" key
 - Extract mrx data and save it into files. using the "decodesave" key
 - Encode mrx metadata into mrx files, given the files are in the same layout given by decode save. Using the "encode" key
+- Show the manifest history of an mrx file and what changed between manifests. Using the "manifest" key
+- Check the metadata of an mrx file against the schemas of its namespaces. Using the "validate" key
+- Re-encode an mrx file with a new configuration, without extracting its metadata. Using the "rewrap" key
+- Cut a range of frames from an mrx file, keeping the clip wrapped metadata. Using the "trim" key
+- Combine the streams of several mrx files into one mrx file, or extract streams into their own mrx files. Using the "mux" and "demux" keys
+- Join mrx files end to end into one continuous mrx file. Using the "concat" key
+- Split an mrx file into segments of a fixed duration, with a json playlist. Using the "segment" key
 	`,
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println(cmd.Long)
@@ -48,4 +58,12 @@ func init() {
 	rootCmd.AddCommand(decode.DecodeSaveCmd)
 	rootCmd.AddCommand(versionstr.VersionCmd)
 	rootCmd.AddCommand(folderscan.EncodeCmd)
+	rootCmd.AddCommand(lineage.ManifestCmd)
+	rootCmd.AddCommand(payload.ValidateCmd)
+	rootCmd.AddCommand(rewrap.RewrapCmd)
+	rootCmd.AddCommand(rewrap.TrimCmd)
+	rootCmd.AddCommand(rewrap.MuxCmd)
+	rootCmd.AddCommand(rewrap.DemuxCmd)
+	rootCmd.AddCommand(rewrap.ConcatCmd)
+	rootCmd.AddCommand(rewrap.SegmentCmd)
 }
@@ -0,0 +1,143 @@
+package decode
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// the archive formats the essence can be extracted to
+const (
+	ArchiveTar = "tar"
+	ArchiveZip = "zip"
+)
+
+// essenceSink is where the extracted files are saved,
+// the names are relative to the output folder or archive.
+type essenceSink interface {
+	// writeFile saves a whole file
+	writeFile(name string, data []byte) error
+	// indexFile returns the file an index is written to, as an index
+	// grows until the end of the stream. It is saved with saveIndex.
+	indexFile(name string) (*os.File, error)
+	saveIndex(name string, file *os.File) error
+	// close finishes the saved files
+	close() error
+}
+
+// folderSink saves the files in a folder
+type folderSink struct {
+	root string
+	// the last folder that was made, so it is only made once
+	folder string
+}
+
+func (f *folderSink) writeFile(name string, data []byte) error {
+	path := filepath.Join(f.root, filepath.FromSlash(name))
+
+	// make the folders of the file
+	if folder := filepath.Dir(path); folder != f.folder {
+		if err := os.MkdirAll(folder, 0777); err != nil {
+			return err
+		}
+		f.folder = folder
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+func (f *folderSink) indexFile(name string) (*os.File, error) {
+	return os.Create(filepath.Join(f.root, filepath.FromSlash(name)))
+}
+
+func (f *folderSink) saveIndex(_ string, file *os.File) error {
+	return file.Close()
+}
+
+func (f *folderSink) close() error {
+	return nil
+}
+
+// archiveSink saves the files as a tar or zip stream, the
+// indexes are written to temporary files until they are saved.
+type archiveSink struct {
+	tar *tar.Writer
+	zip *zip.Writer
+	// every file has the time the extraction started
+	modTime time.Time
+}
+
+// newArchiveSink returns the sink for the archive format
+func newArchiveSink(w io.Writer, format string) (*archiveSink, error) {
+
+	switch format {
+	case ArchiveTar:
+		return &archiveSink{tar: tar.NewWriter(w), modTime: time.Now().Truncate(time.Second)}, nil
+	case ArchiveZip:
+		return &archiveSink{zip: zip.NewWriter(w), modTime: time.Now().Truncate(time.Second)}, nil
+	default:
+		return nil, fmt.Errorf("error unknown archive format %v, the archive can be %v or %v", format, ArchiveTar, ArchiveZip)
+	}
+}
+
+// create starts a file of the archive
+func (a *archiveSink) create(name string, size int64) (io.Writer, error) {
+
+	if a.zip != nil {
+		return a.zip.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: a.modTime})
+	}
+
+	err := a.tar.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Size: size, Mode: 0644, ModTime: a.modTime})
+
+	return a.tar, err
+}
+
+func (a *archiveSink) writeFile(name string, data []byte) error {
+	w, err := a.create(name, int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("error adding %v to the archive: %v", name, err)
+	}
+
+	_, err = w.Write(data)
+
+	return err
+}
+
+func (a *archiveSink) indexFile(_ string) (*os.File, error) {
+	return os.CreateTemp("", "mrx-index-*.json")
+}
+
+func (a *archiveSink) saveIndex(name string, file *os.File) error {
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	w, err := a.create(name, size)
+	if err != nil {
+		return fmt.Errorf("error adding %v to the archive: %v", name, err)
+	}
+
+	_, err = io.Copy(w, file)
+
+	return err
+}
+
+func (a *archiveSink) close() error {
+	if a.zip != nil {
+		return a.zip.Close()
+	}
+
+	return a.tar.Close()
+}
@@ -0,0 +1,77 @@
+package decode
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExtractArchive(t *testing.T) {
+
+	mrxBytes, _ := os.ReadFile("./testdata/namespaces.mrx")
+	options := ExtractOptions{LeadingZeros: 4, Sidecar: SidecarIndex}
+
+	// the files extracted to a folder, that the archives should match
+	out := t.TempDir()
+	folderErr := ExtractEssence(bytes.NewReader(mrxBytes), out, options)
+	expected := make(map[string]string)
+	filepath.Walk(out, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(out, path)
+			contents, _ := os.ReadFile(path)
+			expected[filepath.ToSlash(rel)] = string(contents)
+		}
+		return err
+	})
+
+	var tarOut, zipOut bytes.Buffer
+	tarErr := ExtractEssenceArchive(bytes.NewReader(mrxBytes), &tarOut, ArchiveTar, options)
+	zipErr := ExtractEssenceArchive(bytes.NewReader(mrxBytes), &zipOut, ArchiveZip, options)
+	formatErr := ExtractEssenceArchive(bytes.NewReader(mrxBytes), &bytes.Buffer{}, "rar", options)
+
+	tarFiles := make(map[string]string)
+	tarReader := tar.NewReader(&tarOut)
+	header, tarReadErr := tarReader.Next()
+	for tarReadErr == nil {
+		contents, _ := io.ReadAll(tarReader)
+		tarFiles[header.Name] = string(contents)
+		header, tarReadErr = tarReader.Next()
+	}
+
+	zipFiles := make(map[string]string)
+	zipReader, zipReadErr := zip.NewReader(bytes.NewReader(zipOut.Bytes()), int64(zipOut.Len()))
+	if zipReadErr == nil {
+		for _, file := range zipReader.File {
+			contents, _ := file.Open()
+			contentBytes, _ := io.ReadAll(contents)
+			zipFiles[file.Name] = string(contentBytes)
+		}
+	}
+
+	Convey("Checking the essence can be extracted as an archive", t, func() {
+		Convey("using tar and zip archives of an mrx file, with sidecar indexes", func() {
+			Convey("the archives contain the same files as the extracted folder", func() {
+				So(folderErr, ShouldBeNil)
+				So(tarErr, ShouldBeNil)
+				So(zipErr, ShouldBeNil)
+				So(tarReadErr, ShouldEqual, io.EOF)
+				So(zipReadErr, ShouldBeNil)
+				So(expected, ShouldContainKey, "0000StreamTC.index.json")
+				So(tarFiles, ShouldResemble, expected)
+				So(zipFiles, ShouldResemble, expected)
+			})
+		})
+		Convey("using an unknown archive format", func() {
+			Convey("an error is returned", func() {
+				So(formatErr, ShouldResemble, fmt.Errorf("error unknown archive format rar, the archive can be tar or zip"))
+			})
+		})
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/metarex-media/mrx-tool/register"
 	"github.com/spf13/cobra"
 )
 
@@ -15,21 +16,41 @@ var decodeIn string
 var decodeOut string
 var decodeSplit string
 var jsonFile bool
+var outputFormat string
+var registerSnapshot string
+var previewBytes int
+var prettyPayloads bool
+var sampleCount int
 
 var decodeSaveIn string
 var decodeSaveOut string
 var zeroCount int
+var saveStreams string
+var saveFrames string
+var saveTemplate string
+var saveSidecar string
+var saveArchive string
 
 func init() {
 	// set up flags for the two different decode commands
 	DecodeCmd.Flags().StringVar(&decodeIn, "input", "", "identifies the file to be decoded")
 	DecodeCmd.Flags().StringVar(&decodeOut, "output", "", "the file to be generated and the decode infomration to be saved to")
-	DecodeCmd.Flags().StringVar(&decodeSplit, "split", "", "split gives an input")
-	DecodeCmd.Flags().BoolVar(&jsonFile, "json", false, "a flag for the output format to be json, instead of the default yaml.")
+	DecodeCmd.Flags().StringVar(&decodeSplit, "split", "", "the number of content packages to keep, e.g. 3,5,3 keeps the first 3, the middle 5 and the last 3. The file is read twice, and an input that can not seek is copied to a temporary file first")
+	DecodeCmd.Flags().BoolVar(&jsonFile, "json", false, "a flag for the output format to be json, instead of the default yaml. Superseded by --format, which it can not be used with")
+	DecodeCmd.Flags().StringVar(&outputFormat, "format", "", "the output format of yaml, json, ndjson or csv. ndjson and csv give a record for each essence KLV")
+	DecodeCmd.Flags().StringVar(&registerSnapshot, "register", "", "a Metarex register snapshot file or folder, to resolve the namespaces of the data streams")
+	DecodeCmd.Flags().IntVar(&previewBytes, "preview", 0, "the number of bytes of each payload to preview, as UTF-8 for text and hex for binary")
+	DecodeCmd.Flags().BoolVar(&prettyPayloads, "pretty", false, "include the pretty printed JSON or XML of each text payload")
+	DecodeCmd.Flags().IntVar(&sampleCount, "samples", 0, "the number of the first and last frames of each data stream to include as samples")
 
 	DecodeSaveCmd.Flags().StringVar(&decodeSaveIn, "input", "", "identifies the file to be decoded")
 	DecodeSaveCmd.Flags().StringVar(&decodeSaveOut, "output", "", "the base folder for the seperated essence to be saved into")
 	DecodeSaveCmd.Flags().IntVar(&zeroCount, "leadingZeroCount", 4, "the minimum integer length of the saved files")
+	DecodeSaveCmd.Flags().StringVar(&saveStreams, "streams", "", "the data streams to extract, as a comma separated list of stream indexes, essence types (TC, BC, TE or BE) or namespaces")
+	DecodeSaveCmd.Flags().StringVar(&saveFrames, "frames", "", "the range of frames to extract from each stream, as first-last frame numbers or HH:MM:SS:FF timecodes e.g. 100-200")
+	DecodeSaveCmd.Flags().StringVar(&saveTemplate, "template", "", "the naming template of the saved files, using {stream}, {type}, {frame}, {timecode} and {ext} e.g. {stream}/{timecode}{ext}")
+	DecodeSaveCmd.Flags().StringVar(&saveArchive, "archive", "", "write the files as a tar or zip archive, instead of a folder. The archive is found from a .tar or .zip output, and - as the output writes to stdout")
+	DecodeSaveCmd.Flags().StringVar(&saveSidecar, "sidecar", "", "write where each file came from in the mrx file, as a sidecar for each file (file) or an index for each stream (index)")
 
 }
 
@@ -53,16 +74,25 @@ detailing the labels of its contents and the overall file structure
 
 
 The yaml contains an array of partitions and their essence information in the order they were found in the mrx file. 
+The yaml is written partition by partition as the file is decoded, with the RandomIndexPack, DataStreams
+and Warnings written after the partitions, so large files can be described without running out of memory.
 The file has the following fields.
 
+Warnings is a list of any structural problems found in the file, each with a Message and the byte Offset of the problem.
+Such as partition pack pointers that do not match where the partitions were found, a RIP that disagrees with the partitions,
+a missing RIP or footer, header metadata that does not match its byte count, unknown keys in body partitions and data after the RIP.
 
 The partition section contains the following information
-- Partition Type identifies the essence container. e.g. Header or Body
+- Partition Type identifies the essence container. e.g. header, body, genericstreampartition or footer
 - HeaderLength is the length of the header and any metadata it may contain.
-- EssenceByteCount is the total byte length of all the essence.
-- ContentPackageCount is the number of individual content packages within the partition.
+- PartitionPack is every field of the partition pack, including the partition offsets, KAG, BodySID, IndexSID, versions,
+operational pattern, essence containers and the open/closed and complete/incomplete Status.
 - IndexTable indetifies if a index table is present in this partition showing some of the data contained within it.
+- HeaderMetadata is the decoded header metadata of the partition, as a tree of the groups and the groups they strongly reference.
+Each group has its Group name, UL, InstanceID, decoded Properties and Children. The preface is the root of the tree.
 - ContentPackages is an array of the contentpackage found in the partition, in the order it was found in the partition. Each conent package is an essence array.
+- EssenceByteCount is the total byte length of all the essence.
+- ContentPackageCount is the number of individual content packages within the partition.
 - Warning provides a string stating any potential issues within the essence.
 - skipped content is an object stating how many content packages were not included and their total byte count.
 - ContentPackageStatistics contains the average, variance and standard deviation in the lengths of the content packages, as well as the longest and shortest package.
@@ -76,8 +106,42 @@ The essence array contains the following information in each element. It has the
 - length is the length of the essence data
 - Type is the resolved container key if it can be found.
 - TotalByteCount is the total count of the essence including the UL and BER encoded length Bytes.  
-
-content packages with the key "00000000.00000000.00000000.00000000" are skipped content packages, these represent an array of content packages as a single item.	`,
+- Preview is the first bytes of the essence, as UTF-8 for text and hex for binary, when the --preview flag is used.
+- Payload is the pretty printed JSON or XML of text essence, when the --pretty flag is used.
+
+content packages with the key "00000000.00000000.00000000.00000000" are skipped content packages, these represent an array of content packages as a single item.
+
+The RandomIndexPack is the decoded RIP at the end of the file, with the BodySID and ByteOffset of each partition
+and the Length of the RIP.
+
+The DataStreams section has the statistics of each data stream, where a data stream is the essence
+with the same key and BodySID.
+- Stream is the position of the data stream in the file
+- Key is the essence key of the data stream
+- BodySID is the stream ID of the partitions the data stream is in
+- EssenceType is the type of the data stream e.g. TC is clocked text
+- EssenceCount is the number of essence items (frames) in the data stream
+- NameSpace is the namespace of the data stream from the manifest
+- Register is the register entry of the namespace
+- EditRate and Duration are the frame rate and length in seconds of clocked data streams
+- PayloadSize is the mean, variance, standard deviation, minimum and maximum of the essence lengths
+- EmptyFrames is the count of zero length essence, which are frames that were missing when the file was encoded
+- Gaps are the runs of empty frames, with the Frame the run starts at and the Length of the run
+- FirstOffset and LastOffset are the byte offsets of the first and last essence of the data stream
+- Samples are the first and last frames of the data stream, when the --samples flag is used.
+Each sample has the Frame, FileOffset, Preview and Payload of the frame.
+
+The --format flag chooses the output format of yaml (the default), json, ndjson or csv.
+The ndjson and csv formats give a flat record for each essence KLV, instead of the layout,
+so the output can be used by tools such as jq, DuckDB or spreadsheets. Each record has the fields
+- Partition is the index of the partition the essence is in
+- Stream and Frame are the data stream and the frame within the data stream, these are -1 for
+essence that is not part of a data stream, such as the manifest and skipped content packages
+- Key, Symbol, FileOffset, Length and TotalByteCount are the same as the essence array
+
+If a Metarex register snapshot is given with the --register flag, the namespace of each data stream is resolved
+to its register entry, giving the name and media type of the metadata.
+The snapshot is a json file or a folder of json files, of register entries or arrays of register entries.	`,
 
 	// Run interactively unless told to be batch / server
 	RunE: decodeStructure,
@@ -95,6 +159,14 @@ func decodeStructure(_ *cobra.Command, _ []string) error {
 		return err
 	}
 
+	var reg *register.Register
+	if registerSnapshot != "" {
+		reg, err = register.Load(registerSnapshot)
+		if err != nil {
+			return err
+		}
+	}
+
 	// do some error checking
 	decodeIn, _ := filepath.Abs(decodeIn)
 
@@ -127,7 +199,8 @@ func decodeStructure(_ *cobra.Command, _ []string) error {
 		fout = os.Stdout
 	}
 
-	err = MRXStructureExtractor(f, fout, decodespl, jsonFile)
+	err = ExtractStructure(f, fout, StructureOptions{ContentPackageLimit: decodespl, JSON: jsonFile, Format: outputFormat, Register: reg,
+		Preview: previewBytes, Pretty: prettyPayloads, Samples: sampleCount})
 	if err != nil {
 		return err
 	}
@@ -185,6 +258,35 @@ The esskeyTypes are:
 - clipText - clip test data
 - frameBin - frame binary data
 
+The --streams flag selects the data streams to extract, as a comma separated list of selectors.
+Each selector is a stream index e.g. 0, an essence type of TC, BC, TE or BE, or a namespace
+from the manifest, either in full or as its MRX ID e.g. MRX.123.456.789.gps.
+
+The --frames flag selects the range of frames to extract from each data stream, as first-last.
+Each end is a frame number or a HH:MM:SS:FF timecode at the frame rate of the stream in the manifest,
+(24 fps is used if there is no frame rate) and either end can be left out, e.g. 100- or -00:01:00:00.
+Timecodes are from the StartTimecode of the manifest, so a timecode before the start is an error.
+The StartTimecode is at the frame rate of the first stream, and is the same time in every stream.
+The extracted files keep the frame numbers they have when every frame is extracted.
+
+The --template flag names the saved files, relative to the output folder, with the placeholders of
+- {stream} - the stream index e.g. 0001
+- {type} - the essence type of TC, BC, TE or BE
+- {frame} - the frame number, with the leadingZeroCount
+- {timecode} - the HH-MM-SS-FF timecode of the frame, at the frame rate of the stream from the StartTimecode of the manifest
+- {ext} - the file extension from the content type of the stream, e.g. .json.
+  Text streams without a content type are checked for JSON or XML, binary streams are .bin
+
+The default template is {stream}Stream{type}/{frame}d. The template needs a {frame} or {timecode}.
+
+The --sidecar flag writes the byte offset, key, BodySID, frame, timecode, hash
+and manifest properties of each saved file. file writes a {file}.meta.json next to each file,
+index writes a single {stream}Stream{type}.index.json for each stream in the output folder.
+
+The --archive flag writes the files as a tar or zip archive stream, instead of a folder of files.
+The output is the archive file, or - to write the archive to stdout. An output ending in .tar or .zip
+is written as that archive, without the --archive flag.
+
 	`,
 
 	// Run interactively unless told to be batch / server
@@ -208,10 +310,48 @@ func decodeAndSave(_ *cobra.Command, _ []string) error {
 		return fmt.Errorf("The leadingZeroCount of %d is invalid please choose a number between 0 and 8", zeroCount)
 	}
 
-	err = EssenceExtractToFile(f, decodeSaveOut, false, zeroCount)
+	var streams []string
+	if saveStreams != "" {
+		streams = strings.Split(strings.ReplaceAll(saveStreams, " ", ""), ",")
+	}
 
-	if err != nil {
-		return err
+	options := ExtractOptions{LeadingZeros: zeroCount, Streams: streams, Frames: saveFrames,
+		Template: saveTemplate, Sidecar: saveSidecar}
+
+	archive := saveArchive
+	if archive == "" {
+		switch strings.ToLower(filepath.Ext(decodeSaveOut)) {
+		case ".tar":
+			archive = ArchiveTar
+		case ".zip":
+			archive = ArchiveZip
+		}
+	}
+
+	switch {
+	case decodeSaveOut == "-":
+		if archive == "" {
+			archive = ArchiveTar
+		}
+
+		// nothing else is written to stdout, as it is the archive
+		return ExtractEssenceArchive(f, os.Stdout, archive, options)
+	case archive != "":
+		fout, err := os.Create(decodeSaveOut)
+		if err != nil {
+			return fmt.Errorf("error generating the output file %v: %v", decodeSaveOut, err)
+		}
+		defer fout.Close()
+
+		err = ExtractEssenceArchive(f, fout, archive, options)
+		if err != nil {
+			return err
+		}
+	default:
+		err = ExtractEssence(f, decodeSaveOut, options)
+		if err != nil {
+			return err
+		}
 	}
 
 	fmt.Println("Written to", decodeSaveOut)
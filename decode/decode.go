@@ -8,49 +8,177 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"os"
 
 	"github.com/metarex-media/mrx-tool/klv"
+	"github.com/metarex-media/mrx-tool/manifest"
+	"github.com/metarex-media/mrx-tool/register"
 
 	mxf2go "github.com/metarex-media/mxf-to-go"
 	"golang.org/x/sync/errgroup"
-	"gopkg.in/yaml.v3"
 )
 
 // MRXStructureExtractor takes an MRX stream and decodes the layout to the writer.
 func MRXStructureExtractor(mrxStream io.Reader, w io.Writer, contentPackageLimit []int, jsonFile bool) error {
+	return ExtractStructure(mrxStream, w, StructureOptions{ContentPackageLimit: contentPackageLimit, JSON: jsonFile})
+}
+
+// StructureOptions are the options for decoding the structure of an MRX file.
+type StructureOptions struct {
+	// ContentPackageLimit limits the content packages
+	// in the output, see the split flag. The content packages
+	// are counted first, so the stream is read twice.
+	ContentPackageLimit []int
+	// JSON is the output in json instead of yaml,
+	// it is only used when the Format is empty.
+	//
+	// Deprecated: JSON is superseded by Format.
+	JSON bool
+	// Format is the output format of yaml, json, ndjson or csv.
+	// ndjson and csv have a record for each essence KLV,
+	// instead of the layout. YAML is used when the Format is empty,
+	// unless JSON is set.
+	Format string
+	// Register is used to resolve the namespaces of each data stream.
+	Register *register.Register
+	// Preview is the number of bytes of each payload to include,
+	// as UTF-8 for text and hex for binary. 0 is no preview.
+	Preview int
+	// Pretty includes the pretty printed JSON or XML of text payloads.
+	Pretty bool
+	// Samples is the number of the first and last frames of
+	// each data stream to include as samples.
+	Samples int
+}
 
-	internalLayout, err := klvStream(mrxStream, contentPackageLimit, 10)
-	// fmt.Println(internalLayout, err)
+// ExtractStructure takes an MRX stream and decodes the layout to the writer.
+// The layout is written partition by partition as the stream is decoded,
+// with the content package limits applied as the content packages are found.
+//
+// The limits need the count of content packages, so the stream is read twice
+// when there are limits. A stream that can not seek, such as stdin, is copied to
+// a temporary file first, which uses as much disk space as the stream.
+func ExtractStructure(mrxStream io.Reader, w io.Writer, options StructureOptions) error {
+
+	writer, err := newLayoutWriter(w, options)
 	if err != nil {
 		return err
 	}
 
-	var layoutBytes []byte
+	var limiter *packageLimiter
+	if len(options.ContentPackageLimit) > 0 {
+		// the limits are spread across every content package,
+		// so they are counted before the layout is written
+		seeker, cleanup, err := rereadable(mrxStream)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
 
-	if jsonFile {
-		layoutBytes, err = json.MarshalIndent(internalLayout, "", "    ")
+		count, err := packageCount(seeker)
+		if err != nil {
+			return err
+		}
 
-	} else {
-		layoutBytes, err = yaml.Marshal(internalLayout)
+		mrxStream = seeker
+		limiter = newPackageLimiter(options.ContentPackageLimit, count)
+	}
+
+	return klvStream(mrxStream, 10, options, writer, limiter)
+}
+
+// rereadable returns the stream as a stream that can be read more than once.
+// Streams that can not seek are spooled to a temporary file, which is
+// removed by the cleanup function.
+func rereadable(stream io.Reader) (io.ReadSeeker, func(), error) {
+
+	seeker, ok := stream.(io.ReadSeeker)
+	if ok {
+		if _, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			return seeker, func() {}, nil
+		}
 	}
 
+	spool, err := spoolStream(stream)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	return spool, func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}, nil
+}
+
+// spoolStream copies a stream that can not seek to a temporary file,
+// so it can be read more than once.
+func spoolStream(stream io.Reader) (*os.File, error) {
+
+	spool, err := os.CreateTemp("", "mrx-decode-*")
+	if err != nil {
+		return nil, fmt.Errorf("error reading and buffering data %v", err)
+	}
+
+	_, err = io.Copy(spool, stream)
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+
+	if err != nil {
+		spool.Close()
+		os.Remove(spool.Name())
+		return nil, fmt.Errorf("error reading and buffering data %v", err)
 	}
 
-	// write the yaml
-	_, err = w.Write(layoutBytes)
+	return spool, nil
+}
+
+// packageCount counts the content packages in the stream,
+// then returns the stream to where it started.
+func packageCount(stream io.ReadSeeker) (int, error) {
+
+	start, err := stream.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+
+	counter := &packageCounter{}
+	_, err = mrxRead(stream, make(chan *klv.KLV, 100), 10, StructureOptions{}, counter, nil)
+	if err != nil {
+		return 0, err
+	}
 
-	return err
+	_, err = stream.Seek(start, io.SeekStart)
+
+	return counter.count, err
 }
 
 // Dataformat has the stream ID and the data within
 type DataFormat struct {
 	MRXID     string
 	FrameRate string
+	// EssenceType is the type of the stream e.g. TC for clocked text,
+	// it is "manifest" for the manifest.
+	EssenceType string
+	// NameSpace is the namespace of the stream from the manifest,
+	// Name and MediaType are found from the register with Resolve.
+	NameSpace string
+	Name      string
+	MediaType string
 	Data      [][]byte
 }
 
+// Resolve finds the name and media type of the stream
+// from its namespace in the register.
+func (d *DataFormat) Resolve(reg *register.Register) bool {
+	entry, ok := reg.Resolve(d.NameSpace)
+	if ok {
+		d.Name, d.MediaType = entry.Name, entry.MediaType
+	}
+
+	return ok
+}
+
 // Extract streamData takes an MRX file and
 // extracts each metadata stream into a seperate data stream
 // in the order it is found in the file.
@@ -61,57 +189,104 @@ func ExtractStreamData(mrxStream io.Reader) ([]*DataFormat, error) {
 	// then work on making something more generic
 	klvChan := make(chan *klv.KLV, 1000)
 
-	return essenceExtract(mrxStream, klvChan)
+	streams, err := essenceExtract(mrxStream, klvChan)
+	if err != nil {
+		return nil, err
+	}
+
+	// the manifest is the last stream, and its configuration
+	// has the stream properties in the order they are in the file
+	for _, stream := range streams {
+		if stream.EssenceType != "manifest" || len(stream.Data) == 0 {
+			continue
+		}
+
+		var round manifest.RoundTrip
+		// the namespaces are optional so
+		// an invalid manifest is skipped
+		if json.Unmarshal(stream.Data[len(stream.Data)-1], &round) != nil {
+			continue
+		}
+
+		for i, dataStream := range streams {
+			if dataStream.EssenceType != "manifest" {
+				dataStream.NameSpace = round.Config.StreamNameSpace(i)
+			}
+		}
+	}
+
+	return streams, nil
 }
 
-func klvStream(stream io.Reader, contentPackageLimit []int, size int) (essenceLayout, error) {
+func klvStream(stream io.Reader, size int, options StructureOptions, writer layoutWriter, limiter *packageLimiter) error {
 
 	klvChan := make(chan *klv.KLV, 100)
 
-	decoder, err := MRXReader(stream, klvChan, size)
+	decoder, err := mrxRead(stream, klvChan, size, options, writer, limiter)
 
 	if err != nil {
-		return essenceLayout{}, err
+		return err
 	}
 
-	// extract the limited packages
-	containers := contentPackageLimiter(decoder.allKeys, decoder.containers, contentPackageLimit)
-
-	streamEssence := essenceLayout{}
-	streamEssence.Partitions = containers
+	tail := layoutTail{Warnings: decoder.warnings, RandomIndexPack: decoder.rip}
+	tail.DataStreams = decoder.streamStatistics()
 
-	return streamEssence, nil
+	if options.Register != nil {
+		var regWarnings []warning
+		tail.DataStreams, regWarnings = decoder.resolveStreams(options.Register)
+		tail.Warnings = append(tail.Warnings, regWarnings...)
+	}
 
+	return writer.end(tail)
 }
 
+// essenceLayout is the layout of an mrx file, the fields
+// are in the order they are written as the file is decoded.
 type essenceLayout struct {
-
-	// warnings - soft errors like thigns being in the header
-	// {warning: "essence found in header partition", essenceLocation : 0
-	// warning : No Random Index Pack Found
-
-	// timings 1 minute frame 24 etc
 	// Partitions is the list of essence containing paritions in the order
 	// they were found in the mrx file
-	Warnings   []warning   `yaml:"Warnings,omitempty" json:"Warnings,omitempty"`
 	Partitions []container `yaml:"Partitions" json:"Partitions"`
+	layoutTail `yaml:",inline"`
+}
+
+// layoutTail is the layout of the file once every partition has been read
+type layoutTail struct {
+	// RandomIndexPack is the decoded RIP, if the file has one
+	RandomIndexPack *randomIndexPack `yaml:"RandomIndexPack,omitempty" json:"RandomIndexPack,omitempty"`
+	// DataStreams are the data streams, with their
+	// statistics and namespaces
+	DataStreams []streamSummary `yaml:"DataStreams,omitempty" json:"DataStreams,omitempty"`
+	// Warnings are the soft errors, like essence being in the header
+	// or no random index pack being found
+	Warnings []warning `yaml:"Warnings,omitempty" json:"Warnings,omitempty"`
 }
 
 // MRXReader reads an MRX stream, then buffers through the klv channel breaking down the contents
 // into a go struct.
 func MRXReader(stream io.Reader, buffer chan *klv.KLV, size int) (*mrxDecoder, error) { // wg *sync.WaitGroup, buffer chan packet, errChan chan error) {
+	return mrxRead(stream, buffer, size, StructureOptions{}, &packageCounter{}, nil)
+}
+
+// mrxRead is the MRXReader, with the options for the payloads to include
+// in the layout, which is written to the writer as it is decoded.
+func mrxRead(stream io.Reader, buffer chan *klv.KLV, size int, options StructureOptions, writer layoutWriter, limiter *packageLimiter) (*mrxDecoder, error) {
 
 	// use errs to handle errors while running concurrently
 	errs, _ := errgroup.WithContext(context.Background())
 
-	// initiate the klv stream
+	// initiate the klv stream, the error is handled after
+	// the stream has been read, as data after the RIP
+	// does not have to be klv
+	var klvErr error
 	errs.Go(func() error {
-		return klv.StartKLVStream(stream, buffer, size)
+		klvErr = klv.StartKLVStream(stream, buffer, size)
 
+		return nil
 	})
 
 	countStart := 0
-	md := &mrxDecoder{Primer: make(map[string]string), Unknown: make(map[string]mxf2go.EssenceInformation), unknownCount: &countStart}
+	md := &mrxDecoder{Primer: make(map[string]string), Unknown: make(map[string]mxf2go.EssenceInformation), unknownCount: &countStart,
+		streamIDs: make(map[essID]int), options: options, writer: writer, limiter: limiter}
 
 	// initiate the klv handling stream
 	errs.Go(func() error {
@@ -137,8 +312,23 @@ func MRXReader(stream io.Reader, buffer chan *klv.KLV, size int) (*mrxDecoder, e
 			if partitionName(klvItem.Key) == "060e2b34.020501  .0d010201.01    00" {
 
 				if klvItem.Key[13] == 17 {
-					// return the end of the file
-					// we don't need to read the RIP
+					// the RIP is the end of the file
+					md.rip = ripExtract(klvItem)
+					md.ripOffset, md.ripLength = md.globalPosition, klvItem.TotalLength()
+					if err := md.closePartition(); err != nil {
+						return err
+					}
+
+					// anything after the RIP is not part of the file
+					md.globalPosition += klvItem.TotalLength()
+					end := md.globalPosition
+					for trailing := range buffer {
+						md.globalPosition += trailing.TotalLength()
+					}
+
+					if md.globalPosition > end {
+						md.warnings = append(md.warnings, offsetWarning(end, "%v bytes of data were found after the random index pack", md.globalPosition-end))
+					}
 
 					return nil
 				} else {
@@ -162,16 +352,31 @@ func MRXReader(stream io.Reader, buffer chan *klv.KLV, size int) (*mrxDecoder, e
 			// get the next item for a loop
 			klvItem, klvOpen = <-buffer
 		}
-		return nil
+
+		// files without a RIP end on the last partition
+		return md.closePartition()
 	})
 
 	// wait for routines then handle the error
 	// if there is an error.
 	err := errs.Wait()
 
+	// a file that can not be read as klv, is the
+	// cause of any errors decoding the file
+	if klvErr != nil && md.rip == nil {
+		return nil, klvErr
+	}
+
 	if err != nil {
 		return nil, err
 	}
+
+	if klvErr != nil {
+		md.warnings = append(md.warnings, offsetWarning(md.globalPosition, "the data after the random index pack could not be read as klv: %v", klvErr))
+	}
+
+	md.structureCheck()
+
 	// if everything has been read end the extraction
 	return md, nil
 }
@@ -200,71 +405,40 @@ func partitionName(namebytes []byte) string {
 		namebytes[8], namebytes[9], namebytes[10], namebytes[11], namebytes[12], namebytes[15])
 }
 
-func contentKey(packages []contentPackage) string { // return the key of the first pacakge to check for patterns
+// contentKey returns the key of the first essence of the current content package,
+// which marks the start of the next content package.
+func (md *mrxDecoder) contentKey() string {
 
-	contents := packages[len(packages)-1]
-
-	if len(contents.ContentPackage) == 0 {
+	if len(md.currentPackage.ContentPackage) == 0 {
 		return "faker"
-	} else {
-		return contents.ContentPackage[0].Key
 	}
 
+	return md.currentPackage.ContentPackage[0].Key
 }
 
 func (md *mrxDecoder) partitionDecode(klvItem *klv.KLV, metadata chan *klv.KLV) error {
 
-	if md.partitionCount != 0 {
-		if int(md.average.count) != len(md.currentContainer.ContentPackages) {
-			md.average.Update(float64(md.currentContainer.ContentPackages[len(md.currentContainer.ContentPackages)-1].ContentPackageLength))
-		}
-
-		// check if there's any contents
-		if len(md.currentContainer.ContentPackages) > 0 {
-			// check there's any keys in the conents
-			if len(md.currentContainer.ContentPackages[0].ContentPackage) > 0 {
-				// call the stats
-				finalAvg := md.average.finalise()
-				// use a pointer of the result if an average has been calculated
-				if finalAvg.Mean != 0 {
-					md.currentContainer.Stats = &finalAvg
-				}
-				md.currentContainer.ContentPackageCount = len(md.currentContainer.ContentPackages)
-
-				//	md.currentContainer.ContentPackages = contents //essences
-
-			}
-		}
-
-		if md.currentContainer.PartitionType == "header" && len(md.currentContainer.ContentPackages[0].ContentPackage) > 0 {
-			md.currentContainer.Warning = &warning{Message: "Essence found in the partition header"}
-
-		}
-
-		// update the partition infomratino before resetting it to 0
-		md.currentContainer.EssenceByteCount = md.byteCount
-
-		if len(md.currentContainer.ContentPackages[0].ContentPackage) == 0 {
-			md.currentContainer.ContentPackages = []contentPackage{}
-		}
-
-		md.containers = append(md.containers, md.currentContainer)
-		md.allKeys = append(md.allKeys, md.currentContainer.ContentPackages...)
-
+	if err := md.closePartition(); err != nil {
+		return err
 	}
 
 	// generate a new partition
-	md.currentContainer = container{}
 	//	shift, lengthlength := klvItem
 	partitionLayout := partitionExtract(klvItem)
-	md.currentContainer.PartitionType, md.currentContainer.HeaderLength = partitionLayout.PartitionType, partitionLayout.TotalHeaderLength
-
-	md.currentContainer.ContentPackages = []contentPackage{{ContentPackage: []keyLength{}}}
+	md.pointerCheck(partitionLayout)
+	head := partitionHead{PartitionType: partitionLayout.PartitionType, HeaderLength: partitionLayout.TotalHeaderLength,
+		PartitionPack: partitionLayout.report()}
+	md.partitionType = partitionLayout.PartitionType
+	md.currentSID = int(partitionLayout.BodySID)
+
+	md.currentPackage = contentPackage{}
+	md.packageCount = 0
 	md.average = stats{Minimum: math.MaxInt}
 
-	// flush out the header metadata
-	// as it is not used yet (apart from the primer)
+	// decode the header metadata groups, using the primer
+	// for the local tags
 	flushedMeta := 0
+	var groups []*metadataGroup
 	for flushedMeta < int(partitionLayout.HeaderByteCount) {
 		flush, open := <-metadata
 
@@ -275,23 +449,42 @@ func (md *mrxDecoder) partitionDecode(klvItem *klv.KLV, metadata chan *klv.KLV)
 		// fmt.Println(flush.Key, ok, partitionLayout.HeaderByteCount, flushedMeta)
 		flushedMeta += flush.TotalLength()
 
-		if string(flush.Key) == string([]byte{6, 0xe, 0x2b, 0x34, 2, 5, 1, 1, 0xd, 01, 02, 01, 01, 05, 01, 00}) {
+		switch {
+		case string(flush.Key) == string([]byte{6, 0xe, 0x2b, 0x34, 2, 5, 1, 1, 0xd, 01, 02, 01, 01, 05, 01, 00}):
 			primerUnpack(flush.Value, md.Primer)
+		case fillKey(fullName(flush.Key)):
+		default:
+			groups = append(groups, decodeGroup(flush, md.Primer))
 		}
 	}
 
+	head.HeaderMetadata = metadataTree(groups)
+
+	if flushedMeta != int(partitionLayout.HeaderByteCount) {
+		md.warnings = append(md.warnings, offsetWarning(md.globalPosition, "the header metadata of the %v partition is %v bytes, but the partition pack HeaderByteCount is %v",
+			partitionLayout.PartitionType, flushedMeta, partitionLayout.HeaderByteCount))
+	}
+
+	// the position is moved along by the bytes that have been read,
+	// rather than the lengths in the partition pack
+	partitionBytes := klvItem.TotalLength() + flushedMeta
+
 	// add the index table if there are some
 	if partitionLayout.IndexTable {
 		//	index table is after all the metadata
-		index := <-metadata
+		index, open := <-metadata
+		if !open {
+			return fmt.Errorf("error when using klv data klv stream interrupted")
+		}
+		partitionBytes += index.TotalLength()
+
 		filledtable, err := indexUnpack(index, md.Primer)
 		if err != nil {
 
 			return err
 		}
 
-		md.currentContainer.IndexTable = filledtable
-		//	fmt.Println(md.currentContainer.IndexTable)
+		head.IndexTable = filledtable
 	}
 
 	// move the partition along and increment the partition counts
@@ -299,11 +492,68 @@ func (md *mrxDecoder) partitionDecode(klvItem *klv.KLV, metadata chan *klv.KLV)
 	md.byteCount = 0
 
 	// increase the length by the name etc
-	md.globalPosition += md.currentContainer.HeaderLength
+	md.globalPosition += partitionBytes
+
+	return md.writer.startPartition(head)
+}
 
-	// position += md.currentContainer.HeaderLength
+// closePartition finishes the layout of the current partition
+// and writes the end of the partition.
+func (md *mrxDecoder) closePartition() error {
 
-	return nil
+	if md.partitionCount == 0 {
+		return nil
+	}
+
+	// write the last content package and any that were skipped
+	if err := md.packageEnd(); err != nil {
+		return err
+	}
+
+	if err := md.limiter.flush(md.writer); err != nil {
+		return err
+	}
+
+	// update the partition infomratino before resetting it to 0
+	tail := partitionTail{EssenceByteCount: md.byteCount, ContentPackageCount: md.packageCount}
+
+	// check there's any contents
+	if md.packageCount > 0 {
+		// call the stats
+		finalAvg := md.average.finalise()
+		// use a pointer of the result if an average has been calculated
+		if finalAvg.Mean != 0 {
+			tail.Stats = &finalAvg
+		}
+
+		if md.partitionType == "header" {
+			tail.Warning = &warning{Message: "Essence found in the partition header"}
+		}
+	}
+
+	return md.writer.endPartition(tail)
+}
+
+// packageEnd writes the current content package, once the
+// next content package has been found or the partition has ended.
+func (md *mrxDecoder) packageEnd() error {
+
+	if len(md.currentPackage.ContentPackage) == 0 {
+		return nil
+	}
+
+	md.average.Update(float64(md.currentPackage.ContentPackageLength))
+	md.packageCount++
+
+	cp := md.currentPackage
+	md.currentPackage = contentPackage{}
+
+	return md.limiter.add(cp, md.writer)
+}
+
+// fillKey checks if the key is a klv fill item
+func fillKey(name string) bool {
+	return name == "060e2b34.01010102.03010210.01000000" || name == "060e2b34.01010101.03010210.01000000" || name == "060e2b34.01020101.03010210.01000000"
 }
 
 func (md *mrxDecoder) essenceDecode(klvItem *klv.KLV) error {
@@ -318,7 +568,7 @@ func (md *mrxDecoder) essenceDecode(klvItem *klv.KLV) error {
 	// partLength, BERlength := klv.BerDecode(partStream[position+16 : position+16+berDistance : position+16+berDistance])
 
 	// skip klv fill items
-	if name == "060e2b34.01010102.03010210.01000000" || name == "060e2b34.01010101.03010210.01000000" || name == "060e2b34.01020101.03010210.01000000" {
+	if fillKey(name) {
 		// fmt.Println(BERlength + partLength + 16)
 		md.byteCount += klvTotal
 		md.globalPosition += klvTotal
@@ -326,26 +576,40 @@ func (md *mrxDecoder) essenceDecode(klvItem *klv.KLV) error {
 		return nil
 	}
 
+	// check the manifest against the schema, a copy of the key
+	// is labelled as labelling masks the key
+	// the manifest is not part of a data stream
+	essLabel := essLabeller(append([]byte{}, klvItem.Key...))
+	stream, frame := -1, -1
+	if essLabel == "manifest" {
+		md.manifestCheck(klvItem.Value)
+	} else {
+		stream, frame = md.streamCount(name, essLabel, klvItem.Value)
+	}
+
 	// see if the essence has a key that correlates to the registers
+	_, seen := md.Unknown[string(klvItem.Key)]
 	gotType := ExtractEssenceType(klvItem.Key, md.Unknown, md.unknownCount)
+	_, unknown := md.Unknown[string(klvItem.Key)]
+	md.unknownCheck(klvItem.Key, seen || !unknown)
 	contentSymbol := gotType.Symbol
 	desc := gotType.Definition
 
-	// check if is a new content pack or not
-	if name == contentKey(md.currentContainer.ContentPackages) {
+	essence := keyLength{Key: name, Length: len(klvItem.Value), FileOffset: md.globalPosition,
+		Symbol: contentSymbol, TotalByteCount: klvTotal, Description: desc, stream: stream, frame: frame}
+	essence.Preview, essence.Payload = md.sample(klvItem.Value, essLabel)
 
-		md.average.Update(float64(md.currentContainer.ContentPackages[len(md.currentContainer.ContentPackages)-1].ContentPackageLength))
-		md.currentContainer.ContentPackages = append(md.currentContainer.ContentPackages, contentPackage{ContentPackage: []keyLength{{Key: name,
-			Length: len(klvItem.Value), FileOffset: md.globalPosition,
-			Symbol: contentSymbol, TotalByteCount: klvTotal, Description: desc}}})
-	} else {
-		md.currentContainer.ContentPackages[len(md.currentContainer.ContentPackages)-1].ContentPackage = append(md.currentContainer.ContentPackages[len(md.currentContainer.ContentPackages)-1].ContentPackage,
-			keyLength{Key: name, Length: len(klvItem.Value), FileOffset: md.globalPosition,
-				Symbol: contentSymbol, TotalByteCount: klvTotal, Description: desc})
+	// check if is a new content pack or not
+	if name == md.contentKey() {
+		if err := md.packageEnd(); err != nil {
+			return err
+		}
 	}
 
+	md.currentPackage.ContentPackage = append(md.currentPackage.ContentPackage, essence)
+
 	// update the content length and place in the stream
-	md.currentContainer.ContentPackages[len(md.currentContainer.ContentPackages)-1].ContentPackageLength += klvTotal
+	md.currentPackage.ContentPackageLength += klvTotal
 
 	md.globalPosition += klvTotal
 	md.byteCount += klvTotal
@@ -354,6 +618,133 @@ func (md *mrxDecoder) essenceDecode(klvItem *klv.KLV) error {
 
 }
 
+// resolveStreams resolves the namespace of each data stream with the register.
+// Warnings are given for namespaces that are not in the register.
+func (md *mrxDecoder) resolveStreams(reg *register.Register) ([]streamSummary, []warning) {
+
+	var regWarnings []warning
+	if md.config == nil {
+		return md.streams, []warning{{Message: "no manifest was found, so the namespaces of the data streams are unknown"}}
+	}
+
+	for i, stream := range md.streams {
+		if stream.NameSpace == "" {
+			continue
+		}
+
+		if entry, ok := reg.Resolve(stream.NameSpace); ok {
+			md.streams[i].Register = &entry
+		} else {
+			regWarnings = append(regWarnings, warning{Message: fmt.Sprintf("the namespace %v of data stream %v is not in the register", stream.NameSpace, stream.Stream)})
+		}
+	}
+
+	return md.streams, regWarnings
+}
+
+// streamCount counts the essence of each data stream, where a data stream
+// is the essence with the same key in the same partition stream.
+// Empty essence is counted as a gap in the stream.
+// The data stream and frame of the essence are returned.
+func (md *mrxDecoder) streamCount(key, essLabel string, value []byte) (int, int) {
+	id := essID{key: key, sid: md.currentSID}
+	pos, ok := md.streamIDs[id]
+
+	if !ok {
+		pos = len(md.streams)
+		md.streamIDs[id] = pos
+		md.streams = append(md.streams, streamSummary{Stream: pos, Key: key, BodySID: md.currentSID, EssenceType: essLabel,
+			FirstOffset: md.globalPosition, size: stats{Minimum: math.MaxInt}})
+	}
+
+	stream := &md.streams[pos]
+	length := len(value)
+	if md.options.Samples > 0 {
+		sample := payloadSample{Frame: stream.EssenceCount, FileOffset: md.globalPosition}
+		sample.Preview, sample.Payload = md.sample(value, essLabel)
+		stream.addSample(sample, md.options.Samples)
+	}
+
+	if length == 0 {
+		stream.EmptyFrames++
+		// extend the gap if the previous frame was empty as well
+		if last := len(stream.Gaps) - 1; last >= 0 && stream.Gaps[last].Frame+stream.Gaps[last].Length == stream.EssenceCount {
+			stream.Gaps[last].Length++
+		} else {
+			stream.Gaps = append(stream.Gaps, gap{Frame: stream.EssenceCount, Length: 1})
+		}
+	}
+
+	stream.size.Update(float64(length))
+	stream.LastOffset = md.globalPosition
+	stream.EssenceCount++
+
+	return pos, stream.EssenceCount - 1
+}
+
+// streamStatistics completes the statistics of each data stream, the
+// edit rate and namespace of the streams are found from the manifest.
+func (md *mrxDecoder) streamStatistics() []streamSummary {
+
+	for i, stream := range md.streams {
+		md.streams[i].Samples = append(md.streams[i].Samples, stream.lastSamples...)
+
+		size := stream.size
+		if size.count > 0 {
+			size.Variance, size.StandardDeviation = size.m2/size.count, math.Sqrt(size.m2/size.count)
+			md.streams[i].PayloadSize = &size
+		}
+
+		if md.config == nil {
+			continue
+		}
+
+		md.streams[i].NameSpace = md.config.StreamNameSpace(stream.Stream)
+
+		// only clocked data has an edit rate
+		if stream.EssenceType != "TC" && stream.EssenceType != "BC" {
+			continue
+		}
+
+		num, den, err := manifest.ParseFrameRate(md.config.StreamFrameRate(stream.Stream))
+		if err != nil {
+			// streams with an unreadable frame rate are treated as the default
+			num, den, _ = manifest.ParseFrameRate(manifest.DefaultFrameRate)
+		}
+
+		md.streams[i].EditRate = fmt.Sprintf("%v/%v", num, den)
+		md.streams[i].Duration = float64(stream.EssenceCount*den) / float64(num)
+	}
+
+	return md.streams
+}
+
+// manifestCheck validates an embedded manifest, any schema
+// violations are added as warnings with the offset of the manifest.
+func (md *mrxDecoder) manifestCheck(roundTrip []byte) {
+
+	// keep the configuration for finding the stream namespaces
+	var round manifest.RoundTrip
+	if json.Unmarshal(roundTrip, &round) == nil {
+		md.config = &round.Config
+	}
+
+	err := manifest.RoundTripValidator(roundTrip, true)
+	if err == nil {
+		return
+	}
+
+	schemaErrs := manifest.SchemaErrors(err)
+	if schemaErrs == nil {
+		md.warnings = append(md.warnings, offsetWarning(md.globalPosition, "the manifest at byte %v could not be validated: %v", md.globalPosition, err))
+		return
+	}
+
+	for _, schemaErr := range schemaErrs {
+		md.warnings = append(md.warnings, offsetWarning(md.globalPosition, "the manifest at byte %v does not match the schema at %v", md.globalPosition, schemaErr))
+	}
+}
+
 func indexUnpack(indexTable *klv.KLV, primer map[string]string) (map[string]any, error) {
 
 	// fmt.Println(fullName(indexTable[0:16]))
@@ -407,14 +798,34 @@ type mxfPartition struct {
 	IndexSID          uint32
 	BodyOffset        uint64
 	BodySID           uint32
+	// OperationalPattern and EssenceContainers are
+	// given as ULs
+	OperationalPattern string
+	EssenceContainers  []string
 
 	// useful information from the partition
 	PartitionType     string
+	Status            string
 	IndexTable        bool
 	TotalHeaderLength int
 	MetadataStart     int
 }
 
+const (
+	// genericStreamPartition is the partition type of
+	// a body partition for a generic stream
+	genericStreamPartition = "genericstreampartition"
+)
+
+// partitionStatus is the open/closed and complete/incomplete
+// status of the partition, from the 15th byte of the key
+var partitionStatus = map[byte]string{
+	1: "open incomplete",
+	2: "closed incomplete",
+	3: "open complete",
+	4: "closed complete",
+}
+
 var (
 	order = binary.BigEndian
 )
@@ -430,7 +841,11 @@ func partitionExtract(partionKLV *klv.KLV) mxfPartition {
 		partPack.PartitionType = "header"
 	case 03:
 		// body
-		partPack.PartitionType = "body"
+		if partionKLV.Key[14] == 17 {
+			partPack.PartitionType = genericStreamPartition
+		} else {
+			partPack.PartitionType = "body"
+		}
 	case 04:
 		// footer
 		partPack.PartitionType = "footer"
@@ -442,6 +857,11 @@ func partitionExtract(partionKLV *klv.KLV) mxfPartition {
 
 	partPack.Signature = fullName(partionKLV.Key)
 
+	// return early to prevent errors
+	if len(partionKLV.Value) < 64 {
+		return partPack
+	}
+
 	//	packLength, lengthlength := berDecode(ber)
 	partPack.PartitionLength = partionKLV.LengthValue
 	partPack.MajorVersion = order.Uint16(partionKLV.Value[:2:2])
@@ -456,6 +876,26 @@ func partitionExtract(partionKLV *klv.KLV) mxfPartition {
 	partPack.BodyOffset = order.Uint64(partionKLV.Value[52:60:60])
 	partPack.BodySID = order.Uint32(partionKLV.Value[60:64:64])
 
+	partPack.Status = partitionStatus[partionKLV.Key[14]]
+	// generic stream partitions are closed and complete
+	if partPack.PartitionType == genericStreamPartition {
+		partPack.Status = partitionStatus[4]
+	}
+
+	if len(partionKLV.Value) >= 80 {
+		partPack.OperationalPattern = fullName(partionKLV.Value[64:80:80])
+	}
+
+	// the essence containers are a batch of ULs
+	if len(partionKLV.Value) >= 88 {
+		count := int(order.Uint32(partionKLV.Value[80:84:84]))
+		length := int(order.Uint32(partionKLV.Value[84:88:88]))
+		partPack.EssenceContainers = []string{}
+		for i := 0; i < count && length == 16 && 88+(i+1)*length <= len(partionKLV.Value); i++ {
+			partPack.EssenceContainers = append(partPack.EssenceContainers, fullName(partionKLV.Value[88+i*length:88+(i+1)*length]))
+		}
+	}
+
 	kag := int(partPack.SizeKAG)
 	headerLength := int(partPack.HeaderByteCount)
 	indexLength := int(partPack.IndexByteCount)
@@ -484,33 +924,168 @@ func partitionExtract(partionKLV *klv.KLV) mxfPartition {
 	return partPack
 }
 
+// partitionPack is the partition pack as
+// it is written in the structure report
+type partitionPack struct {
+	Key                string   `yaml:"Key" json:"Key"`
+	Status             string   `yaml:"Status" json:"Status"`
+	MajorVersion       uint16   `yaml:"MajorVersion" json:"MajorVersion"`
+	MinorVersion       uint16   `yaml:"MinorVersion" json:"MinorVersion"`
+	KAGSize            uint32   `yaml:"KAGSize" json:"KAGSize"`
+	ThisPartition      uint64   `yaml:"ThisPartition" json:"ThisPartition"`
+	PreviousPartition  uint64   `yaml:"PreviousPartition" json:"PreviousPartition"`
+	FooterPartition    uint64   `yaml:"FooterPartition" json:"FooterPartition"`
+	HeaderByteCount    uint64   `yaml:"HeaderByteCount" json:"HeaderByteCount"`
+	IndexByteCount     uint64   `yaml:"IndexByteCount" json:"IndexByteCount"`
+	IndexSID           uint32   `yaml:"IndexSID" json:"IndexSID"`
+	BodyOffset         uint64   `yaml:"BodyOffset" json:"BodyOffset"`
+	BodySID            uint32   `yaml:"BodySID" json:"BodySID"`
+	OperationalPattern string   `yaml:"OperationalPattern" json:"OperationalPattern"`
+	EssenceContainers  []string `yaml:"EssenceContainers" json:"EssenceContainers"`
+}
+
+// report converts the partition to its report layout
+func (p mxfPartition) report() *partitionPack {
+	return &partitionPack{Key: p.Signature, Status: p.Status, MajorVersion: p.MajorVersion, MinorVersion: p.MinorVersion,
+		KAGSize: p.SizeKAG, ThisPartition: p.ThisPartition, PreviousPartition: p.PreviousPartition, FooterPartition: p.FooterPartition,
+		HeaderByteCount: p.HeaderByteCount, IndexByteCount: p.IndexByteCount, IndexSID: p.IndexSID, BodyOffset: p.BodyOffset,
+		BodySID: p.BodySID, OperationalPattern: p.OperationalPattern, EssenceContainers: p.EssenceContainers}
+}
+
+// randomIndexPack is the decoded random index pack
+type randomIndexPack struct {
+	Partitions []ripPartition `yaml:"Partitions" json:"Partitions"`
+	// Length is the total length of the RIP
+	// as written at the end of the RIP
+	Length uint32 `yaml:"Length" json:"Length"`
+}
+
+// ripPartition is the location of a partition in the RIP
+type ripPartition struct {
+	BodySID    uint32 `yaml:"BodySID" json:"BodySID"`
+	ByteOffset uint64 `yaml:"ByteOffset" json:"ByteOffset"`
+}
+
+// ripExtract decodes the random index pack,
+// of BodySID and byte offset pairs followed by the length of the pack.
+func ripExtract(ripKLV *klv.KLV) *randomIndexPack {
+
+	rip := &randomIndexPack{Partitions: []ripPartition{}}
+	pos := 0
+	for pos+12 <= len(ripKLV.Value)-4 {
+		rip.Partitions = append(rip.Partitions, ripPartition{BodySID: order.Uint32(ripKLV.Value[pos : pos+4]),
+			ByteOffset: order.Uint64(ripKLV.Value[pos+4 : pos+12])})
+		pos += 12
+	}
+
+	if len(ripKLV.Value) >= 4 {
+		rip.Length = order.Uint32(ripKLV.Value[len(ripKLV.Value)-4:])
+	}
+
+	return rip
+}
+
 type mrxDecoder struct {
 	Primer       map[string]string
 	Unknown      map[string]mxf2go.EssenceInformation
 	unknownCount *int
 
-	// internal layout of the mrx file
-	containers []container
-	allKeys    []contentPackage
+	// the layout is written as it is decoded, with
+	// the content packages limited as they are found
+	writer  layoutWriter
+	limiter *packageLimiter
 
 	// internal positions measurements
 	partitionCount, byteCount, globalPosition int
 
-	// container holder for each partition
-	currentContainer container
-	average          stats
+	// the current partition and content package
+	partitionType  string
+	currentPackage contentPackage
+	packageCount   int
+	average        stats
+
+	// file wide warnings, such as an invalid manifest
+	warnings []warning
+
+	// options for the payloads in the layout
+	options StructureOptions
+
+	// the random index pack at the end of the file
+	rip                  *randomIndexPack
+	ripOffset, ripLength int
+	// the partitions in the order they were found
+	locations []partitionLocation
+
+	// the data streams in the order they are found
+	currentSID int
+	streams    []streamSummary
+	streamIDs  map[essID]int
+	config     *manifest.Configuration
+}
+
+// streamSummary is the overview of a data stream
+// and what its namespace is
+type streamSummary struct {
+	Stream       int             `yaml:"Stream" json:"Stream"`
+	Key          string          `yaml:"Key" json:"Key"`
+	BodySID      int             `yaml:"BodySID" json:"BodySID"`
+	EssenceType  string          `yaml:"EssenceType" json:"EssenceType"`
+	EssenceCount int             `yaml:"EssenceCount" json:"EssenceCount"`
+	NameSpace    string          `yaml:"NameSpace,omitempty" json:"NameSpace,omitempty"`
+	Register     *register.Entry `yaml:"Register,omitempty" json:"Register,omitempty"`
+
+	// EditRate and Duration, in seconds, are only
+	// given for clocked data with a manifest
+	EditRate string  `yaml:"EditRate,omitempty" json:"EditRate,omitempty"`
+	Duration float64 `yaml:"Duration,omitempty" json:"Duration,omitempty"`
+	// PayloadSize is the statistics of the essence lengths
+	PayloadSize *stats `yaml:"PayloadSize,omitempty" json:"PayloadSize,omitempty"`
+	// EmptyFrames is the count of zero length essence,
+	// with each run of empty frames as a gap
+	EmptyFrames int   `yaml:"EmptyFrames" json:"EmptyFrames"`
+	Gaps        []gap `yaml:"Gaps,omitempty" json:"Gaps,omitempty"`
+	FirstOffset int   `yaml:"FirstOffset" json:"FirstOffset"`
+	LastOffset  int   `yaml:"LastOffset" json:"LastOffset"`
+	// Samples are the first and last frames of the stream
+	Samples []payloadSample `yaml:"Samples,omitempty" json:"Samples,omitempty"`
+
+	size        stats
+	lastSamples []payloadSample
+}
+
+// gap is a run of empty frames in a data stream
+type gap struct {
+	Frame  int `yaml:"Frame" json:"Frame"`
+	Length int `yaml:"Length" json:"Length"`
 }
 
 // errors: [{error: "essence found in header partition", location "header"}]
+// container is the layout of a partition. It is written in the
+// order it is decoded, the head is known once the partition pack
+// and header metadata have been read, and the tail once the essence
+// of the partition has been read.
 type container struct {
-	PartitionType       string `yaml:"PartitionType" json:"PartitionType"`
-	HeaderLength        int    `yaml:"HeaderLength" json:"HeaderLength"`
-	EssenceByteCount    int    `yaml:"EssenceByteCount" json:"EssenceByteCount"`
-	ContentPackageCount int    `yaml:"ContentPackageCount" json:"ContentPackageCount"`
-	// Optional Extras that give more info about each partition, depending on its layout
-	IndexTable      map[string]any   `yaml:"IndexTable,omitempty" json:"IndexTable,omitempty"`
-	Warning         *warning         `yaml:"Warning,omitempty" json:"Warning,omitempty"`
+	partitionHead   `yaml:",inline"`
 	ContentPackages []contentPackage `yaml:"ContentPackages,omitempty" json:"ContentPackages,omitempty"`
+	partitionTail   `yaml:",inline"`
+}
+
+// partitionHead is the layout of a partition before its essence
+type partitionHead struct {
+	PartitionType string `yaml:"PartitionType" json:"PartitionType"`
+	HeaderLength  int    `yaml:"HeaderLength" json:"HeaderLength"`
+	// PartitionPack is every field of the partition pack
+	PartitionPack *partitionPack `yaml:"PartitionPack,omitempty" json:"PartitionPack,omitempty"`
+	// Optional Extras that give more info about each partition, depending on its layout
+	IndexTable     map[string]any   `yaml:"IndexTable,omitempty" json:"IndexTable,omitempty"`
+	HeaderMetadata []*metadataGroup `yaml:"HeaderMetadata,omitempty" json:"HeaderMetadata,omitempty"`
+}
+
+// partitionTail is the layout of a partition after its essence
+type partitionTail struct {
+	EssenceByteCount    int      `yaml:"EssenceByteCount" json:"EssenceByteCount"`
+	ContentPackageCount int      `yaml:"ContentPackageCount" json:"ContentPackageCount"`
+	Warning             *warning `yaml:"Warning,omitempty" json:"Warning,omitempty"`
 
 	Stats *stats `yaml:"ContentPackageStatistics,omitempty" json:"ContentPackageStatistics,omitempty"`
 }
@@ -563,14 +1138,14 @@ func (s *stats) finalise() stats {
 }
 
 type warning struct {
-	Message string `yaml:"Message"`
+	Message string `yaml:"Message" json:"Message"`
+	// Offset is the byte offset in the file of the data the warning is for
+	Offset *int `yaml:"Offset,omitempty" json:"Offset,omitempty"`
 }
 
 type contentPackage struct {
 	ContentPackage       []keyLength `yaml:"ContentPackage,omitempty"`
 	ContentPackageLength int         `yaml:"ContentPackageLength,omitempty"`
-	// keep is not exported and is used for the internal filtering
-	keep bool
 }
 
 // tag everything
@@ -584,6 +1159,14 @@ type keyLength struct {
 	//	ElementLength  int
 	TotalByteCount      int `yaml:"TotalByteCount"`
 	TotalContainerCount int `yaml:"TotalContainerCount,omitempty"`
+	// Preview and Payload are only given when
+	// they are chosen in the StructureOptions
+	Preview string `yaml:"Preview,omitempty"`
+	Payload string `yaml:"Payload,omitempty"`
+
+	// the data stream and frame of the essence,
+	// these are -1 if it is not part of a data stream
+	stream, frame int
 
 	// blue cheese or not model - this will give labels like sound etc
 	//
@@ -652,13 +1235,8 @@ func fullNameOne(namebytes []byte) string {
 		namebytes[8], namebytes[9], namebytes[10], namebytes[11], namebytes[12], namebytes[13], namebytes[14])
 }
 
+// FullName returns the 16 byte key as a string of 4 byte hex groups,
+// it is the same as klv.FullName.
 func FullName(namebytes []byte) string {
-
-	if len(namebytes) != 16 {
-		return ""
-	}
-
-	return fmt.Sprintf("%02x%02x%02x%02x.%02x%02x%02x%02x.%02x%02x%02x%02x.%02x%02x%02x%02x",
-		namebytes[0], namebytes[1], namebytes[2], namebytes[3], namebytes[4], namebytes[5], namebytes[6], namebytes[7],
-		namebytes[8], namebytes[9], namebytes[10], namebytes[11], namebytes[12], namebytes[13], namebytes[14], namebytes[15])
+	return klv.FullName(namebytes)
 }
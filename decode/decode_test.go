@@ -3,10 +3,13 @@ package decode
 import (
 	"bytes"
 	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"os"
 	"testing"
 
+	"github.com/metarex-media/mrx-tool/manifest"
+	"github.com/metarex-media/mrx-tool/register"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -81,6 +84,50 @@ func TestFileRead(t *testing.T) {
 	}
 }
 
+func TestRegisterResolve(t *testing.T) {
+
+	reg, regErr := register.Load("../register/testdata/snapshot")
+
+	var resultsBuffer bytes.Buffer
+	streamer, _ := os.Open("./testdata/namespaces.mrx")
+	genErr := ExtractStructure(streamer, &resultsBuffer, StructureOptions{JSON: true, Register: reg})
+	var layout essenceLayout
+	jsonErr := json.Unmarshal(resultsBuffer.Bytes(), &layout)
+
+	streamer.Seek(0, 0)
+	streams, extractErr := ExtractStreamData(streamer)
+	gpsResolved := streams[0].Resolve(reg)
+	altResolved := streams[1].Resolve(reg)
+
+	gps := "https://metarex.media/reg/MRX.123.456.789.gps"
+	alt := "https://metarex.media/reg/MRX.123.456.789.alt"
+
+	Convey("Checking the namespaces of the data streams are resolved with the register", t, func() {
+		Convey("using an mrx file with one namespace in the register and one not in the register", func() {
+			Convey("the data streams have their register entries, with a warning for the missing namespace", func() {
+				So(regErr, ShouldBeNil)
+				So(genErr, ShouldBeNil)
+				So(jsonErr, ShouldBeNil)
+				So(len(layout.DataStreams), ShouldEqual, 2)
+				So(layout.DataStreams[0].NameSpace, ShouldEqual, gps)
+				So(layout.DataStreams[0].EssenceCount, ShouldEqual, 3)
+				So(layout.DataStreams[0].Register.Name, ShouldEqual, "GPS position")
+				So(layout.DataStreams[1].NameSpace, ShouldEqual, alt)
+				So(layout.DataStreams[1].Register, ShouldBeNil)
+				So(layout.Warnings, ShouldResemble, []warning{{Message: "the namespace " + alt + " of data stream 1 is not in the register"}})
+			})
+			Convey("the extracted streams have their namespaces and can be resolved", func() {
+				So(extractErr, ShouldBeNil)
+				So(gpsResolved, ShouldBeTrue)
+				So(streams[0].Name, ShouldEqual, "GPS position")
+				So(streams[0].MediaType, ShouldEqual, "application/json")
+				So(altResolved, ShouldBeFalse)
+				So(streams[1].NameSpace, ShouldEqual, alt)
+			})
+		})
+	})
+}
+
 func TestBadFileRead(t *testing.T) {
 
 	// run two different test files with and without index tables
@@ -108,3 +155,170 @@ func TestBadFileRead(t *testing.T) {
 }
 
 // Test bad files e.g. not klv files
+
+func TestHeaderMetadata(t *testing.T) {
+
+	var resultsBuffer bytes.Buffer
+	streamer, _ := os.Open("./testdata/namespaces.mrx")
+	genErr := ExtractStructure(streamer, &resultsBuffer, StructureOptions{JSON: true})
+	var layout essenceLayout
+	jsonErr := json.Unmarshal(resultsBuffer.Bytes(), &layout)
+
+	// groups that reference each other are still in the tree
+	loopA := &metadataGroup{InstanceID: "a", refs: []string{"b"}}
+	loopB := &metadataGroup{InstanceID: "b", refs: []string{"a"}}
+	loop := metadataTree([]*metadataGroup{loopA, loopB})
+
+	Convey("Checking the header metadata is decoded as a tree of strong references", t, func() {
+		Convey("using an mrx file with header metadata", func() {
+			Convey("the preface is the first root, with the content storage and packages as its children", func() {
+				So(genErr, ShouldBeNil)
+				So(jsonErr, ShouldBeNil)
+				preface := layout.Partitions[0].HeaderMetadata[0]
+				So(preface.Group, ShouldEqual, "Preface")
+				So(preface.InstanceID, ShouldNotBeEmpty)
+				So(preface.Children[0].Group, ShouldEqual, "ContentStorage")
+				So(preface.Properties["ContentStorageObject"], ShouldEqual, preface.Children[0].InstanceID)
+				So(preface.Children[0].Children[0].Group, ShouldEqual, "MaterialPackage")
+				So(preface.Children[0].Children[1].Group, ShouldEqual, "SourcePackage")
+			})
+		})
+		Convey("using groups that strongly reference each other", func() {
+			Convey("each group is only in the tree once", func() {
+				So(loop, ShouldResemble, []*metadataGroup{loopA})
+				So(loopA.Children, ShouldResemble, []*metadataGroup{loopB})
+				So(loopB.Children, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestPartitionReport(t *testing.T) {
+
+	var resultsBuffer bytes.Buffer
+	streamer, _ := os.Open("./testdata/namespaces.mrx")
+	genErr := ExtractStructure(streamer, &resultsBuffer, StructureOptions{JSON: true})
+	var layout essenceLayout
+	jsonErr := json.Unmarshal(resultsBuffer.Bytes(), &layout)
+
+	var types []string
+	var offsets []ripPartition
+	for _, part := range layout.Partitions {
+		types = append(types, part.PartitionType)
+		offsets = append(offsets, ripPartition{BodySID: part.PartitionPack.BodySID, ByteOffset: part.PartitionPack.ThisPartition})
+	}
+
+	Convey("Checking every partition pack and the RIP are reported", t, func() {
+		Convey("using an mrx file with generic stream partitions and a footer", func() {
+			Convey("every partition is labelled, and the RIP matches the partition packs", func() {
+				So(genErr, ShouldBeNil)
+				So(jsonErr, ShouldBeNil)
+				So(types, ShouldResemble, []string{"header", "body", genericStreamPartition, genericStreamPartition, "footer"})
+				So(layout.Partitions[0].PartitionPack.OperationalPattern, ShouldEqual, "060e2b34.04010101.0d010201.01010500")
+				So(layout.Partitions[2].PartitionPack.Status, ShouldEqual, "closed complete")
+				So(layout.RandomIndexPack, ShouldNotBeNil)
+				So(layout.RandomIndexPack.Partitions, ShouldResemble, offsets)
+			})
+		})
+	})
+}
+
+func TestStructureWarnings(t *testing.T) {
+
+	mrx, readErr := os.ReadFile("./testdata/namespaces.mrx")
+
+	// change the ThisPartition of the body partition at byte 3508,
+	// the partition pack length is 4 bytes of BER
+	moved := append([]byte{}, mrx...)
+	moved[3508+16+4+15] = 0xff
+
+	// remove the 81 byte RIP from the end of the file
+	noRIP := append([]byte{}, mrx[:len(mrx)-81]...)
+
+	// add bytes that are not klv after the RIP
+	trailing := append(append([]byte{}, mrx...), []byte("trail")...)
+
+	structureWarnings := func(file []byte) ([]warning, error) {
+		var resultsBuffer bytes.Buffer
+		err := ExtractStructure(bytes.NewReader(file), &resultsBuffer, StructureOptions{JSON: true})
+		var layout essenceLayout
+		json.Unmarshal(resultsBuffer.Bytes(), &layout)
+
+		return layout.Warnings, err
+	}
+
+	validWarnings, validErr := structureWarnings(mrx)
+	movedWarnings, movedErr := structureWarnings(moved)
+	noRIPWarnings, noRIPErr := structureWarnings(noRIP)
+	trailingWarnings, trailingErr := structureWarnings(trailing)
+
+	offset := func(offset int) *int {
+		return &offset
+	}
+
+	Convey("Checking the structure of the mrx file is checked for inconsistencies", t, func() {
+		Convey("using a valid mrx file", func() {
+			Convey("no warnings are given", func() {
+				So(readErr, ShouldBeNil)
+				So(validErr, ShouldBeNil)
+				So(validWarnings, ShouldBeNil)
+			})
+		})
+		Convey("using an mrx file with a partition pack pointing to the wrong byte", func() {
+			Convey("only that partition pack is flagged, at the partition offset", func() {
+				So(movedErr, ShouldBeNil)
+				So(movedWarnings, ShouldResemble, []warning{
+					{Message: "the body partition has a ThisPartition of 3583, but was found at byte 3508", Offset: offset(3508)},
+				})
+			})
+		})
+		Convey("using an mrx file without a RIP", func() {
+			Convey("the missing RIP is flagged at the end of the file", func() {
+				So(noRIPErr, ShouldBeNil)
+				So(noRIPWarnings, ShouldResemble, []warning{{Message: "no random index pack was found", Offset: offset(len(noRIP))}})
+			})
+		})
+		Convey("using an mrx file with data after the RIP", func() {
+			Convey("the trailing data is flagged after the RIP", func() {
+				So(trailingErr, ShouldBeNil)
+				So(len(trailingWarnings), ShouldEqual, 1)
+				So(*trailingWarnings[0].Offset, ShouldEqual, len(mrx))
+			})
+		})
+	})
+}
+
+func TestStreamStatistics(t *testing.T) {
+
+	md := &mrxDecoder{streamIDs: make(map[essID]int), currentSID: 1,
+		config: &manifest.Configuration{Default: manifest.StreamProperties{FrameRate: "25/1"}}}
+
+	// two runs of empty frames in a clocked stream
+	for _, length := range []int{10, 0, 0, 20, 0, 30} {
+		md.streamCount("clocked", "TC", make([]byte, length))
+		md.globalPosition += 100
+	}
+	md.streamCount("embedded", "TE", make([]byte, 5))
+
+	streams := md.streamStatistics()
+
+	Convey("Checking the statistics of each data stream are calculated", t, func() {
+		Convey("using a clocked stream with empty frames and an embedded stream", func() {
+			Convey("the empty frames are counted as gaps, and only clocked data has a duration", func() {
+				So(len(streams), ShouldEqual, 2)
+				So(streams[0].EssenceCount, ShouldEqual, 6)
+				So(streams[0].EmptyFrames, ShouldEqual, 3)
+				So(streams[0].Gaps, ShouldResemble, []gap{{Frame: 1, Length: 2}, {Frame: 4, Length: 1}})
+				So(streams[0].EditRate, ShouldEqual, "25/1")
+				So(streams[0].Duration, ShouldEqual, 0.24)
+				So(streams[0].PayloadSize.Mean, ShouldEqual, 10)
+				So(streams[0].PayloadSize.Minimum, ShouldEqual, 0)
+				So(streams[0].PayloadSize.Maxium, ShouldEqual, 30)
+				So(streams[0].FirstOffset, ShouldEqual, 0)
+				So(streams[0].LastOffset, ShouldEqual, 500)
+				So(streams[1].Duration, ShouldEqual, 0)
+				So(streams[1].PayloadSize.StandardDeviation, ShouldEqual, 0)
+			})
+		})
+	})
+}
@@ -2,24 +2,64 @@ package decode
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 
 	"github.com/metarex-media/mrx-tool/klv"
+	"github.com/metarex-media/mrx-tool/manifest"
 	"golang.org/x/sync/errgroup"
 )
 
 // EssenceExtractToFile extracts the contents from an MRX and dumps it to a folder as individual
 // files, where each file is an individual metadata entry from the file.
 func EssenceExtractToFile(stream io.Reader, parentFolder string, flat bool, leadingZeros int) error {
+	return ExtractEssence(stream, parentFolder, ExtractOptions{Flat: flat, LeadingZeros: leadingZeros})
+}
+
+// ExtractOptions are the options for extracting the essence of an MRX file.
+type ExtractOptions struct {
+	// Flat saves every file in the parent folder,
+	// instead of a folder for each data stream
+	Flat bool
+	// LeadingZeros is the minimum length of the file numbers
+	LeadingZeros int
+	// Streams select the data streams to extract, by their stream index,
+	// essence type of TC, BC, TE or BE, or namespace from the manifest.
+	// Every data stream is extracted if there are no streams.
+	Streams []string
+	// Frames is the inclusive range of frames to extract from each data stream,
+	// as first-last frame numbers or HH:MM:SS:FF timecodes, at the frame rate of the stream.
+	// Either end can be left empty e.g. 100- is from frame 100 to the end of the stream.
+	Frames string
+	// Template names the saved files relative to the parent folder, with the
+	// placeholders {stream}, {type}, {frame}, {timecode} and {ext}, where {ext} is
+	// the file extension from the content type of the stream. The default template
+	// is {stream}Stream{type}/{frame}d, or {stream}Stream{type}{frame}d when Flat is used.
+	Template string
+	// Sidecar writes where each file came from in the mrx file, as SidecarFile
+	// for a sidecar next to each file, or SidecarIndex for an index of each stream.
+	// No sidecars are written if it is empty.
+	Sidecar string
+}
+
+// ExtractEssence extracts the contents from an MRX and dumps it to a folder as individual
+// files, where each file is an individual metadata entry from the file. Only the
+// selected streams and frames are extracted, the files keep the frame numbers they
+// have when every frame is extracted.
+func ExtractEssence(stream io.Reader, parentFolder string, options ExtractOptions) error {
+
+	location, err := newEssenceLocation(options)
+	if err != nil {
+		return err
+	}
 
-	klvChan := make(chan *klv.KLV, 1000)
 	parentFolder, _ = filepath.Abs(parentFolder)
 
 	// check if the folder exits
-	_, err := os.Stat(parentFolder)
+	_, err = os.Stat(parentFolder)
 	if os.IsNotExist(err) {
 		err = os.MkdirAll(parentFolder, os.ModePerm)
 
@@ -28,7 +68,84 @@ func EssenceExtractToFile(stream io.Reader, parentFolder string, flat bool, lead
 		}
 	}
 
-	return essenceExtractToFile(stream, klvChan, parentFolder, flat, leadingZeros)
+	location.sink = &folderSink{root: parentFolder}
+
+	return extractEssence(stream, location)
+}
+
+// ExtractEssenceArchive extracts the contents from an MRX the same as ExtractEssence,
+// but the files are written as a tar or zip archive stream, instead of to a folder.
+func ExtractEssenceArchive(stream io.Reader, archive io.Writer, format string, options ExtractOptions) error {
+
+	location, err := newEssenceLocation(options)
+	if err != nil {
+		return err
+	}
+
+	sink, err := newArchiveSink(archive, format)
+	if err != nil {
+		return err
+	}
+
+	location.sink = sink
+
+	if err := extractEssence(stream, location); err != nil {
+		return err
+	}
+
+	return sink.close()
+}
+
+// newEssenceLocation checks the extract options
+func newEssenceLocation(options ExtractOptions) (*mrxPartitionPosition, error) {
+
+	filter, err := newEssenceFilter(options.Streams, options.Frames)
+	if err != nil {
+		return nil, err
+	}
+
+	naming, err := newNamingTemplate(options.Template, options.Flat, options.LeadingZeros)
+	if err != nil {
+		return nil, err
+	}
+
+	switch options.Sidecar {
+	case "", SidecarFile, SidecarIndex:
+	default:
+		return nil, fmt.Errorf("error unknown sidecar %v, the sidecar can be %v or %v", options.Sidecar, SidecarFile, SidecarIndex)
+	}
+
+	return &mrxPartitionPosition{dataStreams: make(map[essID]*essenceSaveTarget), filter: filter,
+		naming: naming, sidecar: options.Sidecar, indexes: make(map[int]*sidecarIndex)}, nil
+}
+
+// extractEssence reads the manifest if it is used, then extracts the essence
+func extractEssence(stream io.Reader, location *mrxPartitionPosition) error {
+
+	// the manifest is at the end of the file, so the file is
+	// read for the manifest before any essence is extracted
+	if location.filter.needsManifest() || location.sidecar != "" || location.naming.uses("{timecode}") || location.naming.uses("{ext}") {
+		seeker, cleanup, err := rereadable(stream)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		location.round, err = findManifest(seeker)
+		if err != nil {
+			return err
+		}
+
+		if location.filter != nil && location.round != nil {
+			location.filter.config = &location.round.Config
+		}
+
+		stream = seeker
+	}
+
+	klvChan := make(chan *klv.KLV, 1000)
+
+	return essenceExtractToFile(stream, klvChan, location)
 }
 
 type essenceSaveTarget struct {
@@ -39,6 +156,16 @@ type essenceSaveTarget struct {
 	// move along with the folder
 	// rolling partition count
 	essenceCount int
+
+	// the frames of the stream that are extracted, a last frame
+	// of -1 is the end of the stream
+	selected              bool
+	firstFrame, lastFrame int
+
+	// the file extension of the stream, found
+	// from the first frame that is saved
+	ext   string
+	named bool
 }
 
 type mrxPartitionPosition struct {
@@ -47,6 +174,21 @@ type mrxPartitionPosition struct {
 	currentPartitionName  string
 
 	nextDataStreamCount int
+
+	// filter selects the streams and frames
+	// to be extracted, nil extracts everything
+	filter *essenceFilter
+
+	// where and how the files are saved
+	sink   essenceSink
+	naming *namingTemplate
+
+	// the sidecars and the manifest properties they use,
+	// round is nil if there is no manifest
+	sidecar  string
+	indexes  map[int]*sidecarIndex
+	round    *manifest.RoundTrip
+	position int
 }
 
 // essID contains the properties for an essence key to be unique
@@ -139,7 +281,7 @@ func essenceExtract(stream io.Reader, buffer chan *klv.KLV) ([]*DataFormat, erro
 }
 
 // essenceExtractToFile takes and mrx file stream and decodes the data streams into seperate folders/files.
-func essenceExtractToFile(stream io.Reader, buffer chan *klv.KLV, parentFolder string, flat bool, leadingZeros int) error {
+func essenceExtractToFile(stream io.Reader, buffer chan *klv.KLV, location *mrxPartitionPosition) error {
 
 	// use errs to handle errors while runnig concurrently
 	errs, _ := errgroup.WithContext(context.Background())
@@ -150,8 +292,6 @@ func essenceExtractToFile(stream io.Reader, buffer chan *klv.KLV, parentFolder s
 
 	})
 
-	//	location := essenceFolder{parentFolder: parentFolder, streamCount: map[int]int{}}
-	location := mrxPartitionPosition{dataStreams: make(map[essID]*essenceSaveTarget)}
 	// initiate the klv handling stream
 	errs.Go(func() error {
 
@@ -185,12 +325,7 @@ func essenceExtractToFile(stream io.Reader, buffer chan *klv.KLV, parentFolder s
 			} else {
 
 				// decode as essence
-				var err error
-				if flat {
-					err = location.essenceSaveFlat(parentFolder, klvItem, leadingZeros)
-				} else {
-					err = location.essenceSave(parentFolder, klvItem, leadingZeros)
-				}
+				err := location.essenceSave(klvItem)
 
 				if err != nil {
 
@@ -208,11 +343,14 @@ func essenceExtractToFile(stream io.Reader, buffer chan *klv.KLV, parentFolder s
 	// if there is an error.
 	err := errs.Wait()
 
+	// finish the indexes of what has been saved
+	indexErr := location.closeIndexes()
+
 	if err != nil {
 		return err
 	}
 	// if everything has been read end the extraction
-	return nil
+	return indexErr
 }
 
 func (e *mrxPartitionPosition) partitionDecode(klvItem *klv.KLV, metadata chan *klv.KLV) error {
@@ -224,7 +362,7 @@ func (e *mrxPartitionPosition) partitionDecode(klvItem *klv.KLV, metadata chan *
 
 	// update the current partition layout location
 	e.currentPartitionName = partitionLayout.PartitionType
-	if e.currentPartitionName == "body" {
+	if e.currentPartitionName == "body" || e.currentPartitionName == genericStreamPartition {
 		e.currentPartitionName = "mrxip"
 
 	}
@@ -240,21 +378,21 @@ func (e *mrxPartitionPosition) partitionDecode(klvItem *klv.KLV, metadata chan *
 		flushedMeta += flush.TotalLength()
 
 	}
+	e.position += klvItem.TotalLength() + flushedMeta
 
 	// hoover up the indextable and remove it to rpevent it being mistaken as essence
 	if partitionLayout.IndexTable {
-		_, open := <-metadata
+		index, open := <-metadata
 		if !open {
 			return fmt.Errorf("error when using klv data klv stream interrupted")
 		}
+		e.position += index.TotalLength()
 	}
 	// position += md.currentContainer.HeaderLength
 
 	return nil
 }
 
-var pathSeparator = string(os.PathSeparator)
-
 func (e *mrxPartitionPosition) essenceWrite(layouter *[]*DataFormat, data *klv.KLV) error {
 
 	// derefernce for donig sums
@@ -288,7 +426,9 @@ func (e *mrxPartitionPosition) essenceWrite(layouter *[]*DataFormat, data *klv.K
 	// stop it adding up etc
 	if len(layout) < pos+1 {
 		outData := make([][]byte, 0)
-		layout = append(layout, &DataFormat{Data: outData, MRXID: fullName(data.Key)})
+		// label a copy as the key is masked when labelled
+		layout = append(layout, &DataFormat{Data: outData, MRXID: fullName(data.Key),
+			EssenceType: essLabeller(append([]byte{}, data.Key...))})
 
 	}
 
@@ -304,105 +444,95 @@ func (e *mrxPartitionPosition) essenceWrite(layouter *[]*DataFormat, data *klv.K
 	return nil
 }
 
-func (e *mrxPartitionPosition) essenceSaveFlat(parentFolder string, data *klv.KLV, leadingZeros int) error {
-
-	// get the positional information
+// essenceSave saves the essence as a file named by the naming template,
+// with its sidecar if sidecars are used.
+func (e *mrxPartitionPosition) essenceSave(data *klv.KLV) error {
 
 	writeTarget := e.getCounter(string(data.Key))
-	// generate the file name as a flat path
+	// label a copy as the key is masked when labelled
+	essLabel := essLabeller(append([]byte{}, data.Key...))
 
-	essLabel := essLabeller(data.Key)
+	offset := e.position
+	e.position += data.TotalLength()
 
 	if essLabel == "manifest" {
-		return manifestSave(parentFolder+pathSeparator, data)
+		return e.sink.writeFile("config.json", data.Value)
 	}
 
-	basePath := fmt.Sprintf(parentFolder+pathSeparator+"%04dStream%s", writeTarget.parentStream, essLabel)
-	//	basePath += fmt.Sprintf("%04d"+writeTarget.partition, writeTarget.partitionCount)
-	essFile, err := os.Create(basePath + leadingZero(writeTarget.essenceCount, leadingZeros) + "d")
-
-	if err != nil {
+	// skip the frames that are not extracted, keeping the frame count
+	if keep, err := e.extracted(writeTarget, essLabel); !keep || err != nil {
+		writeTarget.increment()
 		return err
 	}
 
-	_, err = essFile.Write(data.Value)
-
-	if err != nil {
-		return err
+	stream, frame := writeTarget.parentStream, writeTarget.essenceCount
+	if !writeTarget.named {
+		writeTarget.named = true
+		writeTarget.ext = extension(e.contentType(stream), essLabel, data.Value)
 	}
 
-	writeTarget.increment()
-
-	return nil
-}
-
-func manifestSave(basePath string, data *klv.KLV) error {
-	essFile, err := os.Create(basePath + "config.json")
-
+	// the timecodes follow on from the start timecode of the file
+	fps, start, err := streamStart(e.config(), stream)
 	if err != nil {
 		return err
 	}
+	frameTimecode := manifest.FormatTimecode(start+frame, fps)
 
-	_, err = essFile.Write(data.Value)
-
-	return err
-
-}
-
-func (e *mrxPartitionPosition) essenceSave(parentFolder string, data *klv.KLV, leadingZeros int) error {
-
-	writeTarget := e.getCounter(string(data.Key))
-	essLabel := essLabeller(data.Key)
-
-	if essLabel == "manifest" {
-		return manifestSave(parentFolder+pathSeparator, data)
+	name := e.naming.name(stream, essLabel, frame, frameTimecode, writeTarget.ext)
+	if err := e.sink.writeFile(name, data.Value); err != nil {
+		return err
 	}
 
-	// check for mnaifest before saving
-
-	basePath := fmt.Sprintf(parentFolder+pathSeparator+"%04dStream%s", writeTarget.parentStream, essLabel)
-
-	if _, err := os.Stat(basePath); os.IsNotExist(err) {
+	if e.sidecar != "" {
+		sidecar := essenceSidecar{File: name, Stream: stream, EssenceType: essLabel, Key: fullName(data.Key),
+			BodySID: e.currentPartitionCount, Frame: frame, Timecode: frameTimecode, FileOffset: offset,
+			Length: len(data.Value), Hash: fmt.Sprintf("%64x", sha256.Sum256(data.Value)), EssenceProperties: e.essenceProperties(stream, frame)}
 
-		err := os.MkdirAll(basePath, 0777)
-
-		if err != nil {
+		if err := e.writeSidecar(sidecar); err != nil {
 			return err
 		}
 	}
 
-	// e.partitionCount = e.streamCount[e.parentStream]
+	writeTarget.increment()
 
-	/*	basePath += fmt.Sprintf(pathSeparator+"%04d"+writeTarget.partition, writeTarget.partitionCount)
+	return nil
+}
 
-		if _, err := os.Stat(basePath); os.IsNotExist(err) {
+// config returns the configuration from the manifest,
+// which is empty if there is no manifest
+func (e *mrxPartitionPosition) config() manifest.Configuration {
+	if e.round == nil {
+		return manifest.Configuration{}
+	}
 
-			err := os.Mkdir(basePath, 0777)
+	return e.round.Config
+}
 
-			if err != nil {
-				return err
-			}
-		}*/
+func (e *essenceSaveTarget) increment() {
+	e.essenceCount++
+}
 
-	essFile, err := os.Create(basePath + pathSeparator + leadingZero(writeTarget.essenceCount, leadingZeros) + "d")
+// extracted checks if the next frame of the data stream is extracted.
+// The stream and its frame range are checked the first time it is found.
+func (e *mrxPartitionPosition) extracted(writeTarget *essenceSaveTarget, essLabel string) (bool, error) {
 
-	if err != nil {
-		return err
+	if e.filter == nil {
+		return true, nil
 	}
 
-	_, err = essFile.Write(data.Value)
-
-	if err != nil {
-		return err
+	if writeTarget.essenceCount == 0 {
+		var err error
+		writeTarget.selected = e.filter.selected(writeTarget.parentStream, essLabel)
+		writeTarget.firstFrame, writeTarget.lastFrame, err = e.filter.streamFrames(writeTarget.parentStream)
+		if err != nil {
+			return false, err
+		}
 	}
 
-	writeTarget.increment()
+	frame := writeTarget.essenceCount
 
-	return nil
-}
-
-func (e *essenceSaveTarget) increment() {
-	e.essenceCount++
+	return writeTarget.selected && frame >= writeTarget.firstFrame &&
+		(writeTarget.lastFrame == -1 || frame <= writeTarget.lastFrame), nil
 }
 
 func leadingZero(num int, zeroLength int) string {
@@ -0,0 +1,249 @@
+package decode
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/metarex-media/mrx-tool/manifest"
+	"github.com/metarex-media/mrx-tool/register"
+)
+
+// essenceTypes are the essence types that can be used to select data streams
+var essenceTypes = []string{"TC", "BC", "TE", "BE"}
+
+// essenceFilter selects the data streams and frames
+// that are extracted from an mrx file.
+type essenceFilter struct {
+	streams []string
+	frames  *frameRange
+	config  *manifest.Configuration
+}
+
+// frameRange is an inclusive range of frames, where each
+// end is a frame number, a HH:MM:SS:FF timecode or empty.
+type frameRange struct {
+	first, last string
+}
+
+// newEssenceFilter checks the stream selectors and frame range.
+// nil is returned if every frame of every stream is extracted.
+func newEssenceFilter(streams []string, frames string) (*essenceFilter, error) {
+
+	if len(streams) == 0 && frames == "" {
+		return nil, nil
+	}
+
+	filter := &essenceFilter{streams: streams}
+	if frames == "" {
+		return filter, nil
+	}
+
+	first, last, found := strings.Cut(frames, "-")
+	if !found {
+		return nil, fmt.Errorf("error parsing the frame range %v, expected a range of first-last", frames)
+	}
+
+	filter.frames = &frameRange{first: strings.TrimSpace(first), last: strings.TrimSpace(last)}
+
+	// check the range can be parsed, any configuration
+	// is used as the timecodes are checked later
+	if _, _, err := filter.frames.frames(manifest.Configuration{}, 0); err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+// needsManifest checks if the manifest is needed for the
+// namespaces or frame rates of the data streams.
+func (f *essenceFilter) needsManifest() bool {
+
+	if f == nil {
+		return false
+	}
+
+	for _, selector := range f.streams {
+		if _, err := strconv.Atoi(selector); err != nil && !isEssenceType(selector) {
+			return true
+		}
+	}
+
+	return f.frames != nil && (strings.Contains(f.frames.first, ":") || strings.Contains(f.frames.last, ":"))
+}
+
+// isEssenceType checks if a selector is an essence type
+func isEssenceType(selector string) bool {
+	for _, essType := range essenceTypes {
+		if strings.EqualFold(selector, essType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// selected checks if a data stream is selected by any of the
+// stream selectors, every stream is selected if there are none.
+func (f *essenceFilter) selected(stream int, essLabel string) bool {
+
+	if f == nil || len(f.streams) == 0 {
+		return true
+	}
+
+	nameSpace := ""
+	if f.config != nil {
+		nameSpace = f.config.StreamNameSpace(stream)
+	}
+
+	for _, selector := range f.streams {
+		index, err := strconv.Atoi(selector)
+		switch {
+		case err == nil:
+			if index == stream {
+				return true
+			}
+		case isEssenceType(selector):
+			if strings.EqualFold(selector, essLabel) {
+				return true
+			}
+		case nameSpace != "":
+			// namespaces can be given in full or as their MRX ID
+			if selector == nameSpace || selector == register.MRXID(nameSpace) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// streamFrames returns the first and last frame to be extracted
+// from a data stream, a last frame of -1 is the end of the stream.
+func (f *essenceFilter) streamFrames(stream int) (int, int, error) {
+
+	if f == nil || f.frames == nil {
+		return 0, -1, nil
+	}
+
+	var config manifest.Configuration
+	if f.config != nil {
+		config = *f.config
+	}
+
+	return f.frames.frames(config, stream)
+}
+
+// frames returns the first and last frames of the range, for the frame
+// rate and start timecode of the stream in the configuration
+func (r frameRange) frames(config manifest.Configuration, stream int) (int, int, error) {
+
+	fps, start, err := streamStart(config, stream)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	first, err := frameNumber(r.first, fps, start, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	last, err := frameNumber(r.last, fps, start, -1)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if last != -1 && last < first {
+		return 0, 0, fmt.Errorf("error the frame range %v-%v ends before it starts", r.first, r.last)
+	}
+
+	return first, last, nil
+}
+
+// streamStart returns the frames per second of the timecodes of a stream, and the
+// frame of the stream at the start timecode. The start timecode is at the frame
+// rate of the first clocked stream, which is the first stream of the file, so it
+// is found at that rate then scaled to the frame rate of the stream.
+func streamStart(config manifest.Configuration, stream int) (fps, start int, err error) {
+
+	baseRate := config.StreamFrameRate(0)
+	baseFPS, err := manifest.NominalFPS(baseRate)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	baseStart, err := config.StartFrame(baseFPS)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	frameRate := config.StreamFrameRate(stream)
+	fps, err = manifest.NominalFPS(frameRate)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// the frame rates have been checked when finding the fps
+	num, den, _ := manifest.ParseFrameRate(frameRate)
+	baseNum, baseDen, _ := manifest.ParseFrameRate(baseRate)
+	start = int(math.Round(float64(baseStart) * float64(num*baseDen) / float64(den*baseNum)))
+
+	return fps, start, nil
+}
+
+// frameNumber converts a frame number or HH:MM:SS:FF timecode from the
+// start timecode to a frame number. empty is returned for an empty position.
+func frameNumber(position string, fps, start, empty int) (int, error) {
+
+	if position == "" {
+		return empty, nil
+	}
+
+	if !strings.Contains(position, ":") {
+		frame, err := strconv.Atoi(position)
+		if err != nil || frame < 0 {
+			return 0, fmt.Errorf("error parsing the frame %v, expected a frame number or HH:MM:SS:FF timecode", position)
+		}
+
+		return frame, nil
+	}
+
+	frame, err := manifest.ParseTimecode(position, fps)
+	if err != nil {
+		return 0, err
+	}
+
+	if frame < start {
+		return 0, fmt.Errorf("error the timecode %v is before the start timecode %v of the file", position, manifest.FormatTimecode(start, fps))
+	}
+
+	return frame - start, nil
+}
+
+// findManifest reads the stream for the manifest, then returns the stream
+// to where it started. nil is returned if there is no manifest.
+func findManifest(stream io.ReadSeeker) (*manifest.RoundTrip, error) {
+
+	start, err := stream.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestBytes, err := lastManifest(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	var round *manifest.RoundTrip
+	var found manifest.RoundTrip
+	if manifestBytes != nil && json.Unmarshal(manifestBytes, &found) == nil {
+		round = &found
+	}
+
+	_, err = stream.Seek(start, io.SeekStart)
+
+	return round, err
+}
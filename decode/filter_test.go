@@ -0,0 +1,113 @@
+package decode
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/metarex-media/mrx-tool/manifest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFrameRange(t *testing.T) {
+
+	numbers, _ := newEssenceFilter(nil, "10-20")
+	open, _ := newEssenceFilter(nil, "5-")
+	timecodes, _ := newEssenceFilter(nil, "00:00:01:00-00:01:00:05")
+
+	numFirst, numLast, numErr := numbers.streamFrames(0)
+	openFirst, openLast, openErr := open.streamFrames(0)
+	// 25 fps and the nominal 30 fps of 30000/1001
+	tcFirst, tcLast, tcErr := timecodes.frames.frames(manifest.Configuration{Default: manifest.StreamProperties{FrameRate: "25/1"}}, 0)
+	ntscFirst, _, ntscErr := timecodes.frames.frames(manifest.Configuration{Default: manifest.StreamProperties{FrameRate: "30000/1001"}}, 0)
+	_, _, badFrameErr := timecodes.frames.frames(manifest.Configuration{Default: manifest.StreamProperties{FrameRate: "0/1"}}, 0)
+
+	// timecodes are from the start timecode of the file
+	started := manifest.Configuration{StartTimecode: "00:00:01:00"}
+	startFirst, startLast, startErr := timecodes.frames.frames(started, 0)
+	_, _, beforeErr := timecodes.frames.frames(manifest.Configuration{StartTimecode: "00:00:02:00"}, 0)
+
+	// the start timecode is at the frame rate of the first stream
+	mixed := manifest.Configuration{StartTimecode: "00:00:01:10", StreamProperties: map[int]manifest.StreamProperties{0: {FrameRate: "25/1"}, 1: {FrameRate: "50/1"}}}
+	later, _ := newEssenceFilter(nil, "00:00:02:00-")
+	baseFirst, _, baseErr := later.frames.frames(mixed, 0)
+	fastFirst, _, fastErr := later.frames.frames(mixed, 1)
+
+	none, noneErr := newEssenceFilter(nil, "")
+	_, noRangeErr := newEssenceFilter(nil, "10")
+	_, backwardsErr := newEssenceFilter(nil, "20-10")
+	_, badTimecodeErr := newEssenceFilter(nil, "00:00:61:00-")
+
+	Convey("Checking the frame ranges of the extracted essence are found", t, func() {
+		Convey("using frame numbers, open ended ranges and timecodes at different frame rates", func() {
+			Convey("the first and last frames are found, with -1 as the end of the stream", func() {
+				So(numErr, ShouldBeNil)
+				So([]int{numFirst, numLast}, ShouldResemble, []int{10, 20})
+				So(openErr, ShouldBeNil)
+				So([]int{openFirst, openLast}, ShouldResemble, []int{5, -1})
+				So(tcErr, ShouldBeNil)
+				So([]int{tcFirst, tcLast}, ShouldResemble, []int{25, 1505})
+				So(ntscErr, ShouldBeNil)
+				So(ntscFirst, ShouldEqual, 30)
+				So(badFrameErr, ShouldNotBeNil)
+			})
+		})
+		Convey("using timecodes with a start timecode", func() {
+			Convey("the frames are from the start timecode, with an error for timecodes before it", func() {
+				So(startErr, ShouldBeNil)
+				So([]int{startFirst, startLast}, ShouldResemble, []int{0, 1421})
+				So(beforeErr, ShouldResemble, fmt.Errorf("error the timecode 00:00:01:00 is before the start timecode 00:00:02:00 of the file"))
+			})
+		})
+		Convey("using timecodes with a start timecode, on streams of different frame rates", func() {
+			Convey("the start timecode is found at the rate of the first stream, then scaled to the rate of each stream", func() {
+				So(baseErr, ShouldBeNil)
+				So(baseFirst, ShouldEqual, 15)
+				So(fastErr, ShouldBeNil)
+				So(fastFirst, ShouldEqual, 30)
+			})
+		})
+		Convey("using no range and invalid ranges", func() {
+			Convey("there is no filter for no range, and an error for invalid ranges", func() {
+				So(none, ShouldBeNil)
+				So(noneErr, ShouldBeNil)
+				So(noRangeErr, ShouldResemble, fmt.Errorf("error parsing the frame range 10, expected a range of first-last"))
+				So(backwardsErr, ShouldResemble, fmt.Errorf("error the frame range 20-10 ends before it starts"))
+				So(badTimecodeErr, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestFilteredExtract(t *testing.T) {
+
+	selectors := [][]string{{"MRX.123.456.789.gps"}, {"TE"}, {"1"}, {"https://metarex.media/reg/MRX.123.456.789.gps", "TE"}}
+	frames := []string{"1-", "", "0-0", "-1"}
+	expected := [][]string{{"0000StreamTC/0001d", "0000StreamTC/0002d", "config.json"}, {"0001StreamTE/0000d", "config.json"},
+		{"0001StreamTE/0000d", "config.json"}, {"0000StreamTC/0000d", "0000StreamTC/0001d", "0001StreamTE/0000d", "config.json"}}
+
+	for i, streams := range selectors {
+		streamer, _ := os.Open("./testdata/namespaces.mrx")
+		out := t.TempDir()
+		genErr := ExtractEssence(streamer, out, ExtractOptions{LeadingZeros: 4, Streams: streams, Frames: frames[i]})
+
+		var files []string
+		filepath.Walk(out, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				rel, _ := filepath.Rel(out, path)
+				files = append(files, filepath.ToSlash(rel))
+			}
+			return err
+		})
+
+		Convey("Checking only the selected streams and frames are extracted", t, func() {
+			Convey(fmt.Sprintf("using %v as the stream selectors, with the frames %v", streams, frames[i]), func() {
+				Convey("only the selected frames are saved, keeping their frame numbers", func() {
+					So(genErr, ShouldBeNil)
+					So(files, ShouldResemble, expected[i])
+				})
+			})
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package decode
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// layoutWriter writes the layout of an mrx file as it is decoded,
+// so the layout of the whole file is never held in memory.
+type layoutWriter interface {
+	// startPartition writes the partition once its header has been read
+	startPartition(head partitionHead) error
+	// contentPackage writes a content package of the current partition
+	contentPackage(cp contentPackage) error
+	// endPartition writes the partition once its essence has been read
+	endPartition(tail partitionTail) error
+	// end writes the file information once every partition has been read
+	end(tail layoutTail) error
+}
+
+// the output formats of the layout
+const (
+	FormatYAML   = "yaml"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+)
+
+// newLayoutWriter returns the layout writer for the output format
+func newLayoutWriter(w io.Writer, options StructureOptions) (layoutWriter, error) {
+
+	format := options.Format
+	switch {
+	case format == "" && options.JSON:
+		format = FormatJSON
+	case options.JSON && format != FormatJSON:
+		return nil, fmt.Errorf("error the json output conflicts with the %v format, please only use the format", format)
+	}
+
+	switch format {
+	case "", FormatYAML:
+		return &yamlLayout{w: w}, nil
+	case FormatJSON:
+		return &jsonLayout{w: w}, nil
+	case FormatNDJSON:
+		return &recordLayout{partition: -1, json: json.NewEncoder(w)}, nil
+	case FormatCSV:
+		return &recordLayout{partition: -1, csv: csv.NewWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("error unknown output format %v, the format can be yaml, json, ndjson or csv", format)
+	}
+}
+
+// packageCounter counts the content packages
+// of a file, without writing the layout
+type packageCounter struct {
+	count int
+}
+
+func (pc *packageCounter) startPartition(partitionHead) error { return nil }
+
+func (pc *packageCounter) contentPackage(contentPackage) error {
+	pc.count++
+	return nil
+}
+
+func (pc *packageCounter) endPartition(partitionTail) error { return nil }
+
+func (pc *packageCounter) end(layoutTail) error { return nil }
+
+// yamlLayout writes the layout as a yaml document, each section is
+// marshalled in the same nesting it has in the layout, so it is
+// written the same as the layout marshalled as a single document.
+type yamlLayout struct {
+	w io.Writer
+	// track which keys have been written
+	partitions, packages bool
+}
+
+// yamlPartitions and yamlPackages nest the
+// sections as they are nested in the layout
+type yamlPartitions[T any] struct {
+	Partitions []T `yaml:"Partitions"`
+}
+
+type yamlPackages struct {
+	ContentPackages []contentPackage `yaml:"ContentPackages"`
+}
+
+func (y *yamlLayout) startPartition(head partitionHead) error {
+	nested := yamlPartitions[partitionHead]{Partitions: []partitionHead{head}}
+	y.packages = false
+
+	// the partitions key is only written once
+	if !y.partitions {
+		y.partitions = true
+		return y.write(nested, 0, false)
+	}
+
+	return y.write(nested, 1, false)
+}
+
+func (y *yamlLayout) contentPackage(cp contentPackage) error {
+	nested := yamlPartitions[yamlPackages]{Partitions: []yamlPackages{{ContentPackages: []contentPackage{cp}}}}
+
+	// the content packages key is only written once per partition
+	if !y.packages {
+		y.packages = true
+		return y.write(nested, 1, true)
+	}
+
+	return y.write(nested, 2, false)
+}
+
+func (y *yamlLayout) endPartition(tail partitionTail) error {
+	return y.write(yamlPartitions[partitionTail]{Partitions: []partitionTail{tail}}, 1, true)
+}
+
+func (y *yamlLayout) end(tail layoutTail) error {
+	if !y.partitions {
+		if _, err := io.WriteString(y.w, "Partitions: []\n"); err != nil {
+			return err
+		}
+	}
+
+	sectionBytes, err := yaml.Marshal(tail)
+	if err != nil || string(sectionBytes) == "{}\n" {
+		return err
+	}
+
+	_, err = y.w.Write(sectionBytes)
+
+	return err
+}
+
+// write marshals the nested section, without the first skip lines that
+// have already been written. continued is used for sections that carry on
+// from the previous partition item, rather than starting a new one.
+func (y *yamlLayout) write(nested any, skip int, continued bool) error {
+
+	sectionBytes, err := yaml.Marshal(nested)
+	if err != nil {
+		return err
+	}
+
+	lines := bytes.SplitAfterN(sectionBytes, []byte("\n"), skip+1)
+	section := lines[len(lines)-1]
+
+	if continued {
+		// replace the start of the partition item with its indentation
+		section = append([]byte{}, section...)
+		if dash := bytes.Index(section, []byte("- ")); dash != -1 {
+			section[dash] = ' '
+		}
+	}
+
+	_, err = y.w.Write(section)
+
+	return err
+}
+
+// jsonLayout writes the layout as an indented json document, matching
+// the layout when it is marshalled as a single document.
+type jsonLayout struct {
+	w io.Writer
+	// track which objects and arrays have been written
+	partitions, packages, fields bool
+}
+
+func (j *jsonLayout) startPartition(head partitionHead) error {
+
+	start := ",\n        {"
+	if !j.partitions {
+		j.partitions = true
+		start = "{\n    \"Partitions\": [\n        {"
+	}
+
+	if _, err := io.WriteString(j.w, start); err != nil {
+		return err
+	}
+
+	j.packages, j.fields = false, false
+
+	return j.writeFields(head, "            ")
+}
+
+func (j *jsonLayout) contentPackage(cp contentPackage) error {
+
+	start := ",\n                "
+	if !j.packages {
+		j.packages = true
+		start = "\n            \"ContentPackages\": [\n                "
+		if j.fields {
+			start = "," + start
+		}
+	}
+
+	cpBytes, err := json.MarshalIndent(cp, "                ", "    ")
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(j.w, start); err != nil {
+		return err
+	}
+
+	_, err = j.w.Write(cpBytes)
+
+	return err
+}
+
+func (j *jsonLayout) endPartition(tail partitionTail) error {
+	if j.packages {
+		j.fields = true
+		if _, err := io.WriteString(j.w, "\n            ]"); err != nil {
+			return err
+		}
+	}
+
+	if err := j.writeFields(tail, "            "); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(j.w, "\n        }")
+
+	return err
+}
+
+func (j *jsonLayout) end(tail layoutTail) error {
+
+	end := "\n    ]"
+	if !j.partitions {
+		end = "{\n    \"Partitions\": []"
+	}
+
+	if _, err := io.WriteString(j.w, end); err != nil {
+		return err
+	}
+
+	j.fields = true
+	if err := j.writeFields(tail, "    "); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(j.w, "\n}")
+
+	return err
+}
+
+// writeFields writes the fields of the section into the object
+// that is currently being written, without the surrounding braces.
+func (j *jsonLayout) writeFields(section any, indent string) error {
+
+	sectionBytes, err := json.MarshalIndent(section, indent[:len(indent)-4], "    ")
+	if err != nil {
+		return err
+	}
+
+	// remove the braces, leaving the fields
+	fields := bytes.TrimSuffix(bytes.TrimPrefix(sectionBytes, []byte("{")), []byte("\n"+indent[:len(indent)-4]+"}"))
+	if len(bytes.TrimSpace(fields)) == 0 || string(sectionBytes) == "{}" {
+		return nil
+	}
+
+	if j.fields {
+		if _, err := io.WriteString(j.w, ","); err != nil {
+			return err
+		}
+	}
+	j.fields = true
+
+	_, err = j.w.Write(fields)
+
+	return err
+}
+
+// klvRecord is the flat layout of a single essence KLV. Stream and Frame
+// are -1 for essence that is not part of a data stream, such as the manifest.
+type klvRecord struct {
+	Partition      int    `json:"Partition"`
+	Stream         int    `json:"Stream"`
+	Frame          int    `json:"Frame"`
+	Key            string `json:"Key"`
+	Symbol         string `json:"Symbol"`
+	FileOffset     int    `json:"FileOffset"`
+	Length         int    `json:"Length"`
+	TotalByteCount int    `json:"TotalByteCount"`
+}
+
+// klvRecordHeader is the header of the csv records
+var klvRecordHeader = []string{"Partition", "Stream", "Frame", "Key", "Symbol", "FileOffset", "Length", "TotalByteCount"}
+
+// row returns the record as a row of csv fields
+func (r klvRecord) row() []string {
+	return []string{strconv.Itoa(r.Partition), strconv.Itoa(r.Stream), strconv.Itoa(r.Frame), r.Key, r.Symbol,
+		strconv.Itoa(r.FileOffset), strconv.Itoa(r.Length), strconv.Itoa(r.TotalByteCount)}
+}
+
+// recordLayout writes a record for each essence KLV, as
+// a line of ndjson or a csv row, instead of the layout.
+type recordLayout struct {
+	// the index of the current partition
+	partition int
+
+	json   *json.Encoder
+	csv    *csv.Writer
+	header bool
+}
+
+func (r *recordLayout) startPartition(partitionHead) error {
+	r.partition++
+	return nil
+}
+
+func (r *recordLayout) contentPackage(cp contentPackage) error {
+	for _, ess := range cp.ContentPackage {
+		record := klvRecord{Partition: r.partition, Stream: ess.stream, Frame: ess.frame, Key: ess.Key, Symbol: ess.Symbol,
+			FileOffset: ess.FileOffset, Length: ess.Length, TotalByteCount: ess.TotalByteCount}
+		if err := r.write(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *recordLayout) endPartition(partitionTail) error {
+	return r.flush()
+}
+
+func (r *recordLayout) end(layoutTail) error {
+	return r.flush()
+}
+
+// write writes a single record
+func (r *recordLayout) write(record klvRecord) error {
+	if r.json != nil {
+		return r.json.Encode(record)
+	}
+
+	if err := r.writeHeader(); err != nil {
+		return err
+	}
+
+	return r.csv.Write(record.row())
+}
+
+// writeHeader writes the csv header, if it has not been written
+func (r *recordLayout) writeHeader() error {
+	if r.header {
+		return nil
+	}
+
+	r.header = true
+
+	return r.csv.Write(klvRecordHeader)
+}
+
+// flush writes any buffered csv rows, the header is
+// always written even if there are no records.
+func (r *recordLayout) flush() error {
+	if r.csv == nil {
+		return nil
+	}
+
+	if err := r.writeHeader(); err != nil {
+		return err
+	}
+
+	r.csv.Flush()
+
+	return r.csv.Error()
+}
@@ -0,0 +1,184 @@
+package decode
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/yaml.v3"
+)
+
+func TestStreamedLayout(t *testing.T) {
+
+	mrxFiles := []string{"../testdata/rexy_sunbathe_mrx.mxf", "./testdata/freeMXF-mxf1.mxf", "./testdata/allMdTypes.mrx", "./testdata/namespaces.mrx"}
+
+	for _, mrx := range mrxFiles {
+		options := StructureOptions{ContentPackageLimit: []int{2, 1, 2}, Preview: 8, Pretty: true, Samples: 1}
+		mrxBytes, _ := os.ReadFile(mrx)
+
+		// decode the layout into memory, to compare the streamed layout to
+		recorder := &layoutRecorder{}
+		count, countErr := packageCount(bytes.NewReader(mrxBytes))
+		memoryErr := klvStream(bytes.NewReader(mrxBytes), 10, options, recorder, newPackageLimiter(options.ContentPackageLimit, count))
+		expectedJSON, _ := json.MarshalIndent(recorder.layout, "", "    ")
+		expectedYAML, _ := yaml.Marshal(recorder.layout)
+
+		var yamlOut, pipeOut bytes.Buffer
+		yamlErr := ExtractStructure(bytes.NewReader(mrxBytes), &yamlOut, options)
+		// a stream that can not seek is buffered to count the content packages
+		pipeErr := ExtractStructure(struct{ io.Reader }{bytes.NewReader(mrxBytes)}, &pipeOut, options)
+
+		var jsonOut bytes.Buffer
+		options.JSON = true
+		jsonErr := ExtractStructure(bytes.NewReader(mrxBytes), &jsonOut, options)
+
+		Convey("Checking the layout is streamed as it is decoded", t, func() {
+			Convey(fmt.Sprintf("using %s decoded as json and yaml, with content package limits", mrx), func() {
+				Convey("the json and yaml match the layout decoded into memory", func() {
+					So(countErr, ShouldBeNil)
+					So(memoryErr, ShouldBeNil)
+					So(jsonErr, ShouldBeNil)
+					So(yamlErr, ShouldBeNil)
+					So(pipeErr, ShouldBeNil)
+					So(len(recorder.layout.Partitions), ShouldBeGreaterThan, 0)
+					So(jsonOut.String(), ShouldEqual, string(expectedJSON))
+					So(yamlOut.String(), ShouldEqual, string(expectedYAML))
+					So(pipeOut.String(), ShouldEqual, yamlOut.String())
+				})
+			})
+		})
+	}
+}
+
+// layoutRecorder decodes the whole layout into memory
+type layoutRecorder struct {
+	layout essenceLayout
+}
+
+func (lr *layoutRecorder) startPartition(head partitionHead) error {
+	lr.layout.Partitions = append(lr.layout.Partitions, container{partitionHead: head})
+	return nil
+}
+
+func (lr *layoutRecorder) contentPackage(cp contentPackage) error {
+	part := &lr.layout.Partitions[len(lr.layout.Partitions)-1]
+	part.ContentPackages = append(part.ContentPackages, cp)
+	return nil
+}
+
+func (lr *layoutRecorder) endPartition(tail partitionTail) error {
+	lr.layout.Partitions[len(lr.layout.Partitions)-1].partitionTail = tail
+	return nil
+}
+
+func (lr *layoutRecorder) end(tail layoutTail) error {
+	lr.layout.layoutTail = tail
+	return nil
+}
+
+func TestPackageLimiter(t *testing.T) {
+
+	// 10 content packages of 10 bytes, split across two partitions of 7 and 3
+	limit := func(limits []int) [][]contentPackage {
+		recorder := &layoutRecorder{}
+		var partitions [][]contentPackage
+		limiter := newPackageLimiter(limits, 10)
+		for _, count := range []int{7, 3} {
+			recorder.startPartition(partitionHead{})
+			for i := 0; i < count; i++ {
+				limiter.add(contentPackage{ContentPackageLength: 10}, recorder)
+			}
+			limiter.flush(recorder)
+			partitions = append(partitions, recorder.layout.Partitions[len(recorder.layout.Partitions)-1].ContentPackages)
+		}
+
+		return partitions
+	}
+
+	cp := contentPackage{ContentPackageLength: 10}
+	firstLast := limit([]int{2, 2})
+	middle := limit([]int{2})
+	all := limit([]int{5, 5})
+
+	Convey("Checking the content packages are limited as they are written", t, func() {
+		Convey("using the first and last, middle and every content package as the limits", func() {
+			Convey("each run of skipped packages in a partition is a single skipped package", func() {
+				So(firstLast, ShouldResemble, [][]contentPackage{{cp, cp, skip(50, 5)}, {skip(10, 1), cp, cp}})
+				So(middle, ShouldResemble, [][]contentPackage{{skip(40, 4), cp, cp, skip(10, 1)}, {skip(30, 3)}})
+				So(all, ShouldResemble, [][]contentPackage{{cp, cp, cp, cp, cp, cp, cp}, {cp, cp, cp}})
+			})
+		})
+	})
+}
+
+func TestRecordFormats(t *testing.T) {
+
+	mrxBytes, _ := os.ReadFile("./testdata/namespaces.mrx")
+
+	recorder := &layoutRecorder{}
+	layoutErr := klvStream(bytes.NewReader(mrxBytes), 10, StructureOptions{}, recorder, nil)
+
+	// the records expected from the layout
+	var expected []klvRecord
+	for i, part := range recorder.layout.Partitions {
+		for _, cp := range part.ContentPackages {
+			for _, ess := range cp.ContentPackage {
+				expected = append(expected, klvRecord{Partition: i, Stream: ess.stream, Frame: ess.frame, Key: ess.Key, Symbol: ess.Symbol,
+					FileOffset: ess.FileOffset, Length: ess.Length, TotalByteCount: ess.TotalByteCount})
+			}
+		}
+	}
+
+	var ndjsonOut, csvOut bytes.Buffer
+	ndjsonErr := ExtractStructure(bytes.NewReader(mrxBytes), &ndjsonOut, StructureOptions{Format: FormatNDJSON})
+	csvErr := ExtractStructure(bytes.NewReader(mrxBytes), &csvOut, StructureOptions{Format: FormatCSV})
+	formatErr := ExtractStructure(bytes.NewReader(mrxBytes), &bytes.Buffer{}, StructureOptions{Format: "xml"})
+	conflictErr := ExtractStructure(bytes.NewReader(mrxBytes), &bytes.Buffer{}, StructureOptions{Format: FormatCSV, JSON: true})
+
+	var ndjsonRecords []klvRecord
+	dec := json.NewDecoder(&ndjsonOut)
+	for dec.More() {
+		var record klvRecord
+		dec.Decode(&record)
+		ndjsonRecords = append(ndjsonRecords, record)
+	}
+
+	// the manifest is not part of a data stream
+	manifests := 0
+	for _, record := range expected {
+		if record.Stream == -1 && record.Frame == -1 {
+			manifests++
+		}
+	}
+
+	rows, rowErr := csv.NewReader(&csvOut).ReadAll()
+	var csvRows [][]string
+	for _, record := range expected {
+		csvRows = append(csvRows, record.row())
+	}
+
+	Convey("Checking the essence is written as flat records", t, func() {
+		Convey("using an mrx file decoded as ndjson and csv", func() {
+			Convey("there is a record for every essence KLV, with the stream and frame of the essence", func() {
+				So(layoutErr, ShouldBeNil)
+				So(ndjsonErr, ShouldBeNil)
+				So(csvErr, ShouldBeNil)
+				So(formatErr, ShouldResemble, fmt.Errorf("error unknown output format xml, the format can be yaml, json, ndjson or csv"))
+				So(conflictErr, ShouldResemble, fmt.Errorf("error the json output conflicts with the csv format, please only use the format"))
+				So(len(expected), ShouldBeGreaterThan, 0)
+				So(expected[0].Stream, ShouldEqual, 0)
+				So(expected[0].Frame, ShouldEqual, 0)
+				So(manifests, ShouldEqual, 1)
+				So(ndjsonRecords, ShouldResemble, expected)
+				So(rowErr, ShouldBeNil)
+				So(rows[0], ShouldResemble, klvRecordHeader)
+				So(rows[1:], ShouldResemble, csvRows)
+			})
+		})
+	})
+}
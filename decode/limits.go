@@ -2,117 +2,98 @@ package decode
 
 import "math"
 
-// contentPackageLimiter finds which keys need to be decoded.
-func contentPackageLimiter(allKeys []contentPackage, containers []container, contentPackageLimit []int) []container {
+// packageLimiter limits the content packages that are written as they
+// are decoded, each run of content packages in a partition that are
+// not kept is written as a single skipped content package.
+type packageLimiter struct {
+	// groups are the start and end positions of the kept content packages
+	groups   []int
+	position int
+
+	skipCount, skipLength int
+}
+
+// newPackageLimiter returns the limiter for the total count of content packages.
+// nil is returned if every content package is kept.
+func newPackageLimiter(contentPackageLimit []int, packageCount int) *packageLimiter {
 
 	total := 0
 	for _, contentPackageLength := range contentPackageLimit {
 		total += contentPackageLength
 	}
 
-	// get the total count
-	keyCount := len(allKeys)
-
-	if total < len(allKeys) {
-
-		// get the array positions here
-		groups := groupSplit(contentPackageLimit, keyCount)
+	if total >= packageCount {
+		return nil
+	}
 
-		// if empty return all the data
-		if len(groups) == 0 {
-			return containers
-		}
+	// get the array positions here
+	groups := groupSplit(contentPackageLimit, packageCount)
 
-		//	find the start and ends of every key based on their groups
-		for position := 0; position < len(groups); position += 2 {
-			start := groups[position]
-			end := groups[position+1]
-			for i := start; i < end; i++ {
-				//	fmt.Println(start, end)
-				allKeys[i].keep = true
+	// if empty keep all the data
+	if len(groups) == 0 {
+		return nil
+	}
 
-			}
+	return &packageLimiter{groups: groups}
+}
 
+// keep checks if the content package at the position is in any of the groups
+func (pl *packageLimiter) keep(position int) bool {
+	for i := 0; i+1 < len(pl.groups); i += 2 {
+		if position >= pl.groups[i] && position < pl.groups[i+1] {
+			return true
 		}
-
-	} else {
-		// return the unfiltered containers
-		return containers
 	}
 
-	// variables to mark the pseudo position within the container
-	// and how many essence packs may have been skipped
-	partition := 0
-	container := 0
-	skipcount := 0
-	skipCumlative := 0
-
-	count := 0
-	for _, key := range allKeys {
-
-		// check if the key should be kept
-		// incrementing the skip count and total counts
-		if !key.keep {
-			skipcount += key.ContentPackageLength
-			skipCumlative++
-		} else if key.keep && skipcount != 0 {
-			// if previous items have been skipped
-			// then generate a skip key
-			allKeys[count-1] = skip(skipcount, skipCumlative)
-
-			skipcount = 0
-			skipCumlative = 0
-		}
+	return false
+}
 
-		// when the container changes
-		// check if skips are in play
-		// reset positions back to 0
-		if container == len(containers[partition].ContentPackages)-1 || len(containers[partition].ContentPackages) == 0 {
+// add writes the content package if it is kept,
+// otherwise it is added to the skipped content packages.
+func (pl *packageLimiter) add(cp contentPackage, w layoutWriter) error {
 
-			if skipcount != 0 && len(containers[partition].ContentPackages) != 0 {
+	if pl == nil {
+		return w.contentPackage(cp)
+	}
 
-				allKeys[count-1] = skip(skipcount, skipCumlative)
+	position := pl.position
+	pl.position++
 
-				skipcount = 0
-				skipCumlative = 0
-			}
+	if !pl.keep(position) {
+		pl.skipCount++
+		pl.skipLength += cp.ContentPackageLength
 
-			container = 0
-			partition++
+		return nil
+	}
 
-		}
+	// if previous items have been skipped
+	// then write a skip key first
+	if err := pl.flush(w); err != nil {
+		return err
+	}
 
-		// always move the total key position along
-		// and the container withing a content package
-		count++
-		container++
+	return w.contentPackage(cp)
+}
 
-	}
+// flush writes any skipped content packages as a single
+// content package, this is called at the end of each partition.
+func (pl *packageLimiter) flush(w layoutWriter) error {
 
-	i := 0
-	for partition, container := range containers {
-		// generate a new content package for each content package
-		// based on the skiping method
-		var newContentPackages []contentPackage
-		for range container.ContentPackages {
-			if allKeys[i].keep {
-
-				newContentPackages = append(newContentPackages, allKeys[i])
-			}
-			i++
-		}
-		// fmt.Println(newContentPackages)
-		containers[partition].ContentPackages = newContentPackages
+	if pl == nil || pl.skipCount == 0 {
+		return nil
 	}
 
-	return containers
+	skipped := skip(pl.skipLength, pl.skipCount)
+	pl.skipCount, pl.skipLength = 0, 0
 
+	return w.contentPackage(skipped)
 }
 
 // skip generates the skip information of a content package
 func skip(count, skipCumlative int) contentPackage {
 	return contentPackage{ContentPackageLength: count,
-		ContentPackage: []keyLength{{Key: "00000000.00000000.00000000.00000000", Description: "A collection of skipped content packages", TotalByteCount: count, TotalContainerCount: skipCumlative}}, keep: true}
+		ContentPackage: []keyLength{{Key: "00000000.00000000.00000000.00000000", Description: "A collection of skipped content packages", TotalByteCount: count, TotalContainerCount: skipCumlative,
+			stream: -1, frame: -1}}}
 }
 
 func groupSplit(contentPackageLimit []int, keyCount int) []int {
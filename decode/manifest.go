@@ -0,0 +1,69 @@
+package decode
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/metarex-media/mrx-tool/klv"
+	"golang.org/x/sync/errgroup"
+)
+
+// ExtractManifest returns the roundtrip json bytes (configuration and manifest)
+// embedded in an MRX file. The rest of the file is read but not kept,
+// so the whole file is not held in memory.
+func ExtractManifest(mrxStream io.Reader) ([]byte, error) {
+
+	manifestBytes, err := lastManifest(mrxStream)
+	if err != nil {
+		return nil, err
+	}
+
+	if manifestBytes == nil {
+		return nil, fmt.Errorf("no manifest found in the mrx file")
+	}
+
+	return manifestBytes, nil
+}
+
+// lastManifest returns the bytes of the last manifest in
+// the mrx file, nil is returned if there is no manifest.
+func lastManifest(mrxStream io.Reader) ([]byte, error) {
+
+	buffer := make(chan *klv.KLV, 1000)
+	var manifestBytes []byte
+
+	// use errs to handle errors while runnig concurrently
+	errs, _ := errgroup.WithContext(context.Background())
+
+	// initiate the klv stream
+	errs.Go(func() error {
+		return klv.StartKLVStream(mrxStream, buffer, 10)
+	})
+
+	errs.Go(func() error {
+
+		// clean out the channel at the end
+		// this is to prevent channel deadlocks further down the chain
+		defer func() {
+			_, klvOpen := <-buffer
+			for klvOpen {
+				_, klvOpen = <-buffer
+			}
+		}()
+
+		for klvItem := range buffer {
+			// the manifest is the last one so keep going
+			// in case of multiple manifests
+			if essLabeller(klvItem.Key) == "manifest" {
+				manifestBytes = klvItem.Value
+			}
+		}
+
+		return nil
+	})
+
+	err := errs.Wait()
+
+	return manifestBytes, err
+}
@@ -0,0 +1,179 @@
+package decode
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/metarex-media/mrx-tool/klv"
+	"github.com/metarex-media/mrx-tool/mrxUnitTest"
+	mxf2go "github.com/metarex-media/mxf-to-go"
+)
+
+// instanceIDKey is the key of the InstanceID field of a header metadata group
+const instanceIDKey = "060e2b34.01010101.01011502.00000000"
+
+// metadataGroup is a decoded header metadata group, with
+// the groups it strongly references as its children.
+type metadataGroup struct {
+	Group      string           `yaml:"Group" json:"Group"`
+	UL         string           `yaml:"UL" json:"UL"`
+	InstanceID string           `yaml:"InstanceID,omitempty" json:"InstanceID,omitempty"`
+	Properties map[string]any   `yaml:"Properties,omitempty" json:"Properties,omitempty"`
+	Children   []*metadataGroup `yaml:"Children,omitempty" json:"Children,omitempty"`
+
+	// the ids of the strongly referenced groups
+	refs []string
+}
+
+// decodeGroup decodes a header metadata group KLV, using the
+// primer to find the full ULs of the local tags.
+// Any unknown fields are not decoded and are skipped.
+func decodeGroup(group *klv.KLV, primer map[string]string) *metadataGroup {
+
+	mdGroup := &metadataGroup{UL: fullName(group.Key)}
+
+	name, fields, err := mrxUnitTest.DecodeGroupFields(group, primer)
+	if err != nil {
+		return mdGroup
+	}
+
+	mdGroup.Group = name
+	mdGroup.Properties = make(map[string]any)
+	for _, field := range fields {
+		switch {
+		case field.Key == instanceIDKey:
+			id, err := mxf2go.DecodeTUUID(field.Raw)
+			if err == nil {
+				mdGroup.InstanceID = referenceID(id)
+			}
+		case field.Value != nil:
+			// references are written as ids, so the
+			// referenced instance ID can be found
+			refs, isRef := strongReferences(field.Value)
+			switch {
+			case isRef && isReferenceArray(field.Value):
+				mdGroup.Properties[field.Name] = refs
+			case isRef && len(refs) == 1:
+				mdGroup.Properties[field.Name] = refs[0]
+			default:
+				mdGroup.Properties[field.Name] = field.Value
+			}
+			mdGroup.refs = append(mdGroup.refs, refs...)
+		}
+	}
+
+	if len(mdGroup.Properties) == 0 {
+		mdGroup.Properties = nil
+	}
+
+	return mdGroup
+}
+
+// strongReferences returns the ids of all the strong references in a field,
+// false is returned if the field is not a strong reference.
+func strongReferences(field any) ([]string, bool) {
+
+	if field == nil {
+		return nil, false
+	}
+
+	if ref, ok := field.(mxf2go.TStrongReference); ok {
+		return []string{referenceID(ref)}, true
+	}
+
+	if !strings.Contains(reflect.TypeOf(field).Name(), "StrongReference") {
+		return nil, false
+	}
+
+	// sets and vectors are arrays of references
+	if isReferenceArray(field) {
+		arr := reflect.ValueOf(field)
+		refs := make([]string, 0, arr.Len())
+		for i := 0; i < arr.Len(); i++ {
+			refs = append(refs, referenceID(arr.Index(i).Interface()))
+		}
+
+		return refs, true
+	}
+
+	return []string{referenceID(field)}, true
+}
+
+// isReferenceArray checks if the field is a set or vector of references
+func isReferenceArray(field any) bool {
+	name := reflect.TypeOf(field).Name()
+	return strings.HasSuffix(name, "Set") || strings.HasSuffix(name, "Vector")
+}
+
+// referenceID gives all the references and instance IDs
+// the same format, so they can be matched to each other.
+func referenceID(ref any) string {
+	arr := reflect.ValueOf(ref)
+	if arr.Kind() != reflect.Array && arr.Kind() != reflect.Slice {
+		return ""
+	}
+
+	id := make([]byte, arr.Len())
+	for i := range id {
+		id[i] = uint8(arr.Index(i).Uint())
+	}
+
+	return fullName(id)
+}
+
+// metadataTree links the groups to the groups they strongly reference.
+// The roots of the tree are the groups without any strong references
+// to them, which is the preface for a valid file.
+func metadataTree(groups []*metadataGroup) []*metadataGroup {
+
+	ids := make(map[string]*metadataGroup)
+	referenced := make(map[*metadataGroup]bool)
+	for _, group := range groups {
+		if group.InstanceID != "" {
+			ids[group.InstanceID] = group
+		}
+	}
+
+	for _, group := range groups {
+		for _, ref := range group.refs {
+			if child, ok := ids[ref]; ok {
+				referenced[child] = true
+			}
+		}
+	}
+
+	// each group is only added to the tree once, so
+	// any groups that reference each other are not looped
+	added := make(map[*metadataGroup]bool)
+	var link func(group *metadataGroup)
+	link = func(group *metadataGroup) {
+		added[group] = true
+		for _, ref := range group.refs {
+			child, ok := ids[ref]
+			if !ok || added[child] {
+				continue
+			}
+
+			group.Children = append(group.Children, child)
+			link(child)
+		}
+	}
+
+	var roots []*metadataGroup
+	for _, group := range groups {
+		if !referenced[group] {
+			roots = append(roots, group)
+			link(group)
+		}
+	}
+
+	// groups in a reference loop have no root
+	for _, group := range groups {
+		if !added[group] {
+			roots = append(roots, group)
+			link(group)
+		}
+	}
+
+	return roots
+}
@@ -0,0 +1,166 @@
+package decode
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"unicode/utf8"
+)
+
+// payloadSample is a preview of a single
+// frame of a data stream
+type payloadSample struct {
+	Frame      int    `yaml:"Frame" json:"Frame"`
+	FileOffset int    `yaml:"FileOffset" json:"FileOffset"`
+	Preview    string `yaml:"Preview,omitempty" json:"Preview,omitempty"`
+	Payload    string `yaml:"Payload,omitempty" json:"Payload,omitempty"`
+}
+
+// textEssence checks if the essence is text, from its essence label
+func textEssence(essLabel string) bool {
+	return essLabel == "TC" || essLabel == "TE" || essLabel == "manifest"
+}
+
+// payloadPreview gives the first n bytes of a payload, as UTF-8 for
+// text or hex for binary. Text that is not valid UTF-8 is given as hex.
+func payloadPreview(data []byte, n int, text bool) string {
+
+	preview, truncated := data, false
+	if len(data) > n {
+		preview, truncated = data[:n], true
+	}
+
+	if text {
+		// don't split the last character
+		for i := 0; i < utf8.UTFMax-1 && truncated && len(preview) > 0 && !utf8.Valid(preview); i++ {
+			preview = preview[:len(preview)-1]
+		}
+
+		if !utf8.Valid(preview) {
+			text = false
+		}
+	}
+
+	out := string(preview)
+	if !text {
+		out = hex.EncodeToString(preview)
+	}
+
+	if truncated {
+		out += "..."
+	}
+
+	return out
+}
+
+// prettyPayload returns the pretty printed payload for JSON or XML text.
+// An empty string is returned if the payload is neither.
+func prettyPayload(data []byte) string {
+
+	var out bytes.Buffer
+	if json.Valid(data) {
+		if json.Indent(&out, data, "", "    ") != nil {
+			return ""
+		}
+
+		return out.String()
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+		return ""
+	}
+
+	// use the raw tokens so the namespace prefixes are kept
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	enc := xml.NewEncoder(&out)
+	enc.Indent("", "    ")
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return ""
+		}
+
+		switch raw := tok.(type) {
+		case xml.CharData:
+			// the whitespace is replaced by the indentation
+			raw = bytes.TrimSpace(raw)
+			if len(raw) == 0 {
+				continue
+			}
+			tok = raw
+		case xml.StartElement:
+			raw.Name = prefixedName(raw.Name)
+			for i, attr := range raw.Attr {
+				raw.Attr[i].Name = prefixedName(attr.Name)
+			}
+			tok = raw
+		case xml.EndElement:
+			raw.Name = prefixedName(raw.Name)
+			tok = raw
+		}
+
+		if enc.EncodeToken(tok) != nil {
+			return ""
+		}
+
+		// the encoder does not indent after the xml declaration
+		if _, ok := tok.(xml.ProcInst); ok {
+			if enc.Flush() != nil {
+				return ""
+			}
+			out.WriteByte('\n')
+		}
+	}
+
+	if enc.Flush() != nil {
+		return ""
+	}
+
+	return out.String()
+}
+
+// prefixedName keeps the prefix as part of the name, so the
+// xml encoder does not generate its own namespaces
+func prefixedName(name xml.Name) xml.Name {
+	if name.Space == "" {
+		return name
+	}
+
+	return xml.Name{Local: name.Space + ":" + name.Local}
+}
+
+// sample generates the sample of a frame, with the
+// preview and pretty payload if they are used.
+func (md *mrxDecoder) sample(data []byte, essLabel string) (preview, payload string) {
+
+	if md.options.Preview > 0 {
+		preview = payloadPreview(data, md.options.Preview, textEssence(essLabel))
+	}
+
+	if md.options.Pretty && textEssence(essLabel) {
+		payload = prettyPayload(data)
+	}
+
+	return preview, payload
+}
+
+// addSample keeps the first and last frames of a
+// data stream, as samples of the stream.
+func (s *streamSummary) addSample(sample payloadSample, count int) {
+
+	if len(s.Samples) < count {
+		s.Samples = append(s.Samples, sample)
+		return
+	}
+
+	s.lastSamples = append(s.lastSamples, sample)
+	if len(s.lastSamples) > count {
+		s.lastSamples = s.lastSamples[1:]
+	}
+}
@@ -0,0 +1,70 @@
+package decode
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPayloadPreview(t *testing.T) {
+
+	// the 11th byte is half of the ü
+	text := payloadPreview([]byte(`{"name": "ünïcode"}`), 11, true)
+	short := payloadPreview([]byte(`{"a": 1}`), 13, true)
+	binary := payloadPreview([]byte{0, 1, 0xfe, 0xff}, 3, false)
+	invalid := payloadPreview([]byte{0xff, 0xfe, 'a'}, 10, true)
+
+	Convey("Checking the payload previews are bounded and readable", t, func() {
+		Convey("using text, binary and text that is not UTF-8", func() {
+			Convey("text is cut without splitting a character and everything else is hex", func() {
+				So(text, ShouldEqual, `{"name": "...`)
+				So(short, ShouldEqual, `{"a": 1}`)
+				So(binary, ShouldEqual, "0001fe...")
+				So(invalid, ShouldEqual, "fffe61")
+			})
+		})
+	})
+}
+
+func TestPrettyPayload(t *testing.T) {
+
+	jsonPretty := prettyPayload([]byte(`{"a":{"b":1}}`))
+	xmlPretty := prettyPayload([]byte(`<?xml version="1.0"?><gps:pos xmlns:gps="urn:gps"><gps:lat>51.5</gps:lat></gps:pos>`))
+	notPretty := prettyPayload([]byte(`latitude: 51.5`))
+
+	Convey("Checking text payloads are pretty printed", t, func() {
+		Convey("using json, xml and yaml payloads", func() {
+			Convey("the json and xml are indented, keeping the namespace prefixes, and the yaml is not printed", func() {
+				So(jsonPretty, ShouldEqual, "{\n    \"a\": {\n        \"b\": 1\n    }\n}")
+				So(xmlPretty, ShouldEqual, "<?xml version=\"1.0\"?>\n<gps:pos xmlns:gps=\"urn:gps\">\n    <gps:lat>51.5</gps:lat>\n</gps:pos>")
+				So(notPretty, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestStreamSamples(t *testing.T) {
+
+	var resultsBuffer bytes.Buffer
+	streamer, _ := os.Open("./testdata/namespaces.mrx")
+	genErr := ExtractStructure(streamer, &resultsBuffer, StructureOptions{JSON: true, Preview: 12, Samples: 1})
+	var layout essenceLayout
+	jsonErr := json.Unmarshal(resultsBuffer.Bytes(), &layout)
+
+	Convey("Checking the first and last frames of each data stream are sampled", t, func() {
+		Convey("using an mrx file with a clocked stream of three frames", func() {
+			Convey("only the first and last frames are sampled, with the payload previews", func() {
+				So(genErr, ShouldBeNil)
+				So(jsonErr, ShouldBeNil)
+				So(layout.DataStreams[0].Samples, ShouldResemble, []payloadSample{
+					{Frame: 0, FileOffset: 3648, Preview: `{"latitude":...`},
+					{Frame: 2, FileOffset: 3760, Preview: `{"latitude":...`},
+				})
+				So(layout.Partitions[1].ContentPackages[0].ContentPackage[0].Preview, ShouldEqual, `{"latitude":...`)
+			})
+		})
+	})
+}
@@ -0,0 +1,245 @@
+package decode
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/metarex-media/mrx-tool/manifest"
+)
+
+// the sidecar options of the extracted essence
+const (
+	// SidecarFile writes a sidecar next to every extracted file
+	SidecarFile = "file"
+	// SidecarIndex writes a single index file for every data stream
+	SidecarIndex = "index"
+)
+
+// essenceSidecar is the record of where an extracted payload came from
+type essenceSidecar struct {
+	File        string `json:"File"`
+	Stream      int    `json:"Stream"`
+	EssenceType string `json:"EssenceType"`
+	Key         string `json:"Key"`
+	BodySID     int    `json:"BodySID"`
+	Frame       int    `json:"Frame"`
+	Timecode    string `json:"Timecode"`
+	// FileOffset is the offset of the KLV in the mrx file
+	FileOffset int    `json:"FileOffset"`
+	Length     int    `json:"Length"`
+	Hash       string `json:"Hash"`
+	// EssenceProperties are the properties of
+	// the frame in the manifest, if there are any
+	EssenceProperties *manifest.EssenceProperties `json:"EssenceProperties,omitempty"`
+}
+
+// namingPlaceholder finds the placeholders in a naming template
+var namingPlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// namingTemplate names the extracted files, by replacing the placeholders
+// of {stream}, {type}, {frame}, {timecode} and {ext} for each frame.
+type namingTemplate struct {
+	template     string
+	leadingZeros int
+}
+
+// newNamingTemplate checks the naming template, the default template
+// is the folder layout, or the flat layout if flat is used.
+func newNamingTemplate(template string, flat bool, leadingZeros int) (*namingTemplate, error) {
+
+	switch {
+	case template != "":
+	case flat:
+		template = "{stream}Stream{type}{frame}d"
+	default:
+		template = "{stream}Stream{type}/{frame}d"
+	}
+
+	for _, placeholder := range namingPlaceholder.FindAllString(template, -1) {
+		switch placeholder {
+		case "{stream}", "{type}", "{frame}", "{timecode}", "{ext}":
+		default:
+			return nil, fmt.Errorf("error unknown placeholder %v in the naming template %v", placeholder, template)
+		}
+	}
+
+	if !strings.Contains(template, "{frame}") && !strings.Contains(template, "{timecode}") {
+		return nil, fmt.Errorf("error the naming template %v needs a {frame} or {timecode}, so every file has its own name", template)
+	}
+
+	// the files can only be saved within the parent folder
+	if !filepath.IsLocal(filepath.FromSlash(namingPlaceholder.ReplaceAllString(template, "x"))) {
+		return nil, fmt.Errorf("error the naming template %v is not within the output folder", template)
+	}
+
+	return &namingTemplate{template: template, leadingZeros: leadingZeros}, nil
+}
+
+// uses checks if the template uses a placeholder
+func (n *namingTemplate) uses(placeholder string) bool {
+	return strings.Contains(n.template, placeholder)
+}
+
+// name returns the slash separated name of a frame, relative to the parent folder
+func (n *namingTemplate) name(stream int, essLabel string, frame int, timecode, ext string) string {
+	replacer := strings.NewReplacer("{stream}", fmt.Sprintf("%04d", stream), "{type}", essLabel,
+		"{frame}", leadingZero(frame, n.leadingZeros), "{timecode}", strings.ReplaceAll(timecode, ":", "-"), "{ext}", ext)
+
+	return replacer.Replace(n.template)
+}
+
+// contentExtensions are the file extensions of common content types
+var contentExtensions = map[string]string{
+	"application/json": ".json", "text/json": ".json",
+	"application/xml": ".xml", "text/xml": ".xml",
+	"text/plain": ".txt", "text/csv": ".csv",
+	"application/yaml": ".yaml", "application/octet-stream": ".bin",
+}
+
+// extension returns the file extension of a data stream from its content type.
+// If there is no content type, text payloads are checked for JSON or XML.
+func extension(contentType, essLabel string, data []byte) string {
+
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if ext, ok := contentExtensions[mediaType]; ok {
+			return ext
+		}
+
+		switch {
+		case strings.HasSuffix(mediaType, "+json"):
+			return ".json"
+		case strings.HasSuffix(mediaType, "+xml"):
+			return ".xml"
+		}
+
+		if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			return exts[0]
+		}
+	}
+
+	switch {
+	case !textEssence(essLabel):
+		return ".bin"
+	case json.Valid(data):
+		return ".json"
+	case bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")):
+		return ".xml"
+	default:
+		return ".txt"
+	}
+}
+
+// sidecarIndex is the index file of the sidecars of a data stream
+type sidecarIndex struct {
+	name  string
+	file  *os.File
+	count int
+}
+
+// writeSidecar writes the sidecar of an extracted file, as its own
+// file or as part of the index of the data stream.
+func (e *mrxPartitionPosition) writeSidecar(sidecar essenceSidecar) error {
+
+	if e.sidecar == SidecarFile {
+		sidecarBytes, err := json.MarshalIndent(sidecar, "", "    ")
+		if err != nil {
+			return err
+		}
+
+		return e.sink.writeFile(sidecar.File+".meta.json", sidecarBytes)
+	}
+
+	index, ok := e.indexes[sidecar.Stream]
+	if !ok {
+		name := fmt.Sprintf("%04dStream%s.index.json", sidecar.Stream, sidecar.EssenceType)
+		file, err := e.sink.indexFile(name)
+		if err != nil {
+			return fmt.Errorf("error generating the sidecar index: %v", err)
+		}
+
+		index = &sidecarIndex{name: name, file: file}
+		e.indexes[sidecar.Stream] = index
+	}
+
+	sidecarBytes, err := json.MarshalIndent(sidecar, "    ", "    ")
+	if err != nil {
+		return err
+	}
+
+	start := ",\n    "
+	if index.count == 0 {
+		start = "[\n    "
+	}
+	index.count++
+
+	if _, err := index.file.WriteString(start); err != nil {
+		return err
+	}
+
+	_, err = index.file.Write(sidecarBytes)
+
+	return err
+}
+
+// closeIndexes finishes every sidecar index file
+func (e *mrxPartitionPosition) closeIndexes() error {
+
+	// the indexes are saved in the order of the streams
+	var indexErr error
+	for _, stream := range orderedStreams(e.indexes) {
+		index := e.indexes[stream]
+		_, err := index.file.WriteString("\n]\n")
+		if saveErr := e.sink.saveIndex(index.name, index.file); err == nil {
+			err = saveErr
+		}
+
+		if err != nil && indexErr == nil {
+			indexErr = fmt.Errorf("error writing the sidecar index: %v", err)
+		}
+	}
+
+	return indexErr
+}
+
+// orderedStreams returns the streams of the indexes in order
+func orderedStreams(indexes map[int]*sidecarIndex) []int {
+	streams := make([]int, 0, len(indexes))
+	for stream := range indexes {
+		streams = append(streams, stream)
+	}
+	sort.Ints(streams)
+
+	return streams
+}
+
+// essenceProperties returns the manifest properties of a frame of a data stream
+func (e *mrxPartitionPosition) essenceProperties(stream, frame int) *manifest.EssenceProperties {
+
+	if e.round == nil || stream >= len(e.round.Manifest.DataStreams) {
+		return nil
+	}
+
+	essence := e.round.Manifest.DataStreams[stream].Essence
+	if frame >= len(essence) {
+		return nil
+	}
+
+	return &essence[frame]
+}
+
+// contentType returns the content type of a data stream from the manifest
+func (e *mrxPartitionPosition) contentType(stream int) string {
+
+	if e.round == nil || stream >= len(e.round.Manifest.DataStreams) {
+		return ""
+	}
+
+	return e.round.Manifest.DataStreams[stream].Common.StreamContentType
+}
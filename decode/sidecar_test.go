@@ -0,0 +1,165 @@
+package decode
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/metarex-media/mrx-tool/manifest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNamingTemplate(t *testing.T) {
+
+	folder, folderErr := newNamingTemplate("", false, 4)
+	flat, flatErr := newNamingTemplate("", true, 2)
+	custom, customErr := newNamingTemplate("{type}/{stream}/{timecode}{ext}", false, 0)
+
+	_, placeholderErr := newNamingTemplate("{stream}/{name}", false, 0)
+	_, uniqueErr := newNamingTemplate("{stream}{ext}", false, 0)
+	_, outsideErr := newNamingTemplate("../{frame}", false, 0)
+
+	Convey("Checking the naming templates of the extracted files", t, func() {
+		Convey("using the default folder and flat templates, and a template with a timecode and extension", func() {
+			Convey("the files are named with the placeholders of each frame", func() {
+				So(folderErr, ShouldBeNil)
+				So(filepath.ToSlash(folder.name(1, "TC", 12, "00:00:00:12", ".json")), ShouldEqual, "0001StreamTC/0012d")
+				So(flatErr, ShouldBeNil)
+				So(flat.name(1, "BC", 3, "00:00:00:03", ".bin"), ShouldEqual, "0001StreamBC03d")
+				So(customErr, ShouldBeNil)
+				So(filepath.ToSlash(custom.name(2, "TE", 30, manifest.FormatTimecode(30, 25), ".xml")), ShouldEqual, "TE/0002/00-00-01-05.xml")
+				So(custom.uses("{ext}"), ShouldBeTrue)
+				So(folder.uses("{timecode}"), ShouldBeFalse)
+			})
+		})
+		Convey("using unknown placeholders, no frame placeholders and paths outside the output folder", func() {
+			Convey("an error is returned for each template", func() {
+				So(placeholderErr, ShouldResemble, fmt.Errorf("error unknown placeholder {name} in the naming template {stream}/{name}"))
+				So(uniqueErr, ShouldResemble, fmt.Errorf("error the naming template {stream}{ext} needs a {frame} or {timecode}, so every file has its own name"))
+				So(outsideErr, ShouldResemble, fmt.Errorf("error the naming template ../{frame} is not within the output folder"))
+			})
+		})
+	})
+
+	Convey("Checking the file extensions of the data streams", t, func() {
+		Convey("using content types, and text and binary payloads without a content type", func() {
+			Convey("the extension is found from the content type, then the payload", func() {
+				So(extension("application/json; charset=utf-8", "TC", nil), ShouldEqual, ".json")
+				So(extension("application/ld+json", "TC", nil), ShouldEqual, ".json")
+				So(extension("text/xml", "TE", nil), ShouldEqual, ".xml")
+				So(extension("image/png", "BC", nil), ShouldEqual, ".png")
+				So(extension("", "TC", []byte(`{"lat": 1}`)), ShouldEqual, ".json")
+				So(extension("", "TE", []byte(" <root/>")), ShouldEqual, ".xml")
+				So(extension("", "TC", []byte("a line of text")), ShouldEqual, ".txt")
+				So(extension("", "BC", []byte(`{"lat": 1}`)), ShouldEqual, ".bin")
+			})
+		})
+	})
+}
+
+func TestSidecars(t *testing.T) {
+
+	mrxBytes, _ := os.ReadFile("./testdata/namespaces.mrx")
+
+	// the records of the essence, to check the sidecars against
+	recorder := &layoutRecorder{}
+	klvStream(bytes.NewReader(mrxBytes), 10, StructureOptions{}, recorder, nil)
+	offsets := make(map[[2]int]int)
+	for _, part := range recorder.layout.Partitions {
+		for _, cp := range part.ContentPackages {
+			for _, ess := range cp.ContentPackage {
+				offsets[[2]int{ess.stream, ess.frame}] = ess.FileOffset
+			}
+		}
+	}
+
+	fileOut := t.TempDir()
+	fileErr := ExtractEssence(bytes.NewReader(mrxBytes), fileOut, ExtractOptions{LeadingZeros: 4, Sidecar: SidecarFile, Template: "{type}/{frame}{ext}"})
+	var fileSidecar essenceSidecar
+	fileBytes, _ := os.ReadFile(filepath.Join(fileOut, "TC", "0001.json.meta.json"))
+	fileJSONErr := json.Unmarshal(fileBytes, &fileSidecar)
+	payload, _ := os.ReadFile(filepath.Join(fileOut, "TC", "0001.json"))
+
+	indexOut := t.TempDir()
+	indexErr := ExtractEssence(bytes.NewReader(mrxBytes), indexOut, ExtractOptions{LeadingZeros: 4, Sidecar: SidecarIndex, Frames: "1-"})
+	var index []essenceSidecar
+	indexBytes, _ := os.ReadFile(filepath.Join(indexOut, "0000StreamTC.index.json"))
+	indexJSONErr := json.Unmarshal(indexBytes, &index)
+	// the TE stream has no frames after the first, so has no index
+	_, noIndexErr := os.Stat(filepath.Join(indexOut, "0001StreamTE.index.json"))
+
+	sidecarErr := ExtractEssence(bytes.NewReader(mrxBytes), t.TempDir(), ExtractOptions{Sidecar: "yaml"})
+
+	// the same file with a start timecode of 01:00:00:00
+	startBytes, _ := os.ReadFile("./testdata/starttimecode.mrx")
+	startOut := t.TempDir()
+	startErr := ExtractEssence(bytes.NewReader(startBytes), startOut, ExtractOptions{Sidecar: SidecarFile, Template: "{type}/{timecode}{ext}", Frames: "01:00:00:01-", Streams: []string{"TC"}})
+	var startSidecar essenceSidecar
+	startSidecarBytes, _ := os.ReadFile(filepath.Join(startOut, "TC", "01-00-00-01.json.meta.json"))
+	startJSONErr := json.Unmarshal(startSidecarBytes, &startSidecar)
+	_, firstErr := os.Stat(filepath.Join(startOut, "TC", "01-00-00-00.json"))
+	beforeErr := ExtractEssence(bytes.NewReader(startBytes), t.TempDir(), ExtractOptions{Frames: "00:00:00:01-"})
+
+	// a 25 fps and 50 fps stream with a start timecode of 01:00:00:10
+	mixedOut := t.TempDir()
+	mixed, _ := os.Open("./testdata/mixedrate.mrx")
+	mixedErr := ExtractEssence(mixed, mixedOut, ExtractOptions{Template: "{stream}/{timecode}"})
+	mixed.Close()
+	_, baseErr := os.Stat(filepath.Join(mixedOut, "0000", "01-00-00-10"))
+	_, fastErr := os.Stat(filepath.Join(mixedOut, "0001", "01-00-00-20"))
+
+	Convey("Checking the sidecars of the extracted files", t, func() {
+		Convey("using a sidecar for each file, with a naming template", func() {
+			Convey("the sidecar has the position, hash and manifest properties of the file", func() {
+				So(fileErr, ShouldBeNil)
+				So(fileJSONErr, ShouldBeNil)
+				So(fileSidecar.File, ShouldEqual, "TC/0001.json")
+				So(fileSidecar.EssenceType, ShouldEqual, "TC")
+				So(fileSidecar.Frame, ShouldEqual, 1)
+				So(fileSidecar.Timecode, ShouldEqual, "00:00:00:01")
+				So(fileSidecar.BodySID, ShouldEqual, 1)
+				So(fileSidecar.FileOffset, ShouldEqual, offsets[[2]int{0, 1}])
+				So(fileSidecar.Length, ShouldEqual, len(payload))
+				So(fileSidecar.EssenceProperties, ShouldNotBeNil)
+				So(fileSidecar.Hash, ShouldEqual, fileSidecar.EssenceProperties.Hash)
+			})
+		})
+		Convey("using an index for each stream, with a frame range", func() {
+			Convey("only the streams with extracted frames have an index, of every extracted frame", func() {
+				So(indexErr, ShouldBeNil)
+				So(indexJSONErr, ShouldBeNil)
+				So(len(index), ShouldEqual, 2)
+				So(index[0].File, ShouldEqual, "0000StreamTC/0001d")
+				So(index[1].Frame, ShouldEqual, 2)
+				So(index[1].FileOffset, ShouldEqual, offsets[[2]int{0, 2}])
+				So(os.IsNotExist(noIndexErr), ShouldBeTrue)
+			})
+		})
+		Convey("using a file with a start timecode, with a timecode range and naming template", func() {
+			Convey("the timecodes follow on from the start timecode, with an error for timecodes before it", func() {
+				So(startErr, ShouldBeNil)
+				So(startJSONErr, ShouldBeNil)
+				So(startSidecar.File, ShouldEqual, "TC/01-00-00-01.json")
+				So(startSidecar.Frame, ShouldEqual, 1)
+				So(startSidecar.Timecode, ShouldEqual, "01:00:00:01")
+				So(os.IsNotExist(firstErr), ShouldBeTrue)
+				So(beforeErr, ShouldResemble, fmt.Errorf("error the timecode 00:00:00:01 is before the start timecode 01:00:00:00 of the file"))
+			})
+		})
+		Convey("using a file with a start timecode, with streams of different frame rates", func() {
+			Convey("each stream starts at the start timecode, at its own frame rate", func() {
+				So(mixedErr, ShouldBeNil)
+				So(baseErr, ShouldBeNil)
+				So(fastErr, ShouldBeNil)
+			})
+		})
+		Convey("using an unknown sidecar", func() {
+			Convey("an error is returned", func() {
+				So(sidecarErr, ShouldResemble, fmt.Errorf("error unknown sidecar yaml, the sidecar can be file or index"))
+			})
+		})
+	})
+}
@@ -0,0 +1,103 @@
+package decode
+
+import "fmt"
+
+// partitionLocation is a partition and the
+// byte offset it was found at in the file
+type partitionLocation struct {
+	offset int
+	pack   mxfPartition
+}
+
+// offsetWarning is a warning for the data at a byte offset of the file
+func offsetWarning(offset int, format string, a ...any) warning {
+	return warning{Message: fmt.Sprintf(format, a...), Offset: &offset}
+}
+
+// pointerCheck checks the this and previous partition pointers
+// of a partition pack, against where the partitions were found.
+func (md *mrxDecoder) pointerCheck(pack mxfPartition) {
+
+	offset := md.globalPosition
+	previous := 0
+	if len(md.locations) > 0 {
+		previous = md.locations[len(md.locations)-1].offset
+	}
+
+	if pack.ThisPartition != uint64(offset) {
+		md.warnings = append(md.warnings, offsetWarning(offset, "the %v partition has a ThisPartition of %v, but was found at byte %v",
+			pack.PartitionType, pack.ThisPartition, offset))
+	}
+
+	if pack.PreviousPartition != uint64(previous) {
+		md.warnings = append(md.warnings, offsetWarning(offset, "the %v partition has a PreviousPartition of %v, but the previous partition is at byte %v",
+			pack.PartitionType, pack.PreviousPartition, previous))
+	}
+
+	md.locations = append(md.locations, partitionLocation{offset: offset, pack: pack})
+}
+
+// unknownCheck warns the first time a key that
+// is not in the register is found in a body partition.
+func (md *mrxDecoder) unknownCheck(key []byte, known bool) {
+
+	partitionType := md.partitionType
+	if known || (partitionType != "body" && partitionType != genericStreamPartition) {
+		return
+	}
+
+	md.warnings = append(md.warnings, offsetWarning(md.globalPosition, "the unknown key %v was found in a %v partition",
+		fullName(key), partitionType))
+}
+
+// structureCheck checks the partitions against the footer partition
+// and the random index pack, once the whole file has been read.
+func (md *mrxDecoder) structureCheck() {
+
+	footer := -1
+	for _, loc := range md.locations {
+		if loc.pack.PartitionType == "footer" {
+			footer = loc.offset
+		}
+	}
+
+	if footer == -1 {
+		md.warnings = append(md.warnings, offsetWarning(md.globalPosition, "no footer partition was found"))
+	} else {
+		for _, loc := range md.locations {
+			// open partitions may not know where the footer is
+			if loc.pack.FooterPartition != 0 && loc.pack.FooterPartition != uint64(footer) {
+				md.warnings = append(md.warnings, offsetWarning(loc.offset, "the %v partition has a FooterPartition of %v, but the footer partition is at byte %v",
+					loc.pack.PartitionType, loc.pack.FooterPartition, footer))
+			}
+		}
+	}
+
+	if md.rip == nil {
+		md.warnings = append(md.warnings, offsetWarning(md.globalPosition, "no random index pack was found"))
+		return
+	}
+
+	for i := 0; i < len(md.rip.Partitions) || i < len(md.locations); i++ {
+		switch {
+		case i >= len(md.rip.Partitions):
+			loc := md.locations[i]
+			md.warnings = append(md.warnings, offsetWarning(loc.offset, "the %v partition at byte %v is not in the random index pack",
+				loc.pack.PartitionType, loc.offset))
+		case i >= len(md.locations):
+			rip := md.rip.Partitions[i]
+			md.warnings = append(md.warnings, offsetWarning(md.ripOffset, "the random index pack has a partition at byte %v with BodySID %v, that was not found",
+				rip.ByteOffset, rip.BodySID))
+		default:
+			rip, loc := md.rip.Partitions[i], md.locations[i]
+			if rip.ByteOffset != uint64(loc.offset) || rip.BodySID != loc.pack.BodySID {
+				md.warnings = append(md.warnings, offsetWarning(md.ripOffset, "the random index pack has a partition at byte %v with BodySID %v, but the partition found is at byte %v with BodySID %v",
+					rip.ByteOffset, rip.BodySID, loc.offset, loc.pack.BodySID))
+			}
+		}
+	}
+
+	if int(md.rip.Length) != md.ripLength {
+		md.warnings = append(md.warnings, offsetWarning(md.ripOffset, "the random index pack has a length of %v, but is %v bytes", md.rip.Length, md.ripLength))
+	}
+}
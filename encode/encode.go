@@ -43,6 +43,36 @@ type Encoder interface {
 	GetRoundTrip() (*manifest.RoundTrip, error)
 }
 
+// The PayloadValidator interface checks the text payloads of a stream
+// against the schema promised by the namespace of the stream.
+type PayloadValidator interface {
+
+	// ValidatePayload returns an error for every part of the payload
+	// that does not match the schema of the namespace. The final error
+	// is for when the payload could not be checked e.g. the schema is
+	// unreadable.
+	ValidatePayload(payload []byte, stream, frame int, nameSpace string) ([]error, error)
+}
+
+// PayloadError is returned when payloads do not match their schemas.
+type PayloadError struct {
+	Errors []error
+}
+
+func (p *PayloadError) Error() string {
+	errString := fmt.Sprintf("%v payload errors were found against the namespace schemas:", len(p.Errors))
+	for _, err := range p.Errors {
+		errString += fmt.Sprintf("\n- %v", err)
+	}
+
+	return errString
+}
+
+// Unwrap returns the individual payload errors.
+func (p *PayloadError) Unwrap() []error {
+	return p.Errors
+}
+
 // ChannelPackets contains the user metadata for a metadata stream
 // and the channel that is fed the metadata stream.
 type ChannelPackets struct {
@@ -80,6 +110,17 @@ type MrxEncodeOptions struct {
 	// is the manifest file to be used
 	// default is to include it
 	DisableManifest bool
+	// Derivation is the rule for deriving the UMID
+	// from the UMID of any previous manifest.
+	Derivation Derivation
+	// PayloadValidator checks the text payloads against the schema
+	// of the namespace of their stream e.g. a payload.Registry,
+	// if set every text payload is checked.
+	PayloadValidator PayloadValidator
+	// Edit is the edit that made this file from the previous
+	// mrx file e.g. a trim, it is recorded with the previous
+	// manifest in the manifest history.
+	Edit string
 }
 
 // Encode writes the data to an mrx file, default options are used if MrxEncodeOptions is nil
@@ -120,13 +161,28 @@ func (mw *MrxWriter) Encode(w io.Writer, encodeOptions *MrxEncodeOptions) error
 		return fmt.Errorf("error configuring essence %v", err)
 	}
 
+	if encodeOptions.PayloadValidator != nil {
+		payloadValidators(&cleanStream, round.Config, encodeOptions.PayloadValidator)
+	}
+
 	// get the essence keys
 	containerKeys := cleanStream.containerKeys
 	// set the writer infromation
 	// @TODO check its the clean stream stuff
 	mw.frameInformation.StreamTimeLine = round.Config
 
+	// the start timecode is at the base frame rate
+	mw.frameInformation.StartTimecode, err = round.Config.StartFrame(cleanStream.timecodeFPS())
+	if err != nil {
+		return err
+	}
+
 	// generate the UMDID for this mrx file
+	// following on from any previous file
+	err = mw.deriveUMID(round.Manifest.UMID, encodeOptions.Derivation)
+	if err != nil {
+		return err
+	}
 	mw.uMIDFinish(len(containerKeys))
 
 	if !encodeOptions.DisableManifest {
@@ -153,7 +209,7 @@ func (mw *MrxWriter) Encode(w io.Writer, encodeOptions *MrxEncodeOptions) error
 	}
 
 	// generate the manifest and core, encoding to
-	manifestBytes, err := mw.encodeRoundTrip(round, manifesters, cleanStream, encodeOptions.ManifestHistoryCount)
+	manifestBytes, err := mw.encodeRoundTrip(round, manifesters, cleanStream, encodeOptions.ManifestHistoryCount, encodeOptions.Edit)
 	if err != nil {
 		return err
 	}
@@ -198,6 +254,23 @@ type channelProperties struct {
 	frameRate       mxf2go.TRational
 	frameMultiplier int
 	nameSpace       string
+
+	// the properties for checking the payloads
+	streamID         int
+	text             bool
+	validator        PayloadValidator
+	payloadNameSpace string
+}
+
+// checkPayload checks the payload against the schema of the stream,
+// if the stream has a validator.
+func (c channelProperties) checkPayload(data []byte, frame int) ([]error, error) {
+	// empty frames are missing data, so have no payload to check
+	if c.validator == nil || len(data) == 0 {
+		return nil, nil
+	}
+
+	return c.validator.ValidatePayload(data, c.streamID, frame, c.payloadNameSpace)
 }
 
 type mrxLayout struct {
@@ -251,11 +324,7 @@ func streamClean(foundStream StreamInformation, userStream manifest.Configuratio
 			keyTypes[baseKey]++
 
 			// extract frame rate here
-			getFrame := userStream.StreamProperties[i].FrameRate
-			if getFrame == "" {
-				getFrame = userStream.Default.FrameRate
-
-			}
+			getFrame := userStream.StreamFrameRate(i)
 
 			var num, dom int32
 			if getFrame != "" {
@@ -297,6 +366,7 @@ func streamClean(foundStream StreamInformation, userStream manifest.Configuratio
 
 		cleanEssence[i].nameSpace = userStream.StreamProperties[i].NameSpace
 		cleanEssence[i].key = essenceKey
+		cleanEssence[i].text = baseKey == TextFrame || baseKey == TextClip
 
 	}
 
@@ -306,6 +376,18 @@ func streamClean(foundStream StreamInformation, userStream manifest.Configuratio
 
 	}
 
+	// the stream ID is the position of the stream in the file,
+	// where the clocked streams are written before the clip wrapped streams
+	streamID := 0
+	for _, clocked := range []bool{true, false} {
+		for i := range cleanEssence {
+			if cleanEssence[i].clocked == clocked {
+				cleanEssence[i].streamID = streamID
+				streamID++
+			}
+		}
+	}
+
 	/*
 		if data is going to be reorderd fix the stream
 	*/
@@ -314,6 +396,34 @@ func streamClean(foundStream StreamInformation, userStream manifest.Configuratio
 	return fullStream, nil
 }
 
+// timecodeFPS returns the frames per second of the timecode,
+// which is the base frame rate rounded to whole frames e.g. 30 for 30000/1001
+func (m mrxLayout) timecodeFPS() int {
+	fps, err := manifest.NominalFPS(fmt.Sprintf("%v/%v", m.baseFrameRate.Numerator, m.baseFrameRate.Denominator))
+	if err != nil {
+		// files without clocked streams have no base frame rate
+		fps, _ = manifest.NominalFPS(manifest.DefaultFrameRate)
+	}
+
+	return fps
+}
+
+// payloadValidators gives the text streams the validator
+// and the namespace to check their payloads against.
+func payloadValidators(layout *mrxLayout, config manifest.Configuration, validator PayloadValidator) {
+
+	for i, stream := range layout.dataStreams {
+		if !stream.text {
+			continue
+		}
+
+		layout.dataStreams[i].validator = validator
+		// the configuration is in the order the streams were given,
+		// not the file order of the stream ID
+		layout.dataStreams[i].payloadNameSpace = config.StreamNameSpace(i)
+	}
+}
+
 func configUpdate(base *manifest.Configuration, overWrite manifest.Configuration) error {
 
 	updateBytes, err := json.Marshal(overWrite)
@@ -457,6 +567,9 @@ func encodeEssence(w io.Writer, filePosition *partitionPosition, mrxwriter Encod
 	// set up a stream flag
 	availableEssence := true
 
+	// the payloads that do not match their schemas
+	var violations []error
+
 	if len(clockDataStreams) == 0 {
 		availableEssence = false
 	}
@@ -500,6 +613,12 @@ func encodeEssence(w io.Writer, filePosition *partitionPosition, mrxwriter Encod
 
 					manifesters[i].Essence = append(manifesters[i].Essence, *man)
 					manifesters[i].Common = pipe.pack.OverViewData
+
+					payloadErrs, err := pipe.info.checkPayload(*essPacket.Data, len(manifesters[i].Essence)-1)
+					if err != nil {
+						return nil, err
+					}
+					violations = append(violations, payloadErrs...)
 				}
 				essKLV := essPacket.Data
 				berLength := mxf2go.BEREncode(len(*essKLV))
@@ -558,6 +677,12 @@ func encodeEssence(w io.Writer, filePosition *partitionPosition, mrxwriter Encod
 		manifesters[clockCount+i].Essence = append(manifesters[clockCount+i].Essence, *man)
 		manifesters[clockCount+i].Common = dataStream.pack.OverViewData
 
+		payloadErrs, err := dataStream.info.checkPayload(*essKLV, 0)
+		if err != nil {
+			return nil, err
+		}
+		violations = append(violations, payloadErrs...)
+
 	}
 
 	// collect any errors from the data stream
@@ -566,6 +691,12 @@ func encodeEssence(w io.Writer, filePosition *partitionPosition, mrxwriter Encod
 		return nil, err
 	}
 
+	// the payloads are all checked before an error is returned,
+	// so every error can be fixed at once
+	if len(violations) != 0 {
+		return nil, &PayloadError{Errors: violations}
+	}
+
 	partitionManifest = append(partitionManifest, manifesters...)
 
 	filePosition.sID++ // update the SID for the manifest
@@ -873,9 +1004,10 @@ const (
 
 // encode manifest generates the json bytes of a mainfest.
 // using any previous manifests if required
-func (mw *MrxWriter) encodeRoundTrip(setup *manifest.RoundTrip, manifesters []manifest.Overview, mrxChans mrxLayout, manifestCount int) ([]byte, error) {
+func (mw *MrxWriter) encodeRoundTrip(setup *manifest.RoundTrip, manifesters []manifest.Overview, mrxChans mrxLayout, manifestCount int, edit string) ([]byte, error) {
 	prevManifest := setup.Manifest
-	prevManifestTag := manifest.TaggedManifest{Manifest: prevManifest}
+	// the snapshot date is when the manifest was superseded by this one
+	prevManifestTag := manifest.TaggedManifest{Manifest: prevManifest, Date: mw.writeInformation.buildTimeTime.Format(time.RFC3339), Edit: edit}
 
 	UUIDb, _ := mw.writeInformation.mrxUMID.MarshalText()
 	destManifest := manifest.Manifest{UMID: string(UUIDb), MRXTool: mrxTool, Version: " 0.0.0.1"}
@@ -883,9 +1015,15 @@ func (mw *MrxWriter) encodeRoundTrip(setup *manifest.RoundTrip, manifesters []ma
 	// if it a manifest has been found
 	if !reflect.DeepEqual(prevManifestTag.Manifest, manifest.Manifest{}) {
 		history := prevManifest.History
-		prevManifest.History = nil
+		// keep the history flat, rather than nesting it in the snapshot
+		prevManifestTag.History = nil
 
 		destManifest.History = append([]manifest.TaggedManifest{prevManifestTag}, history...)
+		// files written by earlier versions may have nested histories,
+		// these are duplicates of the flat history so are removed
+		for i := range destManifest.History {
+			destManifest.History[i].History = nil
+		}
 	}
 	// else continue as normal as there is no mainpulation of th eprevious manifest
 
@@ -907,8 +1045,8 @@ func (mw *MrxWriter) encodeRoundTrip(setup *manifest.RoundTrip, manifesters []ma
 
 	if mrxChans.reorder {
 
-		reorder := manifest.Configuration{Version: setup.Config.Version, Default: setup.Config.Default,
-			StreamProperties: make(map[int]manifest.StreamProperties)}
+		reorder := manifest.Configuration{Version: setup.Config.Version, StartTimecode: setup.Config.StartTimecode,
+			Default: setup.Config.Default, StreamProperties: make(map[int]manifest.StreamProperties)}
 		fwCount := 0
 		clipWrapped := []int{}
 		for i, mrxChan := range mrxChans.dataStreams {
@@ -935,6 +1073,12 @@ func (mw *MrxWriter) encodeRoundTrip(setup *manifest.RoundTrip, manifesters []ma
 		return nil, fmt.Errorf("error encoding the manifest: %v", err)
 	}
 
+	// check the mrx file is not being written with an invalid manifest
+	err = manifest.RoundTripValidator(manb, true)
+	if err != nil {
+		return nil, fmt.Errorf("error validating the generated manifest: %v", err)
+	}
+
 	length := mxf2go.BEREncode(len(manb))
 
 	var buffer bytes.Buffer
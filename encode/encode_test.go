@@ -3,12 +3,15 @@ package encode
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"sync"
 	"testing"
 
 	"github.com/metarex-media/mrx-tool/decode"
 	"github.com/metarex-media/mrx-tool/manifest"
+	"github.com/metarex-media/mrx-tool/payload"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -175,6 +178,121 @@ func TestFileWrite(t *testing.T) {
 	}
 }
 
+func TestPayloadSchemas(t *testing.T) {
+
+	gps := "https://metarex.media/reg/MRX.123.456.789.gps"
+	reg, regErr := payload.LoadRegistry("../payload/testdata/registry")
+
+	// the binary streams are not checked as they are not text
+	testdata := [][]simpleContents{
+		{{key: BinaryFrame, contents: [][]byte{[]byte("binary"), []byte("binary")}},
+			{key: TextFrame, contents: [][]byte{[]byte(`{"latitude": 51.5, "longitude": -0.12}`), []byte(`{"latitude": "51.5", "longitude": -0.12}`)}}},
+		// the clip wrapped stream is written after the frame wrapped stream
+		{{key: TextClip, contents: [][]byte{[]byte(`{"latitude": "51.5", "longitude": -0.12}`)}},
+			{key: BinaryFrame, contents: [][]byte{[]byte("binary"), []byte("binary")}}},
+	}
+	configs := []manifest.RoundTrip{
+		{Config: manifest.Configuration{StreamProperties: map[int]manifest.StreamProperties{1: {NameSpace: gps}}}},
+		{Config: manifest.Configuration{StreamProperties: map[int]manifest.StreamProperties{0: {NameSpace: gps, FrameRate: "static"}}}},
+	}
+	expected := [][]payload.Violation{
+		{{Stream: 1, Frame: 1, NameSpace: gps, Pointer: "/latitude", Description: "Invalid type. Expected: number, given: string"}},
+		{{Stream: 1, Frame: 0, NameSpace: gps, Pointer: "/latitude", Description: "Invalid type. Expected: number, given: string"}},
+	}
+
+	for i, contents := range testdata {
+
+		// the encoder reorders the configuration of the round trip,
+		// so each writer is given its own copy
+		validConfig, config := configs[i], configs[i]
+		validWriter := NewMRXWriter()
+		validWriter.UpdateEncoder(simpleTest{contents: contents, fakeRoundTrip: &validConfig})
+		validBuf := bytes.NewBuffer([]byte{})
+		// check the file is valid without checking the schemas
+		validErr := validWriter.Encode(validBuf, &MrxEncodeOptions{})
+		violations, validateErr := payload.ValidateMRX(validBuf, reg)
+
+		writer := NewMRXWriter()
+		writer.UpdateEncoder(simpleTest{contents: contents, fakeRoundTrip: &config})
+		err := writer.Encode(bytes.NewBuffer([]byte{}), &MrxEncodeOptions{PayloadValidator: reg})
+		var payloadErr *PayloadError
+		isPayloadErr := errors.As(err, &payloadErr)
+		var violation payload.Violation
+		isViolation := errors.As(err, &violation)
+
+		Convey("Checking text payloads are validated against the schemas of their namespace", t, func() {
+			Convey(fmt.Sprintf("encoding the streams of test %v with an invalid payload", i), func() {
+				Convey("the encode fails with the stream, frame and path of the invalid payload", func() {
+					So(regErr, ShouldBeNil)
+					So(isPayloadErr, ShouldBeTrue)
+					So(payloadErr.Errors, ShouldResemble, []error{expected[i][0]})
+					So(isViolation, ShouldBeTrue)
+					So(violation, ShouldResemble, expected[i][0])
+				})
+			})
+			Convey("validating an mrx file with the same invalid payload", func() {
+				Convey("the same violation is found from the manifest namespaces", func() {
+					So(validErr, ShouldBeNil)
+					So(validateErr, ShouldBeNil)
+					So(violations, ShouldResemble, expected[i])
+				})
+			})
+		})
+	}
+}
+
+func TestTimecodeTrack(t *testing.T) {
+
+	// 29.97 fps has a timecode of 30 frames per second
+	config := manifest.RoundTrip{Config: manifest.Configuration{StartTimecode: "00:00:01:00", Default: manifest.StreamProperties{FrameRate: "30000/1001"}}}
+	writer := NewMRXWriter()
+	writer.UpdateEncoder(simpleTest{contents: []simpleContents{{key: TextFrame, contents: [][]byte{[]byte(`{}`), []byte(`{}`)}}}, fakeRoundTrip: &config})
+	var mrx, layout bytes.Buffer
+	encodeErr := writer.Encode(&mrx, &MrxEncodeOptions{})
+	layoutErr := decode.ExtractStructure(&mrx, &layout, decode.StructureOptions{Format: decode.FormatJSON})
+
+	var decoded any
+	jsonErr := json.Unmarshal(layout.Bytes(), &decoded)
+	timecodes := timecodeProperties(decoded)
+
+	Convey("Checking the timecode track matches the start timecode", t, func() {
+		Convey("using a start timecode of 1 second at 30000/1001", func() {
+			Convey("the timecode is at the nominal 30 fps, in the header and footer", func() {
+				So(encodeErr, ShouldBeNil)
+				So(layoutErr, ShouldBeNil)
+				So(jsonErr, ShouldBeNil)
+				So(len(timecodes), ShouldEqual, 2)
+				for _, timecode := range timecodes {
+					So(timecode["FramesPerSecond"], ShouldEqual, 30)
+					So(timecode["StartTimecode"], ShouldEqual, 30)
+				}
+			})
+		})
+	})
+}
+
+// timecodeProperties finds the properties of every timecode component in the decoded layout
+func timecodeProperties(decoded any) []map[string]any {
+
+	var found []map[string]any
+	switch value := decoded.(type) {
+	case map[string]any:
+		if _, ok := value["FramesPerSecond"]; ok {
+			return []map[string]any{value}
+		}
+
+		for _, child := range value {
+			found = append(found, timecodeProperties(child)...)
+		}
+	case []any:
+		for _, child := range value {
+			found = append(found, timecodeProperties(child)...)
+		}
+	}
+
+	return found
+}
+
 type simpleTest struct {
 	fakeRoundTrip *manifest.RoundTrip
 	contents      []simpleContents
@@ -3,7 +3,6 @@ package encode
 import (
 	"encoding/binary"
 	"fmt"
-	"math/rand"
 	"time"
 
 	"github.com/google/uuid"
@@ -23,7 +22,10 @@ type MrxWriter struct {
 
 // writerInformation contains the time the file was made and the UMID
 type writerInformation struct {
-	mrxUMID       mxf2go.TPackageIDType
+	mrxUMID mxf2go.TPackageIDType
+	// sourceUMID is the UMID of the original file
+	// if the content was derived from a previous mrx file
+	sourceUMID    mxf2go.TPackageIDType
 	buildTime     mxf2go.TTimeStamp
 	buildTimeTime time.Time
 }
@@ -35,6 +37,8 @@ type frameInformation struct {
 	ContainerKeys [][]byte
 	// map[int]FrameRate
 	StreamTimeLine manifest.Configuration
+	// StartTimecode is the number of frames of the start timecode
+	StartTimecode int
 }
 
 /*
@@ -84,7 +88,7 @@ func newWriter(frameNumerator, frameDenominator int32) (*MrxWriter, error) {
 
 	// byte 11 is material type
 	// byte 12 is the creation method 02 uuid for the top nibble
-	// and no defined method for the bottom
+	// and locally registered (incrementing) instance numbers for the bottom
 	var smpteLabel = [12]byte{0x6, 0xa, 0x2b, 0x34, 0x01, 0x01, 0x01, 0x05, 0x01, 0x01, 0x0d, 0b00100000} // "060a2b340101010501010d00"}
 	mxfUUID := uuid.New()
 
@@ -95,8 +99,8 @@ func newWriter(frameNumerator, frameDenominator int32) (*MrxWriter, error) {
 
 	mat := mxf2go.TAUID{Data1: order.Uint32(mxfUUID[0:4]), Data2: order.Uint16(mxfUUID[4:6]), Data3: order.Uint16(mxfUUID[6:8]), Data4: Data4}
 
-	wi := writerInformation{mrxUMID: mxf2go.TPackageIDType{SMPTELabel: smpteLabel, Length: 19, InstanceHigh: uint8(rand.Intn(0xff)),
-		InstanceMid: uint8(rand.Intn(0xff)), InstanceLow: uint8(rand.Intn(0xff)), Material: mat}}
+	// the instance number is 0 as this is the first instance of new material
+	wi := writerInformation{mrxUMID: mxf2go.TPackageIDType{SMPTELabel: smpteLabel, Length: 19, Material: mat}}
 
 	fi := frameInformation{FrameRate: mxf2go.TRational{Numerator: frameNumerator, Denominator: frameDenominator}}
 
@@ -120,8 +124,8 @@ func NewMRXWriter() *MrxWriter {
 
 	mat := mxf2go.TAUID{Data1: order.Uint32(mxfUUID[0:4]), Data2: order.Uint16(mxfUUID[4:6]), Data3: order.Uint16(mxfUUID[6:8]), Data4: Data4}
 
-	wi := writerInformation{mrxUMID: mxf2go.TPackageIDType{SMPTELabel: smpteLabel, Length: 19, InstanceHigh: uint8(rand.Intn(0xff)),
-		InstanceMid: uint8(rand.Intn(0xff)), InstanceLow: uint8(rand.Intn(0xff)), Material: mat}}
+	// the instance number is 0 as this is the first instance of new material
+	wi := writerInformation{mrxUMID: mxf2go.TPackageIDType{SMPTELabel: smpteLabel, Length: 19, Material: mat}}
 
 	fi := frameInformation{}
 
@@ -8,7 +8,7 @@ import (
 
 	"github.com/google/uuid"
 
-	"github.com/metarex-media/mrx-tool/decode"
+	"github.com/metarex-media/mrx-tool/klv"
 	mxf2go "github.com/metarex-media/mxf-to-go"
 )
 
@@ -17,7 +17,8 @@ func (mw *MrxWriter) contentStorage(primer *mxf2go.Primer, stream mrxLayout) ([]
 
 	// generate the timecodes
 
-	timelineBytes, timeCodeID := mw.frameInformation.sourcePackageTimeline(primer, mxf2go.TPackageIDType{}, stream)
+	// the source clip references the original file if the content was derived from one
+	timelineBytes, timeCodeID := mw.frameInformation.sourcePackageTimeline(primer, mw.writeInformation.sourceUMID, stream)
 
 	// if mw.frameInformation.EssenceKeys contains the isxd essence descriptor flag
 	// @TODO update this so isxd header is only called when the isxd key is used
@@ -90,7 +91,7 @@ func (fi *frameInformation) outputTimeline(primer *mxf2go.Primer, umid mxf2go.TP
 
 			// set up the time code
 			timeCodeID := mxf2go.TUUID(uuid.New())
-			timeCode := mxf2go.GTimecodeStruct{StartTimecode: 0, InstanceID: timeCodeID, FramesPerSecond: uint16(str.frameRate.Numerator),
+			timeCode := mxf2go.GTimecodeStruct{StartTimecode: mxf2go.TPositionType(fi.StartTimecode), InstanceID: timeCodeID, FramesPerSecond: uint16(stream.timecodeFPS()),
 				ComponentDataDefinition: []byte{0x06, 0x0e, 0x2b, 0x34, 04, 01, 01, 01, 01, 03, 02, 02, 03, 00, 00, 00}}
 			timeCodeBytes, _ := timeCode.Encode(primer)
 			// 060e2b34.04010101.01030202.03000000
@@ -274,7 +275,7 @@ func nameSpaces(bases mrxLayout) []byte {
 
 	for _, bp := range bases.dataStreams {
 
-		channelID := decode.FullName(bp.key)
+		channelID := klv.FullName(bp.key)
 
 		if bp.clocked {
 
@@ -0,0 +1,147 @@
+package encode
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	mxf2go "github.com/metarex-media/mxf-to-go"
+)
+
+// Derivation is the rule for how the UMID of a new mrx file
+// is derived from the UMID of the file it was made from, following
+// the instance number rules of SMPTE 330.
+type Derivation int
+
+const (
+	// DeriveNewContent mints a new material number for new content,
+	// with the source package referencing the previous UMID.
+	// This is the default. If there is no previous UMID a brand new UMID is used.
+	DeriveNewContent Derivation = iota
+	// DeriveNew ignores any previous UMID and mints a brand new one.
+	DeriveNew
+	// DeriveRewrap keeps the material number of the previous UMID
+	// and increments the instance number. This is for when the essence is
+	// unchanged or has only been rewrapped.
+	DeriveRewrap
+)
+
+// ParseDerivation converts a string of new, rewrap or newcontent
+// into a Derivation.
+func ParseDerivation(rule string) (Derivation, error) {
+	switch strings.ToLower(rule) {
+	case "", "newcontent":
+		return DeriveNewContent, nil
+	case "new":
+		return DeriveNew, nil
+	case "rewrap":
+		return DeriveRewrap, nil
+	default:
+		return DeriveNewContent, fmt.Errorf("unknown UMID derivation rule \"%s\", please use one of new, rewrap or newcontent", rule)
+	}
+}
+
+// ParseUMID converts the 64 character hex string of a UMID,
+// as written in the manifest, into a UMID.
+func ParseUMID(umid string) (mxf2go.TPackageIDType, error) {
+
+	umidBytes, err := hex.DecodeString(umid)
+	if err != nil {
+		return mxf2go.TPackageIDType{}, fmt.Errorf("error parsing UMID %s: %v", umid, err)
+	}
+
+	if len(umidBytes) != 32 {
+		return mxf2go.TPackageIDType{}, fmt.Errorf("error parsing UMID %s: expected 32 bytes got %v", umid, len(umidBytes))
+	}
+
+	var label mxf2go.TUInt8Array12
+	copy(label[:], umidBytes[0:12])
+	var data4 mxf2go.TUInt8Array8
+	copy(data4[:], umidBytes[24:32])
+
+	return mxf2go.TPackageIDType{SMPTELabel: label, Length: umidBytes[12],
+		InstanceHigh: umidBytes[13], InstanceMid: umidBytes[14], InstanceLow: umidBytes[15],
+		Material: mxf2go.TAUID{Data1: order.Uint32(umidBytes[16:20]), Data2: order.Uint16(umidBytes[20:22]),
+			Data3: order.Uint16(umidBytes[22:24]), Data4: data4}}, nil
+}
+
+// FormatUMID returns the UMID as the 64 character hex string
+// used in the manifest.
+func FormatUMID(umid mxf2go.TPackageIDType) string {
+	umidText, _ := umid.MarshalText()
+	return string(umidText)
+}
+
+// SameMaterial returns true if both UMIDs have the same material number,
+// i.e. they are instances of the same content.
+func SameMaterial(a, b mxf2go.TPackageIDType) bool {
+	return a.Material == b.Material
+}
+
+// InstanceNumber returns the 24 bit instance number of the UMID.
+func InstanceNumber(umid mxf2go.TPackageIDType) int {
+	return int(umid.InstanceHigh)<<16 | int(umid.InstanceMid)<<8 | int(umid.InstanceLow)
+}
+
+// CompareUMID compares the instance numbers of two UMIDs of the same material.
+// It returns -1 if a is an earlier instance than b, 1 if it is later and 0 if they
+// are the same instance. An error is returned if the material numbers are different.
+func CompareUMID(a, b mxf2go.TPackageIDType) (int, error) {
+	if !SameMaterial(a, b) {
+		return 0, fmt.Errorf("UMIDs %s and %s do not share a material number", FormatUMID(a), FormatUMID(b))
+	}
+
+	aInst, bInst := InstanceNumber(a), InstanceNumber(b)
+	switch {
+	case aInst < bInst:
+		return -1, nil
+	case aInst > bInst:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+// nextInstance returns the UMID with the instance number incremented by one.
+func nextInstance(umid mxf2go.TPackageIDType) (mxf2go.TPackageIDType, error) {
+	instance := InstanceNumber(umid) + 1
+	if instance > 0xffffff {
+		return mxf2go.TPackageIDType{}, fmt.Errorf("the instance number of UMID %s can not be incremented any further", FormatUMID(umid))
+	}
+
+	umid.InstanceHigh, umid.InstanceMid, umid.InstanceLow = uint8(instance>>16), uint8(instance>>8), uint8(instance)
+
+	return umid, nil
+}
+
+// deriveUMID updates the writer UMID based on the UMID of the previous manifest
+// and the derivation rule.
+func (mw *MrxWriter) deriveUMID(previous string, rule Derivation) error {
+
+	if previous == "" || rule == DeriveNew {
+		// keep the new material number
+		return nil
+	}
+
+	prevUMID, err := ParseUMID(previous)
+	if err != nil {
+		return fmt.Errorf("error deriving the UMID from the previous manifest: %v", err)
+	}
+
+	switch rule {
+	case DeriveRewrap:
+		// same material, so bump the instance and keep the material number
+		next, err := nextInstance(prevUMID)
+		if err != nil {
+			return err
+		}
+		mw.writeInformation.mrxUMID.Material = next.Material
+		mw.writeInformation.mrxUMID.InstanceHigh, mw.writeInformation.mrxUMID.InstanceMid, mw.writeInformation.mrxUMID.InstanceLow = next.InstanceHigh, next.InstanceMid, next.InstanceLow
+	default:
+		// new content keeps the fresh material number
+		// and the source package points back to the original
+		mw.writeInformation.sourceUMID = prevUMID
+	}
+
+	return nil
+}
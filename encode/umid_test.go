@@ -0,0 +1,89 @@
+package encode
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/metarex-media/mrx-tool/decode"
+	"github.com/metarex-media/mrx-tool/manifest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUMIDParse(t *testing.T) {
+
+	umids := []string{"060a2b340101010501010c20132f3179f598a3ae27d64334bf09289ebf5eaadd", "060a2b340101010501010c2013e4173480bfd43cb56a484b914241cbf910694b"}
+
+	for _, umid := range umids {
+		parsed, err := ParseUMID(umid)
+
+		Convey("Checking UMID strings are parsed and formatted without changing", t, func() {
+			Convey("parsing "+umid+" then formatting it again", func() {
+				Convey("no error is returned and the formatted UMID matches the input", func() {
+					So(err, ShouldBeNil)
+					So(FormatUMID(parsed), ShouldEqual, umid)
+				})
+			})
+		})
+	}
+
+	badUMIDs := []string{"060a2b34", "not a umid"}
+	for _, umid := range badUMIDs {
+		_, err := ParseUMID(umid)
+
+		Convey("Checking invalid UMID strings are caught", t, func() {
+			Convey("parsing "+umid, func() {
+				Convey("an error is returned", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+	}
+}
+
+func TestUMIDDerivation(t *testing.T) {
+
+	previous := "060a2b340101010501010c20132f3179f598a3ae27d64334bf09289ebf5eaadd"
+	prevUMID, _ := ParseUMID(previous)
+
+	rules := []Derivation{DeriveRewrap, DeriveNewContent, DeriveNew}
+	sameMaterial := []bool{true, false, false}
+	expectedCompare := []int{1, 0, 0}
+
+	for i, rule := range rules {
+		// encode a file with the previous manifest
+		testdata := []simpleContents{{key: TextFrame, contents: [][]byte{[]byte("test metadata"), []byte("test metadata")}}}
+		simple := simpleTest{contents: testdata, fakeRoundTrip: &manifest.RoundTrip{Manifest: manifest.Manifest{UMID: previous}}}
+
+		writer := NewMRXWriter()
+		writer.UpdateEncoder(simple)
+		fileBuf := bytes.NewBuffer([]byte{})
+		err := writer.Encode(fileBuf, &MrxEncodeOptions{Derivation: rule})
+
+		// then extract the manifest UMID
+		streams, decodeErr := decode.ExtractStreamData(fileBuf)
+		var rt manifest.RoundTrip
+		for _, stream := range streams {
+			if stream.MRXID == "060e2b34.01020101.0f020101.05000000" {
+				json.Unmarshal(stream.Data[0], &rt)
+			}
+		}
+
+		newUMID, parseErr := ParseUMID(rt.Manifest.UMID)
+		compare, _ := CompareUMID(newUMID, prevUMID)
+
+		Convey("Checking the UMID is derived from the previous manifest", t, func() {
+			Convey("encoding a file with a previous manifest UMID", func() {
+				Convey("the material number is only kept for rewraps, with the instance number incremented", func() {
+					So(err, ShouldBeNil)
+					So(decodeErr, ShouldBeNil)
+					So(parseErr, ShouldBeNil)
+					So(SameMaterial(newUMID, prevUMID), ShouldEqual, sameMaterial[i])
+					So(compare, ShouldEqual, expectedCompare[i])
+					// the instance numbers are locally registered incrementing numbers
+					So(newUMID.SMPTELabel[11], ShouldEqual, 0b00100000)
+				})
+			})
+		})
+	}
+}
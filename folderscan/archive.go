@@ -0,0 +1,306 @@
+package folderscan
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OpenArchive opens a tar (or gzipped tar) or zip archive of an mrx folder
+// layout as a file system, so it can be encoded with the FolderScanner
+// without extracting it. The archive is either the folder layout, or a single
+// folder of the layout, folder is the path of the layout in the file system.
+// cleanup closes the archive once it has been encoded.
+//
+// Gzipped tar archives are decompressed to a temporary file, as they can not be
+// read from the middle of the archive. The file is removed by cleanup.
+func OpenArchive(archive string) (fsys fs.FS, folder string, cleanup func(), err error) {
+
+	fsys, cleanup, err = openArchive(archive)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("error opening %v: %v", archive, err)
+	}
+
+	// use the folder within the archive, if the
+	// layout has been archived as a single folder
+	entries, err := fs.ReadDir(fsys, ".")
+	if err == nil && len(entries) == 1 && entries[0].IsDir() && !streamFol.MatchString(strings.ToLower(entries[0].Name())) {
+		return fsys, entries[0].Name(), cleanup, nil
+	}
+
+	return fsys, ".", cleanup, nil
+}
+
+// openArchive opens the archive as a file system,
+// the archive format is found from its contents.
+func openArchive(archive string) (fs.FS, func(), error) {
+
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	magic := make([]byte, 512)
+	n, _ := f.ReadAt(magic, 0)
+	magic = magic[:n]
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		zipped, err := zip.NewReader(f, info.Size())
+		if err == nil {
+			err = localNames(zipped)
+		}
+
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+
+		return zipped, func() { f.Close() }, nil
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		// the whole tar is needed to read
+		// the files in any order
+		defer f.Close()
+		tarFile, err := gunzip(f)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		cleanup := func() {
+			tarFile.Close()
+			os.Remove(tarFile.Name())
+		}
+
+		tarInfo, err := tarFile.Stat()
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+
+		tarred, err := newTarFS(tarFile, tarInfo.Size())
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+
+		return tarred, cleanup, nil
+	case len(magic) >= 262 && string(magic[257:262]) == "ustar":
+		tarred, err := newTarFS(f, info.Size())
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+
+		return tarred, func() { f.Close() }, nil
+	default:
+		f.Close()
+		return nil, nil, fmt.Errorf("the input is not a folder, tar or zip archive")
+	}
+}
+
+// gunzip decompresses a gzipped archive to a temporary file,
+// the file is removed if the archive can not be decompressed.
+func gunzip(archive io.Reader) (*os.File, error) {
+
+	gzipped, err := gzip.NewReader(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	tarFile, err := os.CreateTemp("", "mrx-archive-*.tar")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(tarFile, gzipped); err != nil {
+		tarFile.Close()
+		os.Remove(tarFile.Name())
+		return nil, err
+	}
+
+	return tarFile, nil
+}
+
+// localNames checks every file of the zip archive is within the archive
+func localNames(archive *zip.Reader) error {
+
+	for _, file := range archive.File {
+		if !filepath.IsLocal(filepath.FromSlash(file.Name)) {
+			return fmt.Errorf("the archive file %v is not within the archive", file.Name)
+		}
+	}
+
+	return nil
+}
+
+// tarFS is a read only file system of a tar archive. The archive is indexed
+// when it is opened, then each file is read from its position in the archive.
+type tarFS struct {
+	archive io.ReaderAt
+	files   map[string]*tarEntry
+}
+
+// tarEntry is a file or folder in a tar archive
+type tarEntry struct {
+	name    string
+	dir     bool
+	offset  int64
+	size    int64
+	modTime time.Time
+	// children are the contents of a folder, sorted by name
+	children []*tarEntry
+}
+
+// newTarFS indexes the files of a tar archive
+func newTarFS(archive io.ReaderAt, size int64) (*tarFS, error) {
+
+	tfs := &tarFS{archive: archive, files: map[string]*tarEntry{".": {name: ".", dir: true}}}
+
+	// the section reader can seek, so the
+	// contents are skipped not read when indexing
+	section := io.NewSectionReader(archive, 0, size)
+	tr := tar.NewReader(section)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		// only the files are needed, their folders are made as they are found
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if !fs.ValidPath(name) || name == "." {
+			return nil, fmt.Errorf("the archive file %v is not within the archive", header.Name)
+		}
+
+		// the header has been read, so the contents are next
+		offset, err := section.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+
+		tfs.add(name, &tarEntry{name: path.Base(name), offset: offset, size: header.Size, modTime: header.ModTime})
+	}
+
+	for _, entry := range tfs.files {
+		sort.Slice(entry.children, func(i, j int) bool { return entry.children[i].name < entry.children[j].name })
+	}
+
+	return tfs, nil
+}
+
+// add adds the entry and any of its parent folders to the file system
+func (t *tarFS) add(name string, entry *tarEntry) {
+
+	if _, ok := t.files[name]; ok {
+		// later files of the same name replace the earlier ones
+		*t.files[name] = *entry
+		return
+	}
+
+	t.files[name] = entry
+
+	parentName := path.Dir(name)
+	parent, ok := t.files[parentName]
+	if !ok {
+		parent = &tarEntry{name: path.Base(parentName), dir: true}
+		t.add(parentName, parent)
+	}
+
+	parent.children = append(parent.children, entry)
+}
+
+func (t *tarFS) Open(name string) (fs.File, error) {
+
+	entry, err := t.entry("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tarFile{tarEntry: entry, SectionReader: io.NewSectionReader(t.archive, entry.offset, entry.size)}, nil
+}
+
+func (t *tarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+
+	entry, err := t.entry("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !entry.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fmt.Errorf("not a directory")}
+	}
+
+	entries := make([]fs.DirEntry, len(entry.children))
+	for i, child := range entry.children {
+		entries[i] = fs.FileInfoToDirEntry(child)
+	}
+
+	return entries, nil
+}
+
+// entry finds the file or folder of the name
+func (t *tarFS) entry(op, name string) (*tarEntry, error) {
+
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	entry, ok := t.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+
+	return entry, nil
+}
+
+func (e *tarEntry) Name() string       { return e.name }
+func (e *tarEntry) Size() int64        { return e.size }
+func (e *tarEntry) ModTime() time.Time { return e.modTime }
+func (e *tarEntry) IsDir() bool        { return e.dir }
+func (e *tarEntry) Sys() any           { return nil }
+
+func (e *tarEntry) Mode() fs.FileMode {
+	if e.dir {
+		return fs.ModeDir | 0555
+	}
+
+	return 0444
+}
+
+// tarFile is an open file of a tar archive
+type tarFile struct {
+	*tarEntry
+	*io.SectionReader
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) {
+	return f.tarEntry, nil
+}
+
+func (f *tarFile) Close() error {
+	return nil
+}
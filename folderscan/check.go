@@ -0,0 +1,160 @@
+package folderscan
+
+import (
+	"fmt"
+
+	"github.com/metarex-media/mrx-tool/manifest"
+)
+
+// the kinds of issue found in a folder layout
+const (
+	// IssueGap is a run of missing frames, that are encoded as empty frames
+	IssueGap = "gap"
+	// IssueDuplicate is more than one file for the same frame e.g. 1d and 01d
+	IssueDuplicate = "duplicate"
+	// IssueUnrecognised is a file or folder that is not part of the layout
+	IssueUnrecognised = "unrecognised"
+	// IssueMixed is a stream with more than one essence type
+	IssueMixed = "mixed"
+	// IssueStreamID is a missing stream number, the streams
+	// after it are renumbered when they are encoded
+	IssueStreamID = "stream"
+	// IssueConfig is a mismatch between config.json and the streams
+	IssueConfig = "config"
+)
+
+// Issue is a single problem with a folder layout. Stream and Frame
+// are -1 when the issue is not part of a stream or frame. File is the
+// slash separated path of the file, within the folder on disk or the FS.
+type Issue struct {
+	Kind        string `yaml:"Kind" json:"Kind"`
+	Stream      int    `yaml:"Stream" json:"Stream"`
+	Frame       int    `yaml:"Frame" json:"Frame"`
+	File        string `yaml:"File,omitempty" json:"File,omitempty"`
+	Description string `yaml:"Description" json:"Description"`
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%v: %v", i.Kind, i.Description)
+}
+
+// IssueError is returned when a strict folder scan finds issues.
+type IssueError struct {
+	Issues []Issue
+}
+
+func (i *IssueError) Error() string {
+	errString := fmt.Sprintf("%v issues were found in the folder layout:", len(i.Issues))
+	for _, issue := range i.Issues {
+		errString += fmt.Sprintf("\n- %v", issue)
+	}
+
+	return errString
+}
+
+// Check scans the folder for issues with its layout, without encoding it.
+// The issues are gaps of missing frames, duplicate frames, unrecognised files,
+// streams with mixed essence types, missing stream numbers and
+// StreamProperties in config.json that do not match the streams.
+func (f *FolderScanner) Check() ([]Issue, error) {
+
+	folderLayout, err := f.scan(true)
+	if err != nil {
+		return nil, err
+	}
+
+	round, err := f.GetRoundTrip()
+	if err != nil {
+		return nil, err
+	}
+
+	return folderLayout.check(round.Config), nil
+}
+
+// check returns the issues found when scanning, and the
+// issues of the streams against each other and the configuration.
+func (f *fullFolderMRX) check(config manifest.Configuration) []Issue {
+
+	issues := append([]Issue{}, f.issues...)
+	keys := orderKeys(f.streams)
+
+	for _, stream := range keys {
+		issues = append(issues, f.streams[stream].gaps(stream)...)
+	}
+
+	// the streams are numbered from 0
+	if len(keys) > 0 {
+		found := 0
+		for stream := 0; stream < keys[len(keys)-1]; stream++ {
+			if _, ok := f.streams[stream]; ok {
+				found++
+				continue
+			}
+
+			issues = append(issues, Issue{Kind: IssueStreamID, Stream: stream, Frame: -1,
+				Description: fmt.Sprintf("there is no stream %v, so the streams after it are renumbered from %v when they are encoded", stream, found)})
+		}
+	}
+
+	for _, stream := range orderKeys(config.StreamProperties) {
+		if _, ok := f.streams[stream]; !ok {
+			issues = append(issues, Issue{Kind: IssueConfig, Stream: stream, Frame: -1, File: "config.json",
+				Description: fmt.Sprintf("config.json has StreamProperties for stream %v, which is not in the folder", stream)})
+		}
+	}
+
+	return issues
+}
+
+// gaps returns each run of missing frames in the stream
+func (p *partition) gaps(stream int) []Issue {
+
+	var issues []Issue
+	for frame := 0; frame <= p.max; frame++ {
+		if _, ok := p.contents[frame]; ok {
+			continue
+		}
+
+		first := frame
+		for frame < p.max {
+			if _, ok := p.contents[frame+1]; ok {
+				break
+			}
+			frame++
+		}
+
+		issues = append(issues, Issue{Kind: IssueGap, Stream: stream, Frame: first,
+			Description: fmt.Sprintf("stream %v is missing frames %v to %v, they are encoded as empty frames", stream, first, frame)})
+	}
+
+	return issues
+}
+
+// addEssence adds a file to its stream, any
+// earlier file for the same frame is replaced.
+func (f *fullFolderMRX) addEssence(stream, frame int, ess essenceMRX) {
+
+	str := f.streams[stream]
+	if previous, ok := str.contents[frame]; ok {
+		f.issues = append(f.issues, Issue{Kind: IssueDuplicate, Stream: stream, Frame: frame, File: ess.fullLocation,
+			Description: fmt.Sprintf("%v and %v are both frame %v of stream %v", previous.fullLocation, ess.fullLocation, frame, stream)})
+	}
+
+	if frame > str.max {
+		str.max = frame
+	}
+
+	str.contents[frame] = ess
+}
+
+// unrecognised records a file or folder that is not part of the layout
+func (f *fullFolderMRX) unrecognised(name string) {
+	f.issues = append(f.issues, Issue{Kind: IssueUnrecognised, Stream: -1, Frame: -1, File: name,
+		Description: fmt.Sprintf("%v is not part of the folder layout, so is not encoded", name)})
+}
+
+// mixed records a file or folder of a different essence type to its stream
+func (f *fullFolderMRX) mixed(stream int, name string) {
+	f.issues = append(f.issues, Issue{Kind: IssueMixed, Stream: stream, Frame: -1, File: name,
+		Description: fmt.Sprintf("%v is a different essence type to the rest of stream %v", name, stream)})
+}
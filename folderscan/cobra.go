@@ -7,7 +7,9 @@ import (
 
 	"github.com/metarex-media/mrx-tool/encode"
 	"github.com/metarex-media/mrx-tool/manifest"
+	"github.com/metarex-media/mrx-tool/payload"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
 var encodeIn string
@@ -15,14 +17,28 @@ var encodeOut string
 var encodeFrameRate string
 var encodeManifestCount int
 var overWrite string
+var umidRule string
+var schemaRegistry string
+var encodeCheck bool
+var encodeStrict bool
+var encodeLayout string
+var encodeReadWorkers int
+var encodeReadAhead int
 
 func init() {
 	// set up flags for the two different decode commands
-	EncodeCmd.Flags().StringVar(&encodeIn, "input", "", "identifies the  input folder to be encoded")
+	EncodeCmd.Flags().StringVar(&encodeIn, "input", "", "identifies the input folder, or tar or zip archive of the folder, to be encoded")
 	EncodeCmd.Flags().StringVar(&encodeOut, "output", "", "the name of the file to be generated")
 	EncodeCmd.Flags().StringVar(&encodeFrameRate, "framerate", "", "gives the frame rate of the video in the form x/y e.g. 29.97 fps is 30000/1001")
 	EncodeCmd.Flags().IntVar(&encodeManifestCount, "previousManifest", 0, "The count of previous manifests to be included in the manifest, from 0 upwards. -1 is show all")
 	EncodeCmd.Flags().StringVar(&overWrite, "overwrite", "", "a json string to overwrite some or all of the configuration file")
+	EncodeCmd.Flags().StringVar(&umidRule, "umidRule", "newcontent", "how the UMID is derived from a previous manifest, one of new, rewrap or newcontent")
+	EncodeCmd.Flags().StringVar(&encodeLayout, "layout", "", "the layout of the input files, as a pattern e.g. {stream:int}_{type}/{frame:int}.json or gps/frame_{frame:int}.json;TC;0, or a layout json file")
+	EncodeCmd.Flags().BoolVar(&encodeCheck, "check", false, "check the input folder for issues with its layout, without encoding it")
+	EncodeCmd.Flags().BoolVar(&encodeStrict, "strict", false, "only encode the input folder if there are no issues with its layout")
+	EncodeCmd.Flags().IntVar(&encodeReadWorkers, "readWorkers", DefaultReadWorkers, "the number of files that are read at once, which is the most files that are open at once")
+	EncodeCmd.Flags().IntVar(&encodeReadAhead, "readAhead", DefaultReadAhead, "the number of frames of each stream that are read ahead of the encoder")
+	EncodeCmd.Flags().StringVar(&schemaRegistry, "schemas", "", "a schema registry folder, to check the text metadata against the schemas of their namespaces")
 
 }
 
@@ -66,9 +82,54 @@ Any manifest files that are found can be added onto the "previous" field for a n
 The manifest, carries all the metadata in the mrx file, allowing for optional data from privates sources.
 These manifest files are stored as config.json in the parent folder.
 
+If a previous manifest is found its UMID is used to derive the new UMID, using the --umidRule flag.
+- newcontent generates a new material number, with the source package referencing the original (the default)
+- rewrap keeps the material number and increments the instance number, use this when the essence is unchanged
+- new ignores the previous UMID
+
+If a schema registry folder is given with the --schemas flag, every text metadata file
+is checked against the JSON schema of the namespace of its stream, and the file is not encoded if
+any errors are found. See the validate command for how the schemas are found.
+
 Flat formats are also used where the metadata is not split up into folders,
 and instead the data stream is part of the name. e.g. 0000StreamTC01d
 
+Json sidecar files are added to the manifest, instead of being encoded.
+The sidecar of a metadata file is its name followed by .meta.json e.g. 25d.meta.json,
+and the sidecar of a stream is stream.json in the stream folder, or 0000StreamTC.stream.json
+for flat formats. A StreamContentType field of a stream sidecar is used as the stream content type.
+
+The input can also be a tar, gzipped tar or zip archive of the folder layout,
+either of the layout itself or of a single folder containing the layout.
+Tar and zip archives are read in place, gzipped tar archives are decompressed to a temporary file first.
+
+The --check flag checks the folder layout for issues, without encoding the folder.
+The --strict flag checks the folder in the same way, and only encodes it if there are no issues.
+The issues found are:
+- gap - a run of missing frames in a stream, which are encoded as empty frames
+- duplicate - more than one file for the same frame, e.g. 1d and 01d
+- unrecognised - a file or folder that is not part of the layout and is not encoded
+- mixed - a stream with more than one essence type
+- stream - a missing stream number, the streams after it are renumbered when they are encoded
+- config - StreamProperties in config.json for a stream that is not in the folder
+
+The --layout flag encodes folders that do not use the layout above, so they do not need renaming.
+The layout is a pattern of the file paths within the folder, with the placeholders of
+- {stream} or {stream:int} - the stream number
+- {type} - the essence type of TC, TE, BC or BE
+- {frame} or {frame:int} - the frame number
+e.g. {stream:int}_{type}/{frame:int}.json matches 0001_TC/000123.json.
+A pattern without a {type} or {stream} is followed by the type and stream of its files,
+separated by semicolons e.g. gps/frame_{frame:int}.json;TC;0 matches gps/frame_000123.json as stream 0.
+The stream can be left out, which is stream 0.
+Or the layout is a json file of rules, where each file is part of the first rule it matches.
+A rule gives the Stream and Type of the files when its pattern has no {stream} or {type}.
+e.g. {"Rules": [{"Pattern": "gps/frame_{frame:int}.json", "Stream": 0, "Type": "TC"}]}
+
+The files are read by a pool of --readWorkers, which is also the most files that are
+open at once, with --readAhead frames of each stream read ahead of the encoder.
+Folders on network storage with lots of streams are encoded faster with more read workers.
+
 `,
 
 	// Run interactively unless told to be batch / server
@@ -79,6 +140,9 @@ and instead the data stream is part of the name. e.g. 0000StreamTC01d
 func Encode(_ *cobra.Command, _ []string) error {
 
 	// check the input file was given
+	if encodeCheck {
+		return checkFolder()
+	}
 
 	err := inoutCheck(encodeIn, encodeOut)
 	if err != nil {
@@ -104,15 +168,49 @@ func Encode(_ *cobra.Command, _ []string) error {
 
 	var update manifest.Configuration
 	if overWrite != "" {
+		err = manifest.ConfigValidator([]byte(overWrite))
+		if err != nil {
+			return fmt.Errorf("error validating \"%s\" : %v", overWrite, err)
+		}
+
 		err = json.Unmarshal([]byte(overWrite), &update)
 		if err != nil {
 			return fmt.Errorf("error parsing \"%s\" : %v", overWrite, err)
 		}
 	}
 
-	writeMethod := &FolderScanner{ParentFolder: encodeIn}
-	mw.UpdateEncoder(writeMethod)
-	err = mw.Encode(f, &encode.MrxEncodeOptions{ManifestHistoryCount: encodeManifestCount, ConfigOverWrite: update})
+	derivation, err := encode.ParseDerivation(umidRule)
+	if err != nil {
+		return err
+	}
+
+	// the validator is only set with a registry, as
+	// a nil registry is not a nil validator
+	var validator encode.PayloadValidator
+	if schemaRegistry != "" {
+		reg, err := payload.LoadRegistry(schemaRegistry)
+		if err != nil {
+			return err
+		}
+		validator = reg
+	}
+
+	input, cleanup, err := inputFolder(encodeIn)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	layout, err := inputLayout(encodeLayout)
+	if err != nil {
+		return err
+	}
+
+	input.Strict, input.Layout = encodeStrict, layout
+	input.ReadWorkers, input.ReadAhead = encodeReadWorkers, encodeReadAhead
+	mw.UpdateEncoder(input)
+	err = mw.Encode(f, &encode.MrxEncodeOptions{ManifestHistoryCount: encodeManifestCount, ConfigOverWrite: update, Derivation: derivation,
+		PayloadValidator: validator})
 
 	if err != nil {
 		return err
@@ -122,3 +220,73 @@ func Encode(_ *cobra.Command, _ []string) error {
 
 	return nil
 }
+
+// inputFolder returns the folder scanner of the input,
+// archives are scanned without being extracted.
+func inputFolder(input string) (*FolderScanner, func(), error) {
+
+	if info, err := os.Stat(input); err == nil && !info.IsDir() {
+		fsys, folder, cleanup, err := OpenArchive(input)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return &FolderScanner{FS: fsys, ParentFolder: folder}, cleanup, nil
+	}
+
+	return &FolderScanner{ParentFolder: input}, func() {}, nil
+}
+
+// checkFolder reports the issues of the input folder, without encoding it
+func checkFolder() error {
+
+	if encodeIn == "" {
+		return fmt.Errorf("no input file chosen please use the --input flag")
+	}
+
+	input, cleanup, err := inputFolder(encodeIn)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	layout, err := inputLayout(encodeLayout)
+	if err != nil {
+		return err
+	}
+
+	input.Layout = layout
+	issues, err := input.Check()
+	if err != nil {
+		return err
+	}
+
+	if len(issues) == 0 {
+		fmt.Printf("%v has no folder layout issues\n", encodeIn)
+		return nil
+	}
+
+	out, err := yaml.Marshal(issues)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(out))
+
+	return fmt.Errorf("%v folder layout issues were found in %v", len(issues), encodeIn)
+}
+
+// inputLayout returns the layout of the input files from a
+// layout file or pattern, nil is the default layout.
+func inputLayout(layout string) (*Layout, error) {
+
+	if layout == "" {
+		return nil, nil
+	}
+
+	if info, err := os.Stat(layout); err == nil && !info.IsDir() {
+		return LoadLayout(layout)
+	}
+
+	return ParseLayout(layout)
+}
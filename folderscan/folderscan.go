@@ -2,12 +2,14 @@
 package folderscan
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
@@ -23,17 +25,45 @@ import (
 // the folder contents as an MRX.
 type FolderScanner struct {
 	ParentFolder string
-	FolLayout    *fullFolderMRX
+	// Strict returns an IssueError if there are any issues with
+	// the folder layout, instead of encoding around them. See Check
+	// for the issues that are found.
+	Strict bool
+	// Layout is the layout of the files, instead of the default
+	// 0000StreamTC/12d and 0000StreamTC12d layouts.
+	Layout *Layout
+	// FS is the file system the parent folder is in, where the
+	// parent folder is a slash separated path of the file system.
+	// If FS is nil the parent folder is a folder on disk.
+	FS fs.FS
+	// ReadWorkers is the number of files that are read at once,
+	// DefaultReadWorkers is used if it is not set.
+	ReadWorkers int
+	// ReadAhead is the number of frames of each stream that are read
+	// ahead of the encoder, DefaultReadAhead is used if it is not set.
+	ReadAhead int
+	FolLayout *fullFolderMRX
 }
 
 // GetStreamInformation finds the number of channels and their MRX keys to be saved
 func (f *FolderScanner) GetStreamInformation() (encode.StreamInformation, error) {
-	folderLayout, err := folderScan(f.ParentFolder)
+	folderLayout, err := f.scan(f.Strict)
 
 	if err != nil {
 		return encode.StreamInformation{}, err
 	}
 
+	if f.Strict {
+		round, err := f.GetRoundTrip()
+		if err != nil {
+			return encode.StreamInformation{}, err
+		}
+
+		if issues := folderLayout.check(round.Config); len(issues) > 0 {
+			return encode.StreamInformation{}, &IssueError{Issues: issues}
+		}
+	}
+
 	// essenceKeys := folderLayout.foundEssence
 
 	f.FolLayout = &folderLayout
@@ -53,14 +83,22 @@ func (f *FolderScanner) GetStreamInformation() (encode.StreamInformation, error)
 // GetRoundTrip gets the configuration and a manifest.
 // It searches the parent folder for a config.json file,
 // if the file is not found then it is not used.
-// The config.json must be of type encode.Roundtrip
+// The config.json must be of type encode.Roundtrip, and the
+// configuration is validated against the configuration schema.
 func (f *FolderScanner) GetRoundTrip() (*manifest.RoundTrip, error) {
 
 	var configBody manifest.RoundTrip
 
-	roundBytes, err := os.ReadFile(f.ParentFolder + osSeperator + "config.json")
+	folder := f.folder()
+	roundBytes, err := fs.ReadFile(folder.fsys, folder.join("config.json"))
 
 	if err == nil {
+		// only the configuration is checked, as the manifest
+		// may have been written by an earlier version
+		err = manifest.RoundTripValidator(roundBytes, false)
+		if err != nil {
+			return nil, fmt.Errorf("error validating config.json: %v", err)
+		}
 
 		err := json.Unmarshal(roundBytes, &configBody)
 		return &configBody, err
@@ -70,82 +108,57 @@ func (f *FolderScanner) GetRoundTrip() (*manifest.RoundTrip, error) {
 }
 
 // EssenceChannels extracts the essence from the files, it then sends one data
-// stream (in numerical order) to the writer channel.
+// stream (in numerical order) to the writer channel. The files are read
+// by a pool of ReadWorkers, with ReadAhead frames of each stream read ahead
+// of the frames being encoded.
 func (f *FolderScanner) EssenceChannels(essChan chan *encode.ChannelPackets) error {
 
 	// close the channels once they've been written to
 	defer close(essChan)
 
 	keys := orderKeys(f.FolLayout.streams)
-	errs, _ := errgroup.WithContext(context.Background())
-	//	for _, partition := range f.flay.folders {
-
-	// loop through the folders
-	for keyPos := range keys {
+	folder := f.folder()
 
-		streamKey := keys[keyPos]
-
-		dataTrain := make(chan *encode.DataCarriage, 10)
-		mrxData := encode.ChannelPackets{Packets: dataTrain}
-
-		essChan <- &mrxData
-
-		errs.Go(func() error {
-
-			stream := f.FolLayout.streams[streamKey]
-			// pKeys := orderKeys(stream.contents)
-
-			err := func() error {
-
-				// sent := false
-				// set up partiton packet
-				// only use the partition packe tif manifest data is not found
-
-				defer func() {
-					// cose the data once the writing has finished
-					close(dataTrain)
-				}()
+	// the stream properties are found before any data is read
+	commonInformation := make([]manifest.GroupProperties, len(keys))
+	for i, streamKey := range keys {
+		var err error
+		commonInformation[i], err = f.FolLayout.streams[streamKey].groupProperties(folder)
+		if err != nil {
+			return err
+		}
+	}
 
-				for i := 0; i <= stream.max; i++ {
-					// for _, pKey := range pKeys {
+	errs, ctx := errgroup.WithContext(context.Background())
+	pool := newReadPool(f.ReadWorkers)
+	defer pool.close()
 
-					ess, ok := stream.contents[i]
+	// loop through the folders
+	for i, streamKey := range keys {
 
-					// @TODO handle the manifest in a new way
-					commonInformation := manifest.GroupProperties{}
-					//	pcKeys := orderKeys(partition.contents)
+		stream := f.FolLayout.streams[streamKey]
 
-					//	for _, pcKey := range pcKeys {
-					// ess := partition.contents[pcKey]
+		// the frames are buffered by the read ahead
+		dataTrain := make(chan *encode.DataCarriage)
+		mrxData := encode.ChannelPackets{Packets: dataTrain, OverViewData: commonInformation[i]}
 
-					// extract the klvs
+		essChan <- &mrxData
 
-					var carriage *encode.DataCarriage
-					var err error
+		frames, read := stream.readAhead(ctx, pool, folder, f.ReadAhead)
+		errs.Go(read)
 
-					// if data has been missed out form the folder then empty data is sent
-					// so that the frame placement of the data is preserved.
-					if !ok {
-						carriage = &encode.DataCarriage{}
-					} else {
-						carriage, err = essExtract(ess.fullLocation)
-					}
-					// fmt.Println(err)
-					if err != nil {
-						return err
-					}
-					commonInformation.StreamType = stream.partitionTypeHuman
+		errs.Go(func() error {
 
-					dataTrain <- carriage
-					mrxData.OverViewData = commonInformation
+			// cose the data once the writing has finished
+			defer close(dataTrain)
 
+			for result := range frames {
+				frame := <-result
+				if frame.err != nil {
+					return frame.err
 				}
 
-				return nil
-			}()
-
-			if err != nil {
-				return err
+				dataTrain <- frame.carriage
 			}
 
 			return nil
@@ -170,31 +183,61 @@ func orderKeys[T any](long map[int]T) []int {
 }
 
 // essExtract extracts the data, along with any accompanying metadata.
-func essExtract(essenceFile string) (*encode.DataCarriage, error) {
+func essExtract(folder scanFolder, ess essenceMRX) (*encode.DataCarriage, error) {
 
-	essFile, err := os.Open(essenceFile)
+	essData, fInfo, err := readEssence(folder, ess.fullLocation)
 	if err != nil {
-		return nil, fmt.Errorf("error extracting data to encode from %v:%v", essenceFile, err)
+		return nil, err
 	}
 
-	fInfo, err := essFile.Stat()
+	has := sha256.New()
+	has.Write(essData)
+
+	// the sidecar is read once the file is closed,
+	// so only one file is open at a time
+	customMeta, err := frameMetadata(folder, ess.sidecar)
 	if err != nil {
-		return nil, fmt.Errorf("error extracting file information from %v:%v", essenceFile, err)
+		return nil, err
 	}
 
-	essData := make([]byte, fInfo.Size())
-	_, err = essFile.Read(essData)
+	// dataKLV := klv.KLV{Key: []byte(folderType), Length: length, Value: }
+	metadata := manifest.EssenceProperties{EditDate: fInfo.ModTime().String(), Hash: fmt.Sprintf("%64x", has.Sum(nil)), DataOrigin: folder.location(ess.fullLocation), CustomMeta: customMeta}
+
+	return &encode.DataCarriage{Data: &essData, MetaData: &metadata}, nil
+}
+
+// readEssence reads the whole of a file, the file is read until it
+// ends so reads that return part of the file are handled.
+func readEssence(folder scanFolder, name string) ([]byte, fs.FileInfo, error) {
+
+	essenceFile := folder.location(name)
+	essFile, err := folder.fsys.Open(name)
 	if err != nil {
-		return nil, fmt.Errorf("error extracting data to encode from %v:%v", essenceFile, err)
+		return nil, nil, fmt.Errorf("error extracting data to encode from %v:%v", essenceFile, err)
 	}
+	defer essFile.Close()
 
+	fInfo, err := essFile.Stat()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error extracting file information from %v:%v", essenceFile, err)
+	}
+
+	// the size is only a guide, as files can change while they are read
+	essData := bytes.NewBuffer(make([]byte, 0, fInfo.Size()+bytes.MinRead))
+	if _, err := essData.ReadFrom(essFile); err != nil {
+		return nil, nil, fmt.Errorf("error extracting data to encode from %v:%v", essenceFile, err)
+	}
+
+	return essData.Bytes(), fInfo, nil
+}
+
+// emptyCarriage is the data sent for a frame that is missing from the folder
+func emptyCarriage() *encode.DataCarriage {
+	essData := []byte{}
 	has := sha256.New()
 	has.Write(essData)
 
-	// dataKLV := klv.KLV{Key: []byte(folderType), Length: length, Value: }
-	metadata := manifest.EssenceProperties{EditDate: fInfo.ModTime().String(), Hash: fmt.Sprintf("%64x", has.Sum(nil)), DataOrigin: essenceFile}
-
-	return &encode.DataCarriage{Data: &essData, MetaData: &metadata}, nil
+	return &encode.DataCarriage{Data: &essData, MetaData: &manifest.EssenceProperties{Hash: fmt.Sprintf("%64x", has.Sum(nil))}}
 }
 
 // the folder is built up of a map of streams, partitions then their essence
@@ -202,6 +245,15 @@ func essExtract(essenceFile string) (*encode.DataCarriage, error) {
 type fullFolderMRX struct {
 	streams      map[int]*partition // []folderMRX
 	foundEssence []encode.EssenceKey
+
+	// strict records the issues that would
+	// otherwise stop the scan, with the rest of the issues
+	strict bool
+	issues []Issue
+
+	// sidecars are the frame sidecar files found in the
+	// scan, so only the sidecars that exist are read
+	sidecars map[string]bool
 }
 
 type partition struct {
@@ -211,6 +263,8 @@ type partition struct {
 	partitionTypeHuman string
 	// @TODO update essence container to map[int]map[int]essenceMRX
 	contents map[int]essenceMRX
+	// sidecar is the stream sidecar file, which may not exist
+	sidecar string
 	// Max is the maximum document position
 	// this is used for the decoding later
 	max int
@@ -222,8 +276,12 @@ type partition struct {
 }*/
 
 type essenceMRX struct {
-	key          encode.EssenceKey
+	key encode.EssenceKey
+	// fullLocation is the path of the file in the scanned file system
 	fullLocation string
+	// sidecar is the path of the frame sidecar, it is
+	// empty if the file does not have a sidecar
+	sidecar string
 }
 
 // folder order rege
@@ -233,20 +291,94 @@ var streamFol = regexp.MustCompile(`^\d{4}stream((tc)|(te)|(bc)|(be))$`)
 // var flatBodyStructure = regexp.MustCompile(`^\d{4}stream\d{4}((mrxip)|(header))`)
 var flatBodyStructure = regexp.MustCompile(`^\d{4}stream((tc)|(te)|(bc)|(be))\d{1,}d`)
 
-// osSeperator stringfys the os.Separator to prevent repetetive code
-var osSeperator = string(os.PathSeparator)
+// scanFolder is the folder of a file system that is scanned
+type scanFolder struct {
+	fsys fs.FS
+	// root is the path of the folder in fsys
+	root string
+	// disk is the folder on disk that fsys is, it is
+	// empty if the file system is not on disk
+	disk string
+}
+
+// folder returns the folder to be scanned
+func (f *FolderScanner) folder() scanFolder {
+
+	if f.FS != nil {
+		root := path.Clean(filepath.ToSlash(f.ParentFolder))
+		if f.ParentFolder == "" {
+			root = "."
+		}
+
+		return scanFolder{fsys: f.FS, root: root}
+	}
+
+	disk, _ := filepath.Abs(f.ParentFolder)
+
+	return scanFolder{fsys: diskFS(disk), root: ".", disk: disk}
+}
+
+// join returns the path of the elements in the folder
+func (s scanFolder) join(elem ...string) string {
+	return path.Join(append([]string{s.root}, elem...)...)
+}
+
+// location returns where a path of the file system is, which
+// is the path on disk for folders on disk.
+func (s scanFolder) location(name string) string {
+	if s.disk == "" {
+		return name
+	}
+
+	return filepath.Join(s.disk, filepath.FromSlash(name))
+}
+
+// diskFS is a folder on disk, unlike os.DirFS the
+// errors are given with the full path of the files.
+type diskFS string
+
+func (d diskFS) Open(name string) (fs.File, error) {
+	return os.Open(filepath.Join(string(d), filepath.FromSlash(name)))
+}
+
+func (d diskFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(filepath.Join(string(d), filepath.FromSlash(name)))
+}
+
+func (d diskFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(d), filepath.FromSlash(name)))
+}
+
+// scan scans the folder with its layout
+func (f *FolderScanner) scan(strict bool) (fullFolderMRX, error) {
+
+	scanner := folderScan
+	if f.Layout != nil {
+		scanner = func(folder scanFolder, strict bool) (fullFolderMRX, error) {
+			return layoutScan(folder, f.Layout, strict)
+		}
+	}
+
+	folderLayout, err := scanner(f.folder(), strict)
+	if err != nil {
+		return fullFolderMRX{}, err
+	}
+
+	folderLayout.linkSidecars()
+
+	return folderLayout, nil
+}
 
 // folderScan returns the folders and contents that contain essence to be
 // wrapped when an mrx file is generated
-func folderScan(folder string) (fullFolderMRX, error) {
-	folder, _ = filepath.Abs(folder)
-	folders, err := os.ReadDir(folder)
+func folderScan(folder scanFolder, strict bool) (fullFolderMRX, error) {
+	folders, err := fs.ReadDir(folder.fsys, folder.root)
 
 	if err != nil {
-		return fullFolderMRX{}, fmt.Errorf("error reading folder %v : %v", folder, err)
+		return fullFolderMRX{}, fmt.Errorf("error reading folder %v : %v", folder.location(folder.root), err)
 	}
 
-	folderLayout := fullFolderMRX{streams: make(map[int]*partition)}
+	folderLayout := fullFolderMRX{streams: make(map[int]*partition), strict: strict}
 
 	for _, fold := range folders {
 
@@ -272,10 +404,20 @@ func folderScan(folder string) (fullFolderMRX, error) {
 	return folderLayout, nil
 }
 
-func fileExtract(fold fs.DirEntry, essenceFile *fullFolderMRX, parentFolder string) error {
+func fileExtract(fold fs.DirEntry, essenceFile *fullFolderMRX, parentFolder scanFolder) error {
 
 	folname := strings.ToLower(fold.Name())
 
+	// sidecars are read when the essence is extracted
+	if isFrameSidecar(folname, flatBodyStructure.MatchString) {
+		essenceFile.addSidecar(parentFolder.join(fold.Name()))
+		return nil
+	}
+
+	if flatStreamSidecarName.MatchString(folname) {
+		return nil
+	}
+
 	if flatBodyStructure.MatchString(folname) {
 		streamPos := 0
 
@@ -289,7 +431,8 @@ func fileExtract(fold fs.DirEntry, essenceFile *fullFolderMRX, parentFolder stri
 
 		// prevent nil errors in the stream layout
 		if _, ok := essenceFile.streams[streamPos]; !ok {
-			essenceFile.streams[streamPos] = &partition{contents: make(map[int]essenceMRX), partitionType: essKey, partitionTypeHuman: essString}
+			essenceFile.streams[streamPos] = &partition{contents: make(map[int]essenceMRX), partitionType: essKey, partitionTypeHuman: essString,
+				sidecar: parentFolder.join(fold.Name()[:12] + flatStreamSidecar)}
 			// only add the file type on the fist version
 			essenceFile.foundEssence = append(essenceFile.foundEssence, essKey)
 		}
@@ -305,30 +448,33 @@ func fileExtract(fold fs.DirEntry, essenceFile *fullFolderMRX, parentFolder stri
 		if essenceFile.streams[streamPos].partitionType == 0 {
 			essenceFile.streams[streamPos].partitionType = essKey
 		} else if essenceFile.streams[streamPos].partitionType != essKey {
-			return fmt.Errorf("mixed essence file types found in %v, please ensure they are all the same type", parentFolder)
+			if !essenceFile.strict {
+				return fmt.Errorf("mixed essence file types found in %v, please ensure they are all the same type", parentFolder.location(parentFolder.root))
+			}
+
+			essenceFile.mixed(streamPos, parentFolder.join(fold.Name()))
+
+			return nil
 		}
 
-		ess := essenceMRX{fullLocation: parentFolder + osSeperator + fold.Name(), key: essKey}
+		ess := essenceMRX{fullLocation: parentFolder.join(fold.Name()), key: essKey}
 		// get the essence position
 		essencePos := 0
 		_, err = fmt.Sscanf(folname[12:], "%dd", &essencePos)
 		if err != nil {
 			return fmt.Errorf("error extracting essence position from file %s: %v", folname, err)
 		}
-		// @TODO check for duplicate essence as a safety barrier
-
-		if essencePos > essenceFile.streams[streamPos].max {
-			essenceFile.streams[streamPos].max = essencePos
-		}
 
-		essenceFile.streams[streamPos].contents[essencePos] = ess
+		essenceFile.addEssence(streamPos, essencePos, ess)
 
+	} else if folname != "config.json" {
+		essenceFile.unrecognised(parentFolder.join(fold.Name()))
 	}
 
 	return nil
 }
 
-func folderExtract(fold fs.DirEntry, essenceFolder *fullFolderMRX, parentFolder string) error {
+func folderExtract(fold fs.DirEntry, essenceFolder *fullFolderMRX, parentFolder scanFolder) error {
 
 	folname := strings.ToLower(fold.Name())
 
@@ -341,13 +487,17 @@ func folderExtract(fold fs.DirEntry, essenceFolder *fullFolderMRX, parentFolder
 
 		key, humanKey := essKeyTypeExtract(folname[10:])
 
+		strFol := parentFolder.join(fold.Name())
 		if _, ok := essenceFolder.streams[streamPos]; !ok {
-			essenceFolder.streams[streamPos] = &partition{contents: make(map[int]essenceMRX), partitionType: key, partitionTypeHuman: humanKey}
+			essenceFolder.streams[streamPos] = &partition{contents: make(map[int]essenceMRX), partitionType: key, partitionTypeHuman: humanKey,
+				sidecar: path.Join(strFol, streamSidecar)}
+		} else if essenceFolder.streams[streamPos].partitionType != key {
+			essenceFolder.mixed(streamPos, strFol)
 		}
-		strFol := parentFolder + osSeperator + fold.Name()
-		streamFolders, err := os.ReadDir(strFol)
+
+		streamFolders, err := fs.ReadDir(parentFolder.fsys, strFol)
 		if err != nil {
-			return fmt.Errorf("error reading folder %v : %v", parentFolder, err)
+			return fmt.Errorf("error reading folder %v : %v", parentFolder.location(parentFolder.root), err)
 		}
 
 		// ASSIGN the information here
@@ -356,7 +506,7 @@ func folderExtract(fold fs.DirEntry, essenceFolder *fullFolderMRX, parentFolder
 
 			strName := strFile.Name()
 			if allBody.MatchString(strName) { // bodyFol.MatchString(folname) || headerFol.MatchString(folname) {
-				filFol := strFol + osSeperator + strFile.Name()
+				filFol := path.Join(strFol, strFile.Name())
 
 				contentPosition := 0
 				_, err := fmt.Sscanf(strFile.Name(), "%dd", &contentPosition)
@@ -364,20 +514,18 @@ func folderExtract(fold fs.DirEntry, essenceFolder *fullFolderMRX, parentFolder
 					return fmt.Errorf("error extracting essence position from file %s: %v", folname, err)
 				}
 
-				if contentPosition > essenceFolder.streams[streamPos].max {
-					essenceFolder.streams[streamPos].max = contentPosition
-				}
-
-				essenceFolder.streams[streamPos].contents[contentPosition] = essenceMRX{fullLocation: filFol, key: key}
-
-				// check if the essence key has already been added
-
-				//	}
+				essenceFolder.addEssence(streamPos, contentPosition, essenceMRX{fullLocation: filFol, key: key})
 
+			} else if isFrameSidecar(strName, allBody.MatchString) {
+				essenceFolder.addSidecar(path.Join(strFol, strName))
+			} else if strName != streamSidecar {
+				essenceFolder.unrecognised(path.Join(strFol, strName))
 			}
 		}
 		// essenceFolder.foundEssence = append(essenceFolder.foundEssence, essKey)
 
+	} else {
+		essenceFolder.unrecognised(parentFolder.join(fold.Name()))
 	}
 
 	return nil
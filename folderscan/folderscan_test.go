@@ -1,14 +1,24 @@
 package folderscan
 
 import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"syscall"
 	"testing"
+	"testing/fstest"
 
 	"github.com/cbroglie/mustache"
+	"github.com/metarex-media/mrx-tool/decode"
 	"github.com/metarex-media/mrx-tool/encode"
+	"github.com/metarex-media/mrx-tool/manifest"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -138,3 +148,545 @@ func TestEncodeErrors(t *testing.T) {
 	})
 
 }
+
+func TestMissingFrames(t *testing.T) {
+
+	// frames 2 and 3 are missing from the folder
+	missing := t.TempDir()
+	for _, frame := range []int{0, 1, 4} {
+		os.WriteFile(filepath.Join(missing, fmt.Sprintf("0000StreamTC%04dd", frame)), []byte(`{"frame": 1}`), 0644)
+	}
+
+	var mrx bytes.Buffer
+	mw := encode.NewMRXWriter()
+	mw.UpdateEncoder(&FolderScanner{ParentFolder: missing})
+	encodeErr := mw.Encode(&mrx, &encode.MrxEncodeOptions{})
+
+	streams, extractErr := decode.ExtractStreamData(bytes.NewReader(mrx.Bytes()))
+
+	Convey("Checking folders with missing frames are encoded", t, func() {
+		Convey("using a folder of clocked text, where two frames are missing", func() {
+			Convey("the missing frames are encoded as empty data, preserving the frame placement", func() {
+				So(encodeErr, ShouldBeNil)
+				So(extractErr, ShouldBeNil)
+				So(len(streams[0].Data), ShouldEqual, 5)
+				So(streams[0].Data[2], ShouldBeEmpty)
+				So(streams[0].Data[3], ShouldBeEmpty)
+				So(string(streams[0].Data[4]), ShouldEqual, `{"frame": 1}`)
+			})
+		})
+	})
+}
+
+func TestArchiveEncode(t *testing.T) {
+
+	encodeScanner := func(scanner *FolderScanner) ([]*decode.DataFormat, error) {
+		var mrx bytes.Buffer
+		mw := encode.NewMRXWriter()
+		mw.UpdateEncoder(scanner)
+		if err := mw.Encode(&mrx, &encode.MrxEncodeOptions{}); err != nil {
+			return nil, err
+		}
+
+		return essenceStreams(decode.ExtractStreamData(bytes.NewReader(mrx.Bytes())))
+	}
+
+	// the folder encoded as an mrx file, then extracted as archives
+	var mrx bytes.Buffer
+	mw := encode.NewMRXWriter()
+	mw.UpdateEncoder(&FolderScanner{ParentFolder: "./testdata/testbase"})
+	encodeErr := mw.Encode(&mrx, &encode.MrxEncodeOptions{})
+	expected, expectedErr := essenceStreams(decode.ExtractStreamData(bytes.NewReader(mrx.Bytes())))
+
+	archives := t.TempDir()
+	// gzipped archives are decompressed to the temporary folder
+	spool := t.TempDir()
+	t.Setenv("TMPDIR", spool)
+	for _, format := range []string{decode.ArchiveTar, "tar.gz", decode.ArchiveZip} {
+		var archive bytes.Buffer
+		archiveErr := decode.ExtractEssenceArchive(bytes.NewReader(mrx.Bytes()), &archive, strings.TrimSuffix(format, ".gz"), decode.ExtractOptions{LeadingZeros: 4})
+		archiveBytes := archive.Bytes()
+		if strings.HasSuffix(format, ".gz") {
+			var gzipped bytes.Buffer
+			gw := gzip.NewWriter(&gzipped)
+			gw.Write(archiveBytes)
+			gw.Close()
+			archiveBytes = gzipped.Bytes()
+		}
+		archivePath := filepath.Join(archives, "layout."+format)
+		os.WriteFile(archivePath, archiveBytes, 0644)
+
+		fsys, folder, cleanup, openErr := OpenArchive(archivePath)
+		streams, streamErr := encodeScanner(&FolderScanner{FS: fsys, ParentFolder: folder})
+		cleanup()
+		spooled, _ := os.ReadDir(spool)
+
+		Convey("Checking an archive of a folder layout can be encoded", t, func() {
+			Convey(fmt.Sprintf("using a %v archive of an extracted mrx file", format), func() {
+				Convey("the archive is encoded with the same essence as the original folder, without being extracted", func() {
+					So(encodeErr, ShouldBeNil)
+					So(expectedErr, ShouldBeNil)
+					So(archiveErr, ShouldBeNil)
+					So(openErr, ShouldBeNil)
+					So(streamErr, ShouldBeNil)
+					So(len(expected), ShouldEqual, 4)
+					So(streams, ShouldResemble, expected)
+					// nothing is left once the archive is closed
+					So(spooled, ShouldBeEmpty)
+				})
+			})
+		})
+	}
+
+	// an archive with a file outside of the archive folder
+	var escape bytes.Buffer
+	zw := zip.NewWriter(&escape)
+	escapeFile, _ := zw.Create("../0000StreamTC0000d")
+	escapeFile.Write([]byte(`{}`))
+	zw.Close()
+	escapePath := filepath.Join(archives, "escape.zip")
+	os.WriteFile(escapePath, escape.Bytes(), 0644)
+	_, _, _, escapeErr := OpenArchive(escapePath)
+
+	notArchive := filepath.Join(archives, "notes.txt")
+	os.WriteFile(notArchive, []byte("not an archive"), 0644)
+	_, _, _, notArchiveErr := OpenArchive(notArchive)
+
+	Convey("Checking invalid archives are not opened", t, func() {
+		Convey("using a zip with a file outside the archive, and a text file", func() {
+			Convey("an error is returned for each file", func() {
+				So(escapeErr, ShouldResemble, fmt.Errorf("error opening %v: the archive file ../0000StreamTC0000d is not within the archive", escapePath))
+				So(notArchiveErr, ShouldResemble, fmt.Errorf("error opening %v: the input is not a folder, tar or zip archive", notArchive))
+			})
+		})
+	})
+}
+
+// essenceStreams removes the manifest from the streams, as
+// every encode has a new manifest
+func essenceStreams(streams []*decode.DataFormat, err error) ([]*decode.DataFormat, error) {
+	essence := make([]*decode.DataFormat, 0, len(streams))
+	for _, stream := range streams {
+		if stream.EssenceType != "manifest" {
+			essence = append(essence, stream)
+		}
+	}
+
+	return essence, err
+}
+
+func TestFSEncode(t *testing.T) {
+
+	frames := [][]byte{[]byte(`{"frame": 0}`), []byte(`{"frame": 1}`), []byte(`<frame>2</frame>`)}
+
+	// the same layout in memory and on disk
+	memory := fstest.MapFS{}
+	disk := t.TempDir()
+	for i, frame := range frames {
+		name := fmt.Sprintf("layout/0000StreamTC/%04dd", i)
+		memory[name] = &fstest.MapFile{Data: frame}
+		os.MkdirAll(filepath.Join(disk, "0000StreamTC"), 0777)
+		os.WriteFile(filepath.Join(disk, "0000StreamTC", fmt.Sprintf("%04dd", i)), frame, 0644)
+	}
+	memory["layout/0001StreamBC0000d"] = &fstest.MapFile{Data: []byte{0, 1, 2}}
+	os.WriteFile(filepath.Join(disk, "0001StreamBC0000d"), []byte{0, 1, 2}, 0644)
+
+	encodeScanner := func(scanner *FolderScanner) ([]byte, error) {
+		var mrx bytes.Buffer
+		mw := encode.NewMRXWriter()
+		mw.UpdateEncoder(scanner)
+		err := mw.Encode(&mrx, &encode.MrxEncodeOptions{})
+
+		return mrx.Bytes(), err
+	}
+
+	diskMRX, diskErr := encodeScanner(&FolderScanner{ParentFolder: disk})
+	expected, expectedErr := essenceStreams(decode.ExtractStreamData(bytes.NewReader(diskMRX)))
+
+	memoryMRX, memoryErr := encodeScanner(&FolderScanner{FS: memory, ParentFolder: "layout"})
+	memoryStreams, memoryStreamErr := essenceStreams(decode.ExtractStreamData(bytes.NewReader(memoryMRX)))
+
+	// the manifest has where each file came from
+	var round manifest.RoundTrip
+	allStreams, _ := decode.ExtractStreamData(bytes.NewReader(memoryMRX))
+	manifestErr := json.Unmarshal(allStreams[len(allStreams)-1].Data[0], &round)
+
+	// a zip archive of the extracted file, read without extracting it
+	var archive bytes.Buffer
+	archiveErr := decode.ExtractEssenceArchive(bytes.NewReader(diskMRX), &archive, decode.ArchiveZip, decode.ExtractOptions{LeadingZeros: 4})
+	zipped, zipErr := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	var zipStreams []*decode.DataFormat
+	var zipEncodeErr, zipStreamErr error
+	if zipErr == nil {
+		var zipMRX []byte
+		zipMRX, zipEncodeErr = encodeScanner(&FolderScanner{FS: zipped})
+		zipStreams, zipStreamErr = essenceStreams(decode.ExtractStreamData(bytes.NewReader(zipMRX)))
+	}
+
+	_, missingErr := (&FolderScanner{FS: memory, ParentFolder: "missing"}).GetStreamInformation()
+
+	Convey("Checking folder layouts are encoded from any file system", t, func() {
+		Convey("using a layout in memory and a zip archive, compared to the layout on disk", func() {
+			Convey("the essence is the same, with the file system paths as the data origin", func() {
+				So(diskErr, ShouldBeNil)
+				So(expectedErr, ShouldBeNil)
+				So(len(expected), ShouldEqual, 2)
+				So(memoryErr, ShouldBeNil)
+				So(memoryStreamErr, ShouldBeNil)
+				So(memoryStreams, ShouldResemble, expected)
+				So(manifestErr, ShouldBeNil)
+				So(round.Manifest.DataStreams[0].Essence[2].DataOrigin, ShouldEqual, "layout/0000StreamTC/0002d")
+				So(archiveErr, ShouldBeNil)
+				So(zipErr, ShouldBeNil)
+				So(zipEncodeErr, ShouldBeNil)
+				So(zipStreamErr, ShouldBeNil)
+				So(zipStreams, ShouldResemble, expected)
+			})
+		})
+		Convey("using a folder that is not in the file system", func() {
+			Convey("an error is returned with the path of the folder", func() {
+				So(missingErr, ShouldResemble, fmt.Errorf("error reading folder missing : %v", &fs.PathError{Op: "open", Path: "missing", Err: fs.ErrNotExist}))
+			})
+		})
+	})
+}
+
+func TestFolderCheck(t *testing.T) {
+
+	frame := &fstest.MapFile{Data: []byte(`{"frame": 0}`)}
+	messy := fstest.MapFS{
+		"config.json":       &fstest.MapFile{Data: []byte(`{"Configuration":{"MRXVersion":"pre alpha","StreamProperties":{"4":{"FrameRate":"24/1"}}}}`)},
+		".DS_Store":         frame,
+		"0000StreamTC/0d":   frame,
+		"0000StreamTC/1d":   frame,
+		"0000StreamTC/01d":  frame,
+		"0000StreamTC/4d":   frame,
+		"0000StreamTC/x.md": frame,
+		"0000StreamBC/5d":   frame,
+		"0002StreamTE0000d": frame,
+		"0002StreamTE/0d":   frame,
+	}
+
+	issues, checkErr := (&FolderScanner{FS: messy}).Check()
+	_, strictErr := (&FolderScanner{FS: messy, Strict: true}).GetStreamInformation()
+	_, looseErr := (&FolderScanner{FS: messy}).GetStreamInformation()
+
+	clean := fstest.MapFS{"0000StreamTC/0d": frame, "0000StreamTC/1d": frame, "0001StreamBC0d": frame}
+	cleanIssues, cleanErr := (&FolderScanner{FS: clean}).Check()
+	_, cleanStrictErr := (&FolderScanner{FS: clean, Strict: true}).GetStreamInformation()
+
+	expected := []Issue{
+		{Kind: IssueUnrecognised, Stream: -1, Frame: -1, File: ".DS_Store", Description: ".DS_Store is not part of the folder layout, so is not encoded"},
+		{Kind: IssueMixed, Stream: 0, Frame: -1, File: "0000StreamTC", Description: "0000StreamTC is a different essence type to the rest of stream 0"},
+		{Kind: IssueDuplicate, Stream: 0, Frame: 1, File: "0000StreamTC/1d", Description: "0000StreamTC/01d and 0000StreamTC/1d are both frame 1 of stream 0"},
+		{Kind: IssueUnrecognised, Stream: -1, Frame: -1, File: "0000StreamTC/x.md", Description: "0000StreamTC/x.md is not part of the folder layout, so is not encoded"},
+		{Kind: IssueDuplicate, Stream: 2, Frame: 0, File: "0002StreamTE0000d", Description: "0002StreamTE/0d and 0002StreamTE0000d are both frame 0 of stream 2"},
+		{Kind: IssueGap, Stream: 0, Frame: 2, Description: "stream 0 is missing frames 2 to 3, they are encoded as empty frames"},
+		{Kind: IssueStreamID, Stream: 1, Frame: -1, Description: "there is no stream 1, so the streams after it are renumbered from 1 when they are encoded"},
+		{Kind: IssueConfig, Stream: 4, Frame: -1, File: "config.json", Description: "config.json has StreamProperties for stream 4, which is not in the folder"},
+	}
+
+	Convey("Checking the issues of a folder layout are found", t, func() {
+		Convey("using a folder with stray files, duplicates, gaps, mixed types and missing streams", func() {
+			Convey("every issue is reported, and a strict scan returns them as an error", func() {
+				So(checkErr, ShouldBeNil)
+				So(issues, ShouldResemble, expected)
+				So(strictErr, ShouldResemble, &IssueError{Issues: expected})
+				So(looseErr, ShouldBeNil)
+			})
+		})
+		Convey("using a folder without any issues", func() {
+			Convey("no issues are reported", func() {
+				So(cleanErr, ShouldBeNil)
+				So(cleanIssues, ShouldBeEmpty)
+				So(cleanStrictErr, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestLayoutPatterns(t *testing.T) {
+
+	text := &fstest.MapFile{Data: []byte(`{"frame": 0}`)}
+	binary := &fstest.MapFile{Data: []byte{0, 1, 2}}
+
+	// the default layout that the other layouts should match
+	defaultLayout := fstest.MapFS{"0000StreamTC/0d": text, "0000StreamTC/2d": text, "0001StreamBC/0d": binary, "0001StreamBC/1d": binary}
+	// a layout with the stream and type in the folder name
+	patterned := fstest.MapFS{"0000_tc/0.json": text, "0000_tc/2.json": text, "1_BC/000.json": binary, "1_BC/001.json": binary}
+	// a sensor dump, with the stream and type given by the rules
+	capture := fstest.MapFS{"gps/frame_000000.json": text, "gps/frame_000002.json": text,
+		"cam/img_0.raw": binary, "cam/img_1.raw": binary, "cam/notes.txt": text}
+
+	encodeLayout := func(fsys fs.FS, layout *Layout) ([]*decode.DataFormat, error) {
+		var mrx bytes.Buffer
+		mw := encode.NewMRXWriter()
+		mw.UpdateEncoder(&FolderScanner{FS: fsys, Layout: layout})
+		if err := mw.Encode(&mrx, &encode.MrxEncodeOptions{}); err != nil {
+			return nil, err
+		}
+
+		return essenceStreams(decode.ExtractStreamData(bytes.NewReader(mrx.Bytes())))
+	}
+
+	expected, expectedErr := encodeLayout(defaultLayout, nil)
+
+	pattern, patternErr := ParseLayout("{stream:int}_{type}/{frame:int}.json")
+	patternStreams, patternStreamErr := encodeLayout(patterned, pattern)
+
+	layoutFile := filepath.Join(t.TempDir(), "layout.json")
+	os.WriteFile(layoutFile, []byte(`{"Rules": [{"Pattern": "gps/frame_{frame:int}.json", "Type": "TC"},
+		{"Pattern": "cam/img_{frame}.raw", "Stream": 1, "Type": "BC"}]}`), 0644)
+	rules, rulesErr := LoadLayout(layoutFile)
+	ruleStreams, ruleStreamErr := encodeLayout(capture, rules)
+	issues, checkErr := (&FolderScanner{FS: capture, Layout: rules}).Check()
+
+	// the type and stream of a pattern are given after it
+	typed, typedErr := ParseLayout("gps/frame_{frame:int}.json;TC;0")
+	typedStreams, typedStreamErr := encodeLayout(capture, typed)
+
+	_, noFrameErr := ParseLayout("{stream}_{type}.json")
+	_, unknownErr := ParseLayout("{stream}/{frame}.{ext}")
+	_, twiceErr := ParseLayout("{frame}/{frame}_{type}")
+	_, noTypeErr := ParseLayout("frame_{frame}.json")
+	_, badStreamErr := ParseLayout("frame_{frame}.json;TC;first")
+	_, extraErr := ParseLayout("frame_{frame}.json;TC;0;1")
+
+	Convey("Checking folders are encoded with layout patterns", t, func() {
+		Convey("using a pattern and a layout file of rules, instead of the default layout", func() {
+			Convey("the essence is the same as the default layout, with unmatched files reported", func() {
+				So(expectedErr, ShouldBeNil)
+				So(len(expected), ShouldEqual, 2)
+				So(patternErr, ShouldBeNil)
+				So(patternStreamErr, ShouldBeNil)
+				So(patternStreams, ShouldResemble, expected)
+				So(rulesErr, ShouldBeNil)
+				So(ruleStreamErr, ShouldBeNil)
+				So(ruleStreams, ShouldResemble, expected)
+				So(checkErr, ShouldBeNil)
+				So(issues, ShouldResemble, []Issue{
+					{Kind: IssueUnrecognised, Stream: -1, Frame: -1, File: "cam/notes.txt", Description: "cam/notes.txt is not part of the folder layout, so is not encoded"},
+					{Kind: IssueGap, Stream: 0, Frame: 1, Description: "stream 0 is missing frames 1 to 1, they are encoded as empty frames"}})
+			})
+		})
+		Convey("using a pattern without a type, followed by its type and stream", func() {
+			Convey("the files are encoded as the type and stream", func() {
+				So(typedErr, ShouldBeNil)
+				So(typed.Rules[0].Type, ShouldEqual, "TC")
+				So(typedStreamErr, ShouldBeNil)
+				So(typedStreams, ShouldResemble, expected[:1])
+			})
+		})
+		Convey("using patterns without a frame or type, or with unknown or repeated placeholders", func() {
+			Convey("an error is returned for each pattern", func() {
+				So(noFrameErr, ShouldResemble, fmt.Errorf("error the layout pattern {stream}_{type}.json needs a {frame}"))
+				So(unknownErr, ShouldResemble, fmt.Errorf("error unknown placeholder {ext} in the layout pattern {stream}/{frame}.{ext}"))
+				So(twiceErr, ShouldResemble, fmt.Errorf("error {frame} is used more than once in the layout pattern {frame}/{frame}_{type}"))
+				So(noTypeErr, ShouldResemble, fmt.Errorf("error the layout pattern frame_{frame}.json needs a {type}, or a Type of TC, TE, BC or BE"))
+				So(badStreamErr, ShouldResemble, fmt.Errorf("error parsing the stream first of the layout frame_{frame}.json;TC;first"))
+				So(extraErr, ShouldResemble, fmt.Errorf("error parsing the layout frame_{frame}.json;TC;0;1, expected a pattern;type;stream"))
+			})
+		})
+	})
+}
+
+func TestSidecarMetadata(t *testing.T) {
+
+	text := &fstest.MapFile{Data: []byte(`{"frame": 0}`)}
+	provenance := &fstest.MapFile{Data: []byte(`{"sensor": "gps-1", "fix": 3}`)}
+	streamMeta := &fstest.MapFile{Data: []byte(`{"StreamContentType": "application/json", "device": "logger"}`)}
+
+	// the sidecars of the folder, flat and layout patterns
+	folder := fstest.MapFS{"0000StreamTC/0d": text, "0000StreamTC/1d": text, "0000StreamTC/0d.meta.json": provenance, "0000StreamTC/stream.json": streamMeta}
+	flat := fstest.MapFS{"0000StreamTC0d": text, "0000StreamTC1d": text, "0000StreamTC0d.meta.json": provenance, "0000StreamTC.stream.json": streamMeta}
+	capture := fstest.MapFS{"gps/frame_0.json": text, "gps/frame_1.json": text, "gps/frame_0.json.meta.json": provenance, "gps/stream.json": streamMeta}
+	layout, _ := ParseLayout("gps/frame_{frame}.json;TC")
+
+	encodeManifest := func(scanner *FolderScanner) ([]manifest.Overview, []Issue, error) {
+		issues, err := scanner.Check()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var mrx bytes.Buffer
+		mw := encode.NewMRXWriter()
+		mw.UpdateEncoder(scanner)
+		if err := mw.Encode(&mrx, &encode.MrxEncodeOptions{}); err != nil {
+			return nil, nil, err
+		}
+
+		roundBytes, err := decode.ExtractManifest(bytes.NewReader(mrx.Bytes()))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var round manifest.RoundTrip
+		err = json.Unmarshal(roundBytes, &round)
+
+		return round.Manifest.DataStreams, issues, err
+	}
+
+	expectedCommon := manifest.GroupProperties{StreamType: "Text based frame data", StreamContentType: "application/json",
+		CustomMeta: map[string]any{"device": "logger"}}
+	expectedMeta := map[string]any{"sensor": "gps-1", "fix": float64(3)}
+
+	var streams [3][]manifest.Overview
+	var issues [3][]Issue
+	var errs [3]error
+	var counted [3]*countingFS
+	for i, fsys := range []fstest.MapFS{folder, flat, capture} {
+		counted[i] = &countingFS{MapFS: fsys}
+		scanner := &FolderScanner{FS: counted[i]}
+		if i == 2 {
+			scanner.Layout = layout
+		}
+
+		streams[i], issues[i], errs[i] = encodeManifest(scanner)
+	}
+
+	// a decodesave sidecar only keeps the extra metadata of the frame
+	decoded := fstest.MapFS{"0000StreamTC/0d": text, "0000StreamTC/0d.meta.json": &fstest.MapFile{Data: []byte(
+		`{"File": "0000StreamTC/0d", "Stream": 0, "Frame": 0, "EssenceProperties": {"Hash": "abc", "Extra User Metadata": {"sensor": "gps-1", "fix": 3}}}`)}}
+	decodedStreams, _, decodedErr := encodeManifest(&FolderScanner{FS: decoded})
+
+	broken := fstest.MapFS{"0000StreamTC/0d": text, "0000StreamTC/0d.meta.json": &fstest.MapFile{Data: []byte(`{"sensor": `)}}
+	_, _, brokenErr := encodeManifest(&FolderScanner{FS: broken})
+
+	Convey("Checking sidecar metadata is added to the manifest", t, func() {
+		Convey("using frame and stream sidecars in the folder, flat and layout patterns", func() {
+			Convey("the sidecars are in the manifest, and are not encoded as essence", func() {
+				for i := range streams {
+					So(errs[i], ShouldBeNil)
+					So(issues[i], ShouldBeEmpty)
+					So(len(streams[i]), ShouldEqual, 1)
+					So(streams[i][0].Common, ShouldResemble, expectedCommon)
+					So(len(streams[i][0].Essence), ShouldEqual, 2)
+					So(streams[i][0].Essence[0].CustomMeta, ShouldResemble, expectedMeta)
+					So(streams[i][0].Essence[1].CustomMeta, ShouldBeNil)
+					// the sidecars of frames without them are never looked for
+					for _, missing := range counted[i].missing {
+						So(missing, ShouldNotEndWith, frameSidecar)
+					}
+				}
+			})
+		})
+		Convey("using a sidecar written by decodesave", func() {
+			Convey("only the extra metadata of the frame is kept", func() {
+				So(decodedErr, ShouldBeNil)
+				So(decodedStreams[0].Essence[0].CustomMeta, ShouldResemble, expectedMeta)
+			})
+		})
+		Convey("using a sidecar that is not valid json", func() {
+			Convey("an error is returned", func() {
+				So(brokenErr, ShouldResemble, fmt.Errorf("error parsing the sidecar 0000StreamTC/0d.meta.json: unexpected end of JSON input"))
+			})
+		})
+	})
+}
+
+// countingFS counts the files that are open at once, and only
+// reads one byte at a time to check files are read in full.
+// missing are the files that were opened but do not exist.
+type countingFS struct {
+	fstest.MapFS
+	fail string
+
+	mu            sync.Mutex
+	open, maxOpen int
+	missing       []string
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	if name == c.fail {
+		return nil, fmt.Errorf("read failure")
+	}
+
+	file, err := c.MapFS.Open(name)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.missing = append(c.missing, name)
+		return nil, err
+	}
+
+	c.open++
+	if c.open > c.maxOpen {
+		c.maxOpen = c.open
+	}
+
+	return &countedFile{File: file, fs: c}, nil
+}
+
+type countedFile struct {
+	fs.File
+	fs *countingFS
+}
+
+// ReadFile reads the file with Open, so the file is counted
+func (c *countingFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(struct{ fs.FS }{c}, name)
+}
+
+func (c *countedFile) Read(p []byte) (int, error) {
+	if len(p) > 1 {
+		p = p[:1]
+	}
+
+	return c.File.Read(p)
+}
+
+func (c *countedFile) Close() error {
+	c.fs.mu.Lock()
+	defer c.fs.mu.Unlock()
+	c.fs.open--
+
+	return c.File.Close()
+}
+
+func TestConcurrentRead(t *testing.T) {
+
+	// a rig dump of lots of streams
+	rig := fstest.MapFS{}
+	for stream := 0; stream < 40; stream++ {
+		for frame := 0; frame < 5; frame++ {
+			rig[fmt.Sprintf("%04dStreamTC/%dd", stream, frame)] = &fstest.MapFile{Data: []byte(fmt.Sprintf(`{"stream": %v, "frame": %v}`, stream, frame))}
+		}
+	}
+
+	encodeFS := func(scanner *FolderScanner) ([]*decode.DataFormat, error) {
+		var mrx bytes.Buffer
+		mw := encode.NewMRXWriter()
+		mw.UpdateEncoder(scanner)
+		if err := mw.Encode(&mrx, &encode.MrxEncodeOptions{}); err != nil {
+			return nil, err
+		}
+
+		return essenceStreams(decode.ExtractStreamData(bytes.NewReader(mrx.Bytes())))
+	}
+
+	expected, expectedErr := encodeFS(&FolderScanner{FS: rig})
+
+	limited := &countingFS{MapFS: rig}
+	limitedStreams, limitedErr := encodeFS(&FolderScanner{FS: limited, ReadWorkers: 3, ReadAhead: 2})
+
+	_, failErr := encodeFS(&FolderScanner{FS: &countingFS{MapFS: rig, fail: "0021StreamTC/3d"}, ReadWorkers: 2})
+
+	Convey("Checking folders with lots of streams are read with a limited number of files", t, func() {
+		Convey("using 3 read workers, with files that are read a byte at a time", func() {
+			Convey("no more than 3 files are open at once, and the essence matches the default reads", func() {
+				So(expectedErr, ShouldBeNil)
+				So(len(expected), ShouldEqual, 40)
+				So(limitedErr, ShouldBeNil)
+				So(limitedStreams, ShouldResemble, expected)
+				So(limited.maxOpen, ShouldBeBetweenOrEqual, 1, 3)
+				So(limited.open, ShouldEqual, 0)
+			})
+		})
+		Convey("using a folder with a file that can not be read", func() {
+			Convey("an error is returned", func() {
+				So(failErr, ShouldResemble, fmt.Errorf("error extracting data to encode from 0021StreamTC/3d:read failure"))
+			})
+		})
+	})
+}
@@ -0,0 +1,274 @@
+package folderscan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Layout is a folder layout that is not the default layout of
+// 0000StreamTC/12d or 0000StreamTC12d. Each file is part of the first rule it matches,
+// any file that does not match a rule is not encoded.
+type Layout struct {
+	Rules []LayoutRule `json:"Rules"`
+}
+
+// LayoutRule names the files of a data stream. The pattern is the slash separated path
+// of the files within the folder, where {frame} is the frame number, {stream}
+// is the stream number and {type} is the essence type of TC, TE, BC or BE.
+// e.g. {stream:int}_{type}/{frame:int}.json matches 0001_TC/12.json.
+// Stream and Type are used for the files when the pattern does not have a {stream} or {type}.
+type LayoutRule struct {
+	Pattern string `json:"Pattern"`
+	Stream  int    `json:"Stream,omitempty"`
+	Type    string `json:"Type,omitempty"`
+
+	match *regexp.Regexp
+	// the regex groups of each placeholder, -1 if they are not used
+	streamGroup, typeGroup, frameGroup int
+}
+
+// layoutPlaceholder finds the placeholders of a pattern
+var layoutPlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// ParseLayout returns the layout of a single pattern. The Type and Stream of the
+// rule can follow the pattern, separated by semicolons, for patterns without a
+// {type} or {stream} e.g. gps/frame_{frame:int}.json;TC;0
+func ParseLayout(pattern string) (*Layout, error) {
+
+	fields := strings.Split(pattern, ";")
+	if len(fields) > 3 {
+		return nil, fmt.Errorf("error parsing the layout %v, expected a pattern;type;stream", pattern)
+	}
+
+	rule := LayoutRule{Pattern: fields[0]}
+	if len(fields) > 1 {
+		rule.Type = strings.TrimSpace(fields[1])
+	}
+
+	if len(fields) > 2 {
+		stream, err := strconv.Atoi(strings.TrimSpace(fields[2]))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing the stream %v of the layout %v", fields[2], pattern)
+		}
+
+		rule.Stream = stream
+	}
+
+	layout := &Layout{Rules: []LayoutRule{rule}}
+
+	return layout, layout.compile()
+}
+
+// LoadLayout reads a layout mapping file, which is the json of a Layout e.g.
+// {"Rules": [{"Pattern": "gps/frame_{frame:int}.json", "Stream": 0, "Type": "TC"}]}
+func LoadLayout(file string) (*Layout, error) {
+
+	layoutBytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the layout %v: %v", file, err)
+	}
+
+	var layout Layout
+	if err := json.Unmarshal(layoutBytes, &layout); err != nil {
+		return nil, fmt.Errorf("error parsing the layout %v: %v", file, err)
+	}
+
+	if len(layout.Rules) == 0 {
+		return nil, fmt.Errorf("error the layout %v has no rules", file)
+	}
+
+	return &layout, layout.compile()
+}
+
+// compile checks the patterns of the rules and
+// makes the regexes the files are matched with
+func (l *Layout) compile() error {
+
+	for i := range l.Rules {
+		if err := l.Rules[i].compile(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *LayoutRule) compile() error {
+
+	r.streamGroup, r.typeGroup, r.frameGroup = -1, -1, -1
+	regex := "^"
+	group := 1
+	last := 0
+
+	for _, loc := range layoutPlaceholder.FindAllStringIndex(r.Pattern, -1) {
+		regex += regexp.QuoteMeta(r.Pattern[last:loc[0]])
+		last = loc[1]
+
+		placeholder := r.Pattern[loc[0]:loc[1]]
+		var target *int
+		switch placeholder {
+		case "{stream}", "{stream:int}":
+			target = &r.streamGroup
+			regex += `(\d+)`
+		case "{frame}", "{frame:int}":
+			target = &r.frameGroup
+			regex += `(\d+)`
+		case "{type}":
+			target = &r.typeGroup
+			regex += `((?i:tc|te|bc|be))`
+		default:
+			return fmt.Errorf("error unknown placeholder %v in the layout pattern %v", placeholder, r.Pattern)
+		}
+
+		if *target != -1 {
+			return fmt.Errorf("error %v is used more than once in the layout pattern %v", placeholder, r.Pattern)
+		}
+		*target = group
+		group++
+	}
+
+	regex += regexp.QuoteMeta(r.Pattern[last:]) + "$"
+
+	if r.frameGroup == -1 {
+		return fmt.Errorf("error the layout pattern %v needs a {frame}", r.Pattern)
+	}
+
+	if r.typeGroup == -1 {
+		if key, _ := essKeyTypeExtract(r.Type); key == 0 {
+			return fmt.Errorf("error the layout pattern %v needs a {type}, or a Type of TC, TE, BC or BE", r.Pattern)
+		}
+	}
+
+	if r.Stream < 0 {
+		return fmt.Errorf("error the stream %v of the layout pattern %v is not a valid stream number", r.Stream, r.Pattern)
+	}
+
+	var err error
+	r.match, err = regexp.Compile(regex)
+
+	return err
+}
+
+// position returns the stream, essence type and frame of a file
+// that matches the rule. ok is false if the file does not match.
+func (r *LayoutRule) position(name string) (stream int, essType string, frame int, ok bool) {
+
+	groups := r.match.FindStringSubmatch(name)
+	if groups == nil {
+		return 0, "", 0, false
+	}
+
+	stream, essType = r.Stream, r.Type
+	if r.streamGroup != -1 {
+		stream, _ = strconv.Atoi(groups[r.streamGroup])
+	}
+
+	if r.typeGroup != -1 {
+		essType = groups[r.typeGroup]
+	}
+
+	frame, err := strconv.Atoi(groups[r.frameGroup])
+
+	return stream, essType, frame, err == nil
+}
+
+// matches checks if a file matches any of the rules
+func (l *Layout) matches(name string) bool {
+	for i := range l.Rules {
+		if _, _, _, ok := l.Rules[i].position(name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// layoutScan scans every file in the folder against the layout rules
+func layoutScan(folder scanFolder, layout *Layout, strict bool) (fullFolderMRX, error) {
+
+	// the layout may not have been made with ParseLayout or LoadLayout
+	if err := layout.compile(); err != nil {
+		return fullFolderMRX{}, err
+	}
+
+	folderLayout := fullFolderMRX{streams: make(map[int]*partition), strict: strict}
+
+	err := fs.WalkDir(folder.fsys, folder.root, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("error reading folder %v : %v", folder.location(folder.root), err)
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		rel := strings.TrimPrefix(name, folder.root+"/")
+		if folder.root == "." {
+			rel = name
+		}
+
+		// sidecars are read when the essence is extracted
+		if isFrameSidecar(rel, layout.matches) {
+			folderLayout.addSidecar(name)
+			return nil
+		}
+
+		if path.Base(rel) == streamSidecar {
+			return nil
+		}
+
+		for i := range layout.Rules {
+			stream, essType, frame, ok := layout.Rules[i].position(rel)
+			if !ok {
+				continue
+			}
+
+			return folderLayout.addLayoutEssence(folder, stream, essType, frame, name)
+		}
+
+		if path.Clean(rel) != "config.json" {
+			folderLayout.unrecognised(name)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return fullFolderMRX{}, err
+	}
+
+	return folderLayout, nil
+}
+
+// addLayoutEssence adds a file found with the layout to its stream
+func (f *fullFolderMRX) addLayoutEssence(folder scanFolder, stream int, essType string, frame int, name string) error {
+
+	key, humanKey := essKeyTypeExtract(essType)
+
+	str, ok := f.streams[stream]
+	if !ok {
+		str = &partition{contents: make(map[int]essenceMRX), partitionType: key, partitionTypeHuman: humanKey, sidecar: layoutSidecar(name)}
+		f.streams[stream] = str
+		f.foundEssence = append(f.foundEssence, key)
+	}
+
+	if str.partitionType != key {
+		if !f.strict {
+			return fmt.Errorf("mixed essence file types found in %v, please ensure they are all the same type", folder.location(folder.root))
+		}
+
+		f.mixed(stream, name)
+
+		return nil
+	}
+
+	f.addEssence(stream, frame, essenceMRX{fullLocation: name, key: key})
+
+	return nil
+}
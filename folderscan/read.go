@@ -0,0 +1,118 @@
+package folderscan
+
+import (
+	"context"
+	"sync"
+
+	"github.com/metarex-media/mrx-tool/encode"
+)
+
+// the default number of files read at once and frames read ahead
+const (
+	// DefaultReadWorkers is the number of files that are read at once, which
+	// is also the most files that are open at once while the folder is encoded.
+	DefaultReadWorkers = 16
+	// DefaultReadAhead is the number of frames of each stream that
+	// are read ahead of the frames being encoded.
+	DefaultReadAhead = 10
+)
+
+// readPool is a fixed number of workers that read the files of every
+// stream, so the number of open files does not grow with the streams.
+type readPool struct {
+	jobs chan func()
+	wg   sync.WaitGroup
+}
+
+// newReadPool starts the workers of the pool, they are
+// stopped with close once every job has been sent.
+func newReadPool(workers int) *readPool {
+
+	if workers < 1 {
+		workers = DefaultReadWorkers
+	}
+
+	pool := &readPool{jobs: make(chan func())}
+	pool.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer pool.wg.Done()
+			for job := range pool.jobs {
+				job()
+			}
+		}()
+	}
+
+	return pool
+}
+
+// run sends a job to the workers, the job must not block so the
+// workers are always free for the next job. An error is returned
+// if the context is cancelled before a worker is free.
+func (r *readPool) run(ctx context.Context, job func()) error {
+	select {
+	case r.jobs <- job:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// close stops the workers, once they have finished their jobs
+func (r *readPool) close() {
+	close(r.jobs)
+	r.wg.Wait()
+}
+
+// frameRead is the result of reading a frame
+type frameRead struct {
+	carriage *encode.DataCarriage
+	err      error
+}
+
+// readAhead reads the frames of a stream with the pool, the frames are
+// returned in order with up to ahead frames being read at once.
+func (p *partition) readAhead(ctx context.Context, pool *readPool, folder scanFolder, ahead int) (<-chan chan frameRead, func() error) {
+
+	if ahead < 1 {
+		ahead = DefaultReadAhead
+	}
+
+	frames := make(chan chan frameRead, ahead)
+
+	return frames, func() error {
+		defer close(frames)
+
+		for i := 0; i <= p.max; i++ {
+			// the result is buffered, so the worker never waits for the frame to be used
+			result := make(chan frameRead, 1)
+
+			select {
+			case frames <- result:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			ess, ok := p.contents[i]
+			// if data has been missed out form the folder then empty data is sent
+			// so that the frame placement of the data is preserved.
+			if !ok {
+				result <- frameRead{carriage: emptyCarriage()}
+				continue
+			}
+
+			err := pool.run(ctx, func() {
+				carriage, err := essExtract(folder, ess)
+				result <- frameRead{carriage: carriage, err: err}
+			})
+
+			if err != nil {
+				// the frame is still waited for
+				result <- frameRead{err: err}
+				return err
+			}
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,141 @@
+package folderscan
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/metarex-media/mrx-tool/manifest"
+)
+
+// the names of the sidecar files, which are json metadata files
+// that are added to the manifest instead of being encoded as essence.
+const (
+	// frameSidecar is added to the name of a file for its sidecar e.g. 12d.meta.json
+	frameSidecar = ".meta.json"
+	// streamSidecar is the sidecar of a stream folder
+	streamSidecar = "stream.json"
+	// flatStreamSidecar is added to the stream name for the
+	// sidecar of a flat layout stream e.g. 0000StreamTC.stream.json
+	flatStreamSidecar = ".stream.json"
+)
+
+var flatStreamSidecarName = regexp.MustCompile(`^\d{4}stream((tc)|(te)|(bc)|(be))\.stream\.json$`)
+
+// isFrameSidecar checks if a file is the sidecar of
+// a file that is matched by essence
+func isFrameSidecar(name string, essence func(string) bool) bool {
+	return strings.HasSuffix(strings.ToLower(name), frameSidecar) && essence(name[:len(name)-len(frameSidecar)])
+}
+
+// readSidecar reads the json of a sidecar, found is false if there is no sidecar
+func readSidecar(folder scanFolder, name string) (meta any, found bool, err error) {
+
+	sidecarBytes, err := fs.ReadFile(folder.fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading the sidecar %v: %v", folder.location(name), err)
+	}
+
+	if err := json.Unmarshal(sidecarBytes, &meta); err != nil {
+		return nil, false, fmt.Errorf("error parsing the sidecar %v: %v", folder.location(name), err)
+	}
+
+	return meta, true, nil
+}
+
+// addSidecar records a frame sidecar found in the scan
+func (f *fullFolderMRX) addSidecar(name string) {
+
+	if f.sidecars == nil {
+		f.sidecars = make(map[string]bool)
+	}
+
+	f.sidecars[name] = true
+}
+
+// linkSidecars gives each essence file the sidecar found in the scan,
+// so the file system is not searched for the sidecars of every frame.
+func (f *fullFolderMRX) linkSidecars() {
+
+	for _, str := range f.streams {
+		for frame, ess := range str.contents {
+			if f.sidecars[ess.fullLocation+frameSidecar] {
+				ess.sidecar = ess.fullLocation + frameSidecar
+				str.contents[frame] = ess
+			}
+		}
+	}
+}
+
+// frameMetadata returns the custom metadata of an essence file from its sidecar.
+// The sidecars written by decodesave are the record of the frame, so only
+// their Extra User Metadata is used, which stops the metadata being
+// nested a level deeper each time a file is decoded and encoded.
+func frameMetadata(folder scanFolder, sidecar string) (any, error) {
+
+	if sidecar == "" {
+		return nil, nil
+	}
+
+	meta, found, err := readSidecar(folder, sidecar)
+	if !found {
+		return nil, err
+	}
+
+	if record, ok := meta.(map[string]any); ok {
+		if properties, ok := record["EssenceProperties"].(map[string]any); ok {
+			return properties["Extra User Metadata"], nil
+		}
+	}
+
+	return meta, nil
+}
+
+// groupProperties returns the properties of a stream, with the
+// StreamContentType and metadata of the stream sidecar if there is one.
+// A StreamContentType field of the sidecar is used as the StreamContentType,
+// the rest of the sidecar is the custom metadata.
+func (p *partition) groupProperties(folder scanFolder) (manifest.GroupProperties, error) {
+
+	properties := manifest.GroupProperties{StreamType: p.partitionTypeHuman}
+	if p.sidecar == "" {
+		return properties, nil
+	}
+
+	meta, found, err := readSidecar(folder, p.sidecar)
+	if !found {
+		return properties, err
+	}
+
+	fields, ok := meta.(map[string]any)
+	if !ok {
+		properties.CustomMeta = meta
+
+		return properties, nil
+	}
+
+	if contentType, ok := fields["StreamContentType"].(string); ok {
+		properties.StreamContentType = contentType
+		delete(fields, "StreamContentType")
+	}
+
+	if len(fields) > 0 {
+		properties.CustomMeta = fields
+	}
+
+	return properties, nil
+}
+
+// layoutSidecar returns the stream sidecar for a stream found with
+// a layout, which is the stream.json in the folder of its first file
+func layoutSidecar(name string) string {
+	return path.Join(path.Dir(name), streamSidecar)
+}
@@ -216,3 +216,17 @@ func BerDecode(num []byte) (length int, encodeLength int) {
 	}
 
 }
+
+// FullName returns the 16 byte key as a string of 4 byte hex groups
+// e.g. 060e2b34.01010101.01011502.00000000.
+// An empty string is returned if the key is not 16 bytes.
+func FullName(namebytes []byte) string {
+
+	if len(namebytes) != 16 {
+		return ""
+	}
+
+	return fmt.Sprintf("%02x%02x%02x%02x.%02x%02x%02x%02x.%02x%02x%02x%02x.%02x%02x%02x%02x",
+		namebytes[0], namebytes[1], namebytes[2], namebytes[3], namebytes[4], namebytes[5], namebytes[6], namebytes[7],
+		namebytes[8], namebytes[9], namebytes[10], namebytes[11], namebytes[12], namebytes[13], namebytes[14], namebytes[15])
+}
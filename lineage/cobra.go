@@ -0,0 +1,90 @@
+package lineage
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var historyJSON bool
+
+var diffFrom int
+var diffTo int
+var diffJSON bool
+
+func init() {
+	HistoryCmd.Flags().BoolVar(&historyJSON, "json", false, "a flag for the output format to be json, instead of the default yaml.")
+
+	DiffCmd.Flags().IntVar(&diffFrom, "from", -1, "the generation of the first manifest to compare, 0 is the current manifest and 1 onwards are the previous manifests")
+	DiffCmd.Flags().IntVar(&diffTo, "to", 0, "the generation of the second manifest to compare, 0 is the current manifest and 1 onwards are the previous manifests")
+	DiffCmd.Flags().BoolVar(&diffJSON, "json", false, "a flag for the output format to be json, instead of the default yaml.")
+
+	ManifestCmd.AddCommand(HistoryCmd)
+	ManifestCmd.AddCommand(DiffCmd)
+}
+
+var ManifestCmd = &cobra.Command{
+	Use:   "manifest",
+	Short: "Inspect the manifest history of mrx files",
+	Long: `Inspect the manifests of mrx files, to find out how a file was derived.
+
+The files can be mrx files, or the config.json roundtrip files produced by decodesave.
+
+Use the "history" command to see the lineage of a file,
+and the "diff" command to find what changed between two manifests.`,
+}
+
+var HistoryCmd = &cobra.Command{
+	Use:   "history <file>",
+	Short: "Print the manifest lineage of a file",
+	Long: `Print the lineage of a file, from the current manifest back through
+each manifest in its history.
+
+Each generation contains the following fields
+- Generation is the position in the lineage, 0 is the current manifest
+- SnapShotDate is when the manifest was superseded by a new encode
+- Edit is the edit that made the next file from this one, such as a trim
+- Tool is the program that generated the manifest
+- ManifestVersion is the version of the manifest
+- UMID is the UMID of the file the manifest described
+- StreamCount is the number of data streams
+- EssenceCountPerStream is the number of metadata entries in each stream`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		return History(args[0], os.Stdout, historyJSON)
+	},
+}
+
+var DiffCmd = &cobra.Command{
+	Use:   "diff <file> [file]",
+	Short: "Print the differences between two manifests",
+	Long: `Print the differences between two manifests.
+
+With one file, two generations of its history are compared. By default this
+is the previous manifest (--from 1) against the current manifest (--to 0).
+
+With two files, the first file is compared against the second file. By default
+the current manifests of each file are compared (--from 0 --to 0), which
+includes the changes to their configurations.
+
+The differences contain the following fields
+- AddedStreams and RemovedStreams are the positions of the streams that were added or removed
+- ChangedStreams are the streams where the common properties changed, essence was added or removed or the hashes changed
+- ConfigurationChanges are the configuration fields that changed, only available when both manifests are current`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(_ *cobra.Command, args []string) error {
+		fromFile, toFile := args[0], args[0]
+		from := diffFrom
+
+		if len(args) == 2 {
+			toFile = args[1]
+			if from == -1 {
+				from = 0
+			}
+		} else if from == -1 {
+			from = 1
+		}
+
+		return Compare(fromFile, from, toFile, diffTo, os.Stdout, diffJSON)
+	},
+}
@@ -0,0 +1,151 @@
+// Package lineage handles reading the manifest history of mrx files,
+// so the derivation of a file can be traced.
+package lineage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/metarex-media/mrx-tool/decode"
+	"github.com/metarex-media/mrx-tool/manifest"
+	"gopkg.in/yaml.v3"
+)
+
+// ReadRoundTrip reads the roundtrip from a file. The file can be
+// an mrx file, a roundtrip json such as config.json or
+// a manifest json.
+func ReadRoundTrip(file string) (*manifest.RoundTrip, error) {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %v: %v", file, err)
+	}
+	defer f.Close()
+
+	return roundTripExtract(f)
+}
+
+func roundTripExtract(stream io.Reader) (*manifest.RoundTrip, error) {
+
+	buf := bufio.NewReader(stream)
+	start, err := buf.Peek(16)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error reading the file: %v", err)
+	}
+
+	var roundBytes []byte
+	// mrx files start with a key, so look for a json object instead
+	if trimmed := bytes.TrimSpace(start); len(trimmed) > 0 && trimmed[0] == '{' {
+		roundBytes, err = io.ReadAll(buf)
+	} else {
+		roundBytes, err = decode.ExtractManifest(buf)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRoundTrip(roundBytes)
+}
+
+// parseRoundTrip parses json that is either a
+// roundtrip or a stand alone manifest.
+func parseRoundTrip(roundBytes []byte) (*manifest.RoundTrip, error) {
+
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(roundBytes, &fields)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the manifest: %v", err)
+	}
+
+	var round manifest.RoundTrip
+	_, hasManifest := fields["Manifest"]
+	_, hasConfig := fields["Configuration"]
+
+	if hasManifest || hasConfig {
+		err = json.Unmarshal(roundBytes, &round)
+	} else {
+		err = json.Unmarshal(roundBytes, &round.Manifest)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the manifest: %v", err)
+	}
+
+	return &round, nil
+}
+
+// History writes the lineage of the manifest in an mrx or json file to w.
+func History(file string, w io.Writer, jsonFile bool) error {
+
+	round, err := ReadRoundTrip(file)
+	if err != nil {
+		return err
+	}
+
+	return encodeOutput(w, manifest.Lineage(round.Manifest), jsonFile)
+}
+
+// Compare writes the differences between two generations of manifests to w.
+// The generations are the position in the lineage of each file, with 0 being
+// the current manifest. When both generations are 0, the configurations are compared as well.
+func Compare(fromFile string, fromGen int, toFile string, toGen int, w io.Writer, jsonFile bool) error {
+
+	fromRound, err := ReadRoundTrip(fromFile)
+	if err != nil {
+		return err
+	}
+
+	toRound, err := ReadRoundTrip(toFile)
+	if err != nil {
+		return err
+	}
+
+	var diff manifest.Difference
+	if fromGen == 0 && toGen == 0 {
+		// only the current manifests have configurations
+		diff, err = manifest.DiffRoundTrip(*fromRound, *toRound)
+	} else {
+		var from, to manifest.TaggedManifest
+		from, err = manifest.Generation(fromRound.Manifest, fromGen)
+		if err != nil {
+			return fmt.Errorf("error finding the manifest in %v: %v", fromFile, err)
+		}
+
+		to, err = manifest.Generation(toRound.Manifest, toGen)
+		if err != nil {
+			return fmt.Errorf("error finding the manifest in %v: %v", toFile, err)
+		}
+
+		diff = manifest.Diff(from.Manifest, to.Manifest)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return encodeOutput(w, diff, jsonFile)
+}
+
+func encodeOutput(w io.Writer, out any, jsonFile bool) error {
+
+	var outBytes []byte
+	var err error
+	if jsonFile {
+		outBytes, err = json.MarshalIndent(out, "", "    ")
+	} else {
+		outBytes, err = yaml.Marshal(out)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(outBytes)
+
+	return err
+}
@@ -0,0 +1,100 @@
+package lineage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/metarex-media/mrx-tool/decode"
+	"github.com/metarex-media/mrx-tool/manifest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReadRoundTrip(t *testing.T) {
+
+	mrxRound, mrxErr := ReadRoundTrip("../decode/testdata/namespaces.mrx")
+	mrxBytes, _ := os.ReadFile("../decode/testdata/namespaces.mrx")
+	manifestBytes, _ := decode.ExtractManifest(bytes.NewReader(mrxBytes))
+	var expected manifest.RoundTrip
+	json.Unmarshal(manifestBytes, &expected)
+
+	configRound, configErr := ReadRoundTrip("testdata/config.json")
+	manifestOnly, manifestOnlyErr := roundTripExtract(bytes.NewReader([]byte(` {"UMID": "only", "MRXTool": "test"}`)))
+	_, notJSONErr := parseRoundTrip([]byte(`{"UMID": `))
+	_, missingErr := ReadRoundTrip("testdata/missing.json")
+
+	Convey("Checking the roundtrip is read from mrx and json files", t, func() {
+		Convey("using an mrx file", func() {
+			Convey("the manifest of the mrx file is read", func() {
+				So(mrxErr, ShouldBeNil)
+				So(*mrxRound, ShouldResemble, expected)
+				So(mrxRound.Manifest.UMID, ShouldNotBeEmpty)
+			})
+		})
+		Convey("using a roundtrip json file", func() {
+			Convey("the configuration and manifest history are read", func() {
+				So(configErr, ShouldBeNil)
+				So(configRound.Config.StreamNameSpace(0), ShouldEqual, "https://metarex.media/reg/MRX.123.456.789.gps")
+				So(configRound.Manifest.UMID, ShouldEqual, "second")
+				So(configRound.Manifest.History[0].UMID, ShouldEqual, "first")
+			})
+		})
+		Convey("using a stand alone manifest, starting with white space", func() {
+			Convey("the manifest is read without a configuration", func() {
+				So(manifestOnlyErr, ShouldBeNil)
+				So(*manifestOnly, ShouldResemble, manifest.RoundTrip{Manifest: manifest.Manifest{UMID: "only", MRXTool: "test"}})
+			})
+		})
+		Convey("using json that is not complete and a file that does not exist", func() {
+			Convey("an error is returned", func() {
+				So(notJSONErr, ShouldResemble, fmt.Errorf("error parsing the manifest: unexpected end of JSON input"))
+				So(missingErr, ShouldResemble, fmt.Errorf("error reading testdata/missing.json: open testdata/missing.json: no such file or directory"))
+			})
+		})
+	})
+}
+
+func TestCompare(t *testing.T) {
+
+	var previous, current bytes.Buffer
+	previousErr := Compare("testdata/config.json", 1, "testdata/config.json", 0, &previous, true)
+	currentErr := Compare("../decode/testdata/namespaces.mrx", 0, "testdata/config.json", 0, &current, true)
+	var previousDiff, currentDiff manifest.Difference
+	json.Unmarshal(previous.Bytes(), &previousDiff)
+	json.Unmarshal(current.Bytes(), &currentDiff)
+
+	var history bytes.Buffer
+	historyErr := History("testdata/config.json", &history, false)
+
+	generationErr := Compare("testdata/config.json", 2, "testdata/config.json", 0, &bytes.Buffer{}, true)
+
+	Convey("Checking the manifests of two generations are compared", t, func() {
+		Convey("using the previous and current generations of a file", func() {
+			Convey("only the manifests are compared, as previous manifests have no configuration", func() {
+				So(previousErr, ShouldBeNil)
+				So(previousDiff, ShouldResemble, manifest.Difference{FromUMID: "first", ToUMID: "second",
+					ChangedStreams: []manifest.StreamDifference{{Stream: 0, RemovedEssence: 1, ChangedHashes: []int{1}}}})
+			})
+		})
+		Convey("using the current generations of two files", func() {
+			Convey("the configurations are compared as well", func() {
+				So(currentErr, ShouldBeNil)
+				So(currentDiff.ToUMID, ShouldEqual, "second")
+				So(currentDiff.ConfigChanges, ShouldNotBeEmpty)
+			})
+		})
+		Convey("using the history of a file", func() {
+			Convey("the lineage is written with the edit of each previous manifest", func() {
+				So(historyErr, ShouldBeNil)
+				So(history.String(), ShouldContainSubstring, "Edit: trim of frames 0 to 2, from 00:00:00:00 to 00:00:00:02")
+			})
+		})
+		Convey("using a generation that is not in the file", func() {
+			Convey("an error is returned", func() {
+				So(generationErr, ShouldResemble, fmt.Errorf("error finding the manifest in testdata/config.json: generation 2 is not available, the manifest has 1 previous manifests"))
+			})
+		})
+	})
+}
@@ -0,0 +1,209 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// LineageEntry is the summary of a single manifest
+// in the history of an mrx file.
+type LineageEntry struct {
+	// Generation is the position in the lineage,
+	// 0 is the current manifest, 1 is the manifest it was made from etc.
+	Generation   int    `yaml:"Generation" json:"Generation"`
+	Date         string `yaml:"SnapShotDate,omitempty" json:"SnapShotDate,omitempty"`
+	Edit         string `yaml:"Edit,omitempty" json:"Edit,omitempty"`
+	Tool         string `yaml:"Tool,omitempty" json:"Tool,omitempty"`
+	Version      string `yaml:"ManifestVersion,omitempty" json:"ManifestVersion,omitempty"`
+	UMID         string `yaml:"UMID" json:"UMID"`
+	StreamCount  int    `yaml:"StreamCount" json:"StreamCount"`
+	EssenceCount []int  `yaml:"EssenceCountPerStream,omitempty" json:"EssenceCountPerStream,omitempty"`
+}
+
+// Lineage returns the lineage of a manifest, starting with the manifest
+// and then each manifest in its history, newest first.
+func Lineage(man Manifest) []LineageEntry {
+
+	lineage := make([]LineageEntry, len(man.History)+1)
+	lineage[0] = lineageEntry(0, TaggedManifest{Manifest: man})
+
+	for i, hist := range man.History {
+		lineage[i+1] = lineageEntry(i+1, hist)
+	}
+
+	return lineage
+}
+
+func lineageEntry(generation int, man TaggedManifest) LineageEntry {
+	entry := LineageEntry{Generation: generation, Date: man.Date, Edit: man.Edit, Tool: man.MRXTool, Version: man.Version,
+		UMID: man.UMID, StreamCount: len(man.DataStreams)}
+
+	for _, stream := range man.DataStreams {
+		entry.EssenceCount = append(entry.EssenceCount, len(stream.Essence))
+	}
+
+	return entry
+}
+
+// Generation returns the manifest at that position in the lineage.
+// 0 is the manifest itself and 1 onwards are the manifests in the history.
+func Generation(man Manifest, generation int) (TaggedManifest, error) {
+
+	switch {
+	case generation == 0:
+		current := man
+		current.History = nil
+		return TaggedManifest{Manifest: current}, nil
+	case generation < 0 || generation > len(man.History):
+		return TaggedManifest{}, fmt.Errorf("generation %v is not available, the manifest has %v previous manifests", generation, len(man.History))
+	default:
+		return man.History[generation-1], nil
+	}
+}
+
+// Difference is the set of changes between two manifests
+type Difference struct {
+	FromUMID       string             `yaml:"FromUMID" json:"FromUMID"`
+	ToUMID         string             `yaml:"ToUMID" json:"ToUMID"`
+	AddedStreams   []int              `yaml:"AddedStreams,omitempty" json:"AddedStreams,omitempty"`
+	RemovedStreams []int              `yaml:"RemovedStreams,omitempty" json:"RemovedStreams,omitempty"`
+	ChangedStreams []StreamDifference `yaml:"ChangedStreams,omitempty" json:"ChangedStreams,omitempty"`
+	ConfigChanges  []ConfigChange     `yaml:"ConfigurationChanges,omitempty" json:"ConfigurationChanges,omitempty"`
+}
+
+// StreamDifference is the set of changes between the same stream
+// in two manifests. The stream is identified by its position in the manifest.
+type StreamDifference struct {
+	Stream         int   `yaml:"Stream" json:"Stream"`
+	CommonChanged  bool  `yaml:"CommonPropertiesChanged,omitempty" json:"CommonPropertiesChanged,omitempty"`
+	AddedEssence   int   `yaml:"AddedEssence,omitempty" json:"AddedEssence,omitempty"`
+	RemovedEssence int   `yaml:"RemovedEssence,omitempty" json:"RemovedEssence,omitempty"`
+	ChangedHashes  []int `yaml:"ChangedHashes,omitempty" json:"ChangedHashes,omitempty"`
+}
+
+// ConfigChange is a single changed configuration field
+type ConfigChange struct {
+	Field string `yaml:"Field" json:"Field"`
+	From  any    `yaml:"From,omitempty" json:"From,omitempty"`
+	To    any    `yaml:"To,omitempty" json:"To,omitempty"`
+}
+
+// Changed returns true if there are any differences.
+func (d Difference) Changed() bool {
+	return len(d.AddedStreams)+len(d.RemovedStreams)+len(d.ChangedStreams)+len(d.ConfigChanges) != 0
+}
+
+// Diff finds the changes to the data streams between two manifests.
+// Streams are matched by their position in the manifest, and the essence
+// is compared by hash in the order it is found.
+func Diff(from, to Manifest) Difference {
+
+	diff := Difference{FromUMID: from.UMID, ToUMID: to.UMID}
+
+	for i := len(from.DataStreams); i < len(to.DataStreams); i++ {
+		diff.AddedStreams = append(diff.AddedStreams, i)
+	}
+
+	for i := len(to.DataStreams); i < len(from.DataStreams); i++ {
+		diff.RemovedStreams = append(diff.RemovedStreams, i)
+	}
+
+	for i := 0; i < len(from.DataStreams) && i < len(to.DataStreams); i++ {
+		fromStream, toStream := from.DataStreams[i], to.DataStreams[i]
+		streamDiff := StreamDifference{Stream: i, CommonChanged: !reflect.DeepEqual(fromStream.Common, toStream.Common)}
+
+		if len(toStream.Essence) > len(fromStream.Essence) {
+			streamDiff.AddedEssence = len(toStream.Essence) - len(fromStream.Essence)
+		} else {
+			streamDiff.RemovedEssence = len(fromStream.Essence) - len(toStream.Essence)
+		}
+
+		for j := 0; j < len(fromStream.Essence) && j < len(toStream.Essence); j++ {
+			if fromStream.Essence[j].Hash != toStream.Essence[j].Hash {
+				streamDiff.ChangedHashes = append(streamDiff.ChangedHashes, j)
+			}
+		}
+
+		if streamDiff.CommonChanged || streamDiff.AddedEssence != 0 || streamDiff.RemovedEssence != 0 || len(streamDiff.ChangedHashes) != 0 {
+			diff.ChangedStreams = append(diff.ChangedStreams, streamDiff)
+		}
+	}
+
+	return diff
+}
+
+// DiffRoundTrip finds the changes to the manifest and configuration
+// between two roundtrips.
+func DiffRoundTrip(from, to RoundTrip) (Difference, error) {
+	diff := Diff(from.Manifest, to.Manifest)
+
+	fromConf, err := flattenConfig(from.Config)
+	if err != nil {
+		return diff, err
+	}
+
+	toConf, err := flattenConfig(to.Config)
+	if err != nil {
+		return diff, err
+	}
+
+	// find the unique fields of both configurations
+	fields := make(map[string]bool)
+	for field := range fromConf {
+		fields[field] = true
+	}
+	for field := range toConf {
+		fields[field] = true
+	}
+
+	fieldNames := make([]string, 0, len(fields))
+	for field := range fields {
+		fieldNames = append(fieldNames, field)
+	}
+	sort.Strings(fieldNames)
+
+	for _, field := range fieldNames {
+		if !reflect.DeepEqual(fromConf[field], toConf[field]) {
+			diff.ConfigChanges = append(diff.ConfigChanges, ConfigChange{Field: field, From: fromConf[field], To: toConf[field]})
+		}
+	}
+
+	return diff, nil
+}
+
+// flattenConfig converts the configuration to a map of
+// json paths e.g. StreamProperties.1.FrameRate and their values.
+func flattenConfig(conf Configuration) (map[string]any, error) {
+	confBytes, err := json.Marshal(conf)
+	if err != nil {
+		return nil, fmt.Errorf("error handling the configuration: %v", err)
+	}
+
+	var confMap map[string]any
+	err = json.Unmarshal(confBytes, &confMap)
+	if err != nil {
+		return nil, fmt.Errorf("error handling the configuration: %v", err)
+	}
+
+	flat := make(map[string]any)
+	flatten("", confMap, flat)
+
+	return flat, nil
+}
+
+func flatten(prefix string, fields map[string]any, flat map[string]any) {
+	for key, val := range fields {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		if nested, ok := val.(map[string]any); ok {
+			flatten(path, nested, flat)
+		} else {
+			flat[path] = val
+		}
+	}
+}
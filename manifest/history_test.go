@@ -0,0 +1,63 @@
+package manifest
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLineage(t *testing.T) {
+
+	previous := TaggedManifest{Date: "2024-01-01T00:00:00Z", Manifest: Manifest{UMID: "first", DataStreams: []Overview{{Essence: []EssenceProperties{{Hash: "a"}}}}}}
+	current := Manifest{UMID: "second", MRXTool: "test", DataStreams: []Overview{{Essence: []EssenceProperties{{Hash: "a"}, {Hash: "b"}}}, {}},
+		History: []TaggedManifest{previous}}
+
+	lineage := Lineage(current)
+	gen, genErr := Generation(current, 1)
+	_, badGenErr := Generation(current, 2)
+
+	Convey("Checking the lineage of a manifest is found", t, func() {
+		Convey("using a manifest with one previous manifest", func() {
+			Convey("the current manifest is first then the history, and the generations can be found", func() {
+				So(lineage, ShouldResemble, []LineageEntry{
+					{Generation: 0, Tool: "test", UMID: "second", StreamCount: 2, EssenceCount: []int{2, 0}},
+					{Generation: 1, Date: "2024-01-01T00:00:00Z", UMID: "first", StreamCount: 1, EssenceCount: []int{1}},
+				})
+				So(genErr, ShouldBeNil)
+				So(gen, ShouldResemble, previous)
+				So(badGenErr, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestDiff(t *testing.T) {
+
+	from := RoundTrip{Config: Configuration{Version: "1", StreamProperties: map[int]StreamProperties{0: {FrameRate: "24/1"}}},
+		Manifest: Manifest{UMID: "from", DataStreams: []Overview{{Essence: []EssenceProperties{{Hash: "a"}, {Hash: "b"}}}, {}}}}
+	to := RoundTrip{Config: Configuration{Version: "1", StreamProperties: map[int]StreamProperties{0: {FrameRate: "25/1"}, 1: {NameSpace: "new"}}},
+		Manifest: Manifest{UMID: "to", DataStreams: []Overview{{Essence: []EssenceProperties{{Hash: "a"}, {Hash: "c"}, {Hash: "d"}}}, {}, {}}}}
+
+	diff, err := DiffRoundTrip(from, to)
+	noDiff, noErr := DiffRoundTrip(from, from)
+
+	Convey("Checking the differences between two roundtrips are found", t, func() {
+		Convey("using two roundtrips with changed streams and configurations", func() {
+			Convey("the added streams, changed hashes and configuration changes are found", func() {
+				So(err, ShouldBeNil)
+				So(diff, ShouldResemble, Difference{FromUMID: "from", ToUMID: "to", AddedStreams: []int{2},
+					ChangedStreams: []StreamDifference{{Stream: 0, AddedEssence: 1, ChangedHashes: []int{1}}},
+					ConfigChanges: []ConfigChange{
+						{Field: "StreamProperties.0.FrameRate", From: "24/1", To: "25/1"},
+						{Field: "StreamProperties.1.NameSpace", To: "new"},
+					}})
+			})
+		})
+		Convey("using the same roundtrip twice", func() {
+			Convey("no changes are found", func() {
+				So(noErr, ShouldBeNil)
+				So(noDiff.Changed(), ShouldBeFalse)
+			})
+		})
+	})
+}
@@ -71,8 +71,11 @@ type RoundTrip struct {
 // Configuration is the configuration for the global
 // file and each data stream.
 type Configuration struct {
-	Version string           `json:"MRXVersion,omitempty"`
-	Default StreamProperties `json:"DefaultStreamProperties,omitempty"`
+	Version string `json:"MRXVersion,omitempty"`
+	// StartTimecode is the HH:MM:SS:FF timecode of the first frame, at the
+	// frame rate of the first clocked stream. The default is 00:00:00:00.
+	StartTimecode string           `json:"StartTimecode,omitempty"`
+	Default       StreamProperties `json:"DefaultStreamProperties,omitempty"`
 
 	StreamProperties map[int]StreamProperties `json:"StreamProperties,omitempty"`
 }
@@ -85,6 +88,30 @@ type StreamProperties struct {
 	NameSpace  string `json:"NameSpace,omitempty"`
 }
 
+// StreamNameSpace returns the namespace of a stream, the
+// default namespace is used if the stream does not have one.
+func (c Configuration) StreamNameSpace(stream int) string {
+	if nameSpace := c.StreamProperties[stream].NameSpace; nameSpace != "" {
+		return nameSpace
+	}
+
+	return c.Default.NameSpace
+}
+
+// Stream returns the properties of a stream, the default
+// properties are used for any that the stream does not have.
+func (c Configuration) Stream(stream int) StreamProperties {
+	properties := c.StreamProperties[stream]
+	if properties.StreamType == "" {
+		properties.StreamType = c.Default.StreamType
+	}
+
+	properties.FrameRate = c.StreamFrameRate(stream)
+	properties.NameSpace = c.StreamNameSpace(stream)
+
+	return properties
+}
+
 // add this to the main mrx writer body
 type Manifest struct {
 	UMID    string `json:"UMID,omitempty"`                 // UMID of the mrx file
@@ -101,6 +128,9 @@ type Manifest struct {
 // with addition of the date the manifest was last edited.
 type TaggedManifest struct {
 	Date string `json:"SnapShot Date,omitempty"`
+	// Edit is the edit that made the next file from
+	// this one, such as a trim of its frames
+	Edit string `json:"Edit,omitempty" yaml:"Edit,omitempty"`
 	Manifest
 }
 
@@ -0,0 +1,83 @@
+package manifest
+
+import (
+	"fmt"
+	"math"
+)
+
+// DefaultFrameRate is the frame rate of data streams
+// without a frame rate, in the configuration or its default.
+const DefaultFrameRate = "24/1"
+
+// StreamFrameRate returns the frame rate of a stream, the
+// default frame rate is used if the stream does not have one,
+// then DefaultFrameRate if the configuration has no default.
+func (c Configuration) StreamFrameRate(stream int) string {
+	if frameRate := c.StreamProperties[stream].FrameRate; frameRate != "" {
+		return frameRate
+	}
+
+	if c.Default.FrameRate != "" {
+		return c.Default.FrameRate
+	}
+
+	return DefaultFrameRate
+}
+
+// ParseFrameRate returns the numerator and denominator
+// of a frame rate e.g. 30000 and 1001 for 30000/1001
+func ParseFrameRate(frameRate string) (num, den int, err error) {
+
+	if _, err := fmt.Sscanf(frameRate, "%v/%v", &num, &den); err != nil || num <= 0 || den <= 0 {
+		return 0, 0, fmt.Errorf("error parsing the frame rate %v", frameRate)
+	}
+
+	return num, den, nil
+}
+
+// NominalFPS returns the whole frames per second of a frame rate,
+// which timecodes use e.g. 30 for 30000/1001
+func NominalFPS(frameRate string) (int, error) {
+
+	num, den, err := ParseFrameRate(frameRate)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(math.Round(float64(num) / float64(den))), nil
+}
+
+// ParseTimecode converts a HH:MM:SS:FF timecode to
+// the number of frames from 00:00:00:00.
+func ParseTimecode(timecode string, fps int) (int, error) {
+
+	var hours, minutes, seconds, frames int
+	_, err := fmt.Sscanf(timecode, "%d:%d:%d:%d", &hours, &minutes, &seconds, &frames)
+	if err != nil || hours < 0 || minutes < 0 || minutes > 59 || seconds < 0 || seconds > 59 || frames < 0 || frames >= fps {
+		return 0, fmt.Errorf("error parsing the timecode %v, expected HH:MM:SS:FF at %v fps", timecode, fps)
+	}
+
+	return ((hours*60+minutes)*60+seconds)*fps + frames, nil
+}
+
+// FormatTimecode converts a number of frames from
+// 00:00:00:00 to a HH:MM:SS:FF timecode.
+func FormatTimecode(frame, fps int) string {
+	return fmt.Sprintf("%02d:%02d:%02d:%02d", frame/(fps*3600), frame/(fps*60)%60, frame/fps%60, frame%fps)
+}
+
+// StartFrame returns the number of frames of the start timecode
+// from 00:00:00:00, which is 0 if there is no start timecode.
+func (c Configuration) StartFrame(fps int) (int, error) {
+
+	if c.StartTimecode == "" {
+		return 0, nil
+	}
+
+	start, err := ParseTimecode(c.StartTimecode, fps)
+	if err != nil {
+		return 0, fmt.Errorf("error finding the start timecode: %v", err)
+	}
+
+	return start, nil
+}
@@ -0,0 +1,68 @@
+package manifest
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTimecode(t *testing.T) {
+
+	frame, frameErr := ParseTimecode("01:00:01:10", 25)
+	_, badFrameErr := ParseTimecode("00:00:00:25", 25)
+	start, startErr := Configuration{StartTimecode: "00:00:02:00"}.StartFrame(30)
+	none, noneErr := Configuration{}.StartFrame(30)
+
+	Convey("Checking timecodes are converted to and from frames", t, func() {
+		Convey("using a valid timecode at 25 fps", func() {
+			Convey("the frame count is returned and formats back to the timecode", func() {
+				So(frameErr, ShouldBeNil)
+				So(frame, ShouldEqual, 90035)
+				So(FormatTimecode(frame, 25), ShouldEqual, "01:00:01:10")
+			})
+		})
+		Convey("using a timecode with more frames than the frame rate", func() {
+			Convey("an error is returned", func() {
+				So(badFrameErr, ShouldResemble, fmt.Errorf("error parsing the timecode 00:00:00:25, expected HH:MM:SS:FF at 25 fps"))
+			})
+		})
+		Convey("using configurations with and without a start timecode", func() {
+			Convey("the start frame is found, which is 0 without a start timecode", func() {
+				So(startErr, ShouldBeNil)
+				So(start, ShouldEqual, 60)
+				So(noneErr, ShouldBeNil)
+				So(none, ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestFrameRate(t *testing.T) {
+
+	config := Configuration{Default: StreamProperties{FrameRate: "25/1"}, StreamProperties: map[int]StreamProperties{1: {FrameRate: "30000/1001"}}}
+	ntsc, ntscErr := NominalFPS(config.StreamFrameRate(1))
+	num, den, parseErr := ParseFrameRate(config.StreamFrameRate(1))
+	_, badErr := NominalFPS("static")
+	_, _, zeroErr := ParseFrameRate("25/0")
+
+	Convey("Checking the frame rates of streams are found as whole frames per second", t, func() {
+		Convey("using a stream frame rate, a default frame rate and no frame rate", func() {
+			Convey("the stream rate is used, then the default rate, then 24/1", func() {
+				So(config.StreamFrameRate(1), ShouldEqual, "30000/1001")
+				So(config.StreamFrameRate(0), ShouldEqual, "25/1")
+				So(Configuration{}.StreamFrameRate(0), ShouldEqual, DefaultFrameRate)
+				So(ntscErr, ShouldBeNil)
+				So(ntsc, ShouldEqual, 30)
+				So(parseErr, ShouldBeNil)
+				So([]int{num, den}, ShouldResemble, []int{30000, 1001})
+			})
+		})
+		Convey("using a frame rate that is not a fraction", func() {
+			Convey("an error is returned", func() {
+				So(badErr, ShouldResemble, fmt.Errorf("error parsing the frame rate static"))
+				So(zeroErr, ShouldResemble, fmt.Errorf("error parsing the frame rate 25/0"))
+			})
+		})
+	})
+}
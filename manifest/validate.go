@@ -0,0 +1,176 @@
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// SchemaError is a single schema violation found in a json document.
+type SchemaError struct {
+	// Pointer is the JSON pointer of the invalid field
+	// e.g. /StreamProperties/0/Framerate
+	Pointer     string
+	Description string
+}
+
+func (s SchemaError) Error() string {
+	return fmt.Sprintf("%s: %s", s.Pointer, s.Description)
+}
+
+// ValidationError is returned when a document does not match its schema,
+// it contains every schema violation that was found.
+type ValidationError struct {
+	Document string
+	Errors   []SchemaError
+}
+
+func (v *ValidationError) Error() string {
+	errString := fmt.Sprintf("the %s is not valid against its schema:", v.Document)
+	for _, schemaErr := range v.Errors {
+		errString += fmt.Sprintf("\n- %v", schemaErr)
+	}
+
+	return errString
+}
+
+// ConfigValidator checks that the configuration is valid against the configuration schema.
+// If the configuration is not valid then a *ValidationError is returned
+// with the JSON pointer of each invalid field.
+func ConfigValidator(config []byte) error {
+	schemaErrs, err := validate(ConfigSchema, config, "")
+	if err != nil {
+		return fmt.Errorf("error validating the configuration: %v", err)
+	}
+
+	if len(schemaErrs) != 0 {
+		return &ValidationError{Document: "configuration", Errors: schemaErrs}
+	}
+
+	return nil
+}
+
+// RoundTripValidator checks the configuration and manifest of a roundtrip
+// against their schemas. The manifest is only checked if checkManifest is true.
+// If either are not valid then a *ValidationError is returned,
+// with the JSON pointer of each invalid field from the root of the roundtrip.
+func RoundTripValidator(roundTrip []byte, checkManifest bool) error {
+
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(roundTrip, &fields)
+	if err != nil {
+		return fmt.Errorf("error validating the roundtrip: %v", err)
+	}
+
+	var schemaErrs []SchemaError
+	if config, ok := fields["Configuration"]; ok {
+		configErrs, err := validate(ConfigSchema, config, "/Configuration")
+		if err != nil {
+			return fmt.Errorf("error validating the configuration: %v", err)
+		}
+		schemaErrs = append(schemaErrs, configErrs...)
+	}
+
+	if man, ok := fields["Manifest"]; ok && checkManifest {
+		manErrs, err := validate(ManifestSchema, man, "/Manifest")
+		if err != nil {
+			return fmt.Errorf("error validating the manifest: %v", err)
+		}
+		schemaErrs = append(schemaErrs, manErrs...)
+	}
+
+	if len(schemaErrs) != 0 {
+		return &ValidationError{Document: "roundtrip", Errors: schemaErrs}
+	}
+
+	return nil
+}
+
+// SchemaErrors returns the schema violations of a validation error,
+// or nil if the error was not from validation.
+func SchemaErrors(err error) []SchemaError {
+	var valErr *ValidationError
+	if errors.As(err, &valErr) {
+		return valErr.Errors
+	}
+
+	return nil
+}
+
+// validate checks the document against the schema, the JSON pointers
+// of any errors are prefixed with the pointer of the document.
+func validate(schema, document []byte, prefix string) ([]SchemaError, error) {
+	schemaLoader := gojsonschema.NewBytesLoader(schema)
+	documentLoader := gojsonschema.NewBytesLoader(document)
+
+	result, err := gojsonschema.Validate(schemaLoader, documentLoader)
+	if err != nil {
+		return nil, err
+	}
+
+	return ResultErrors(result, prefix), nil
+}
+
+// ResultErrors converts the errors of a schema validation result
+// to schema errors, sorted by their JSON pointers. The pointers
+// are prefixed with the pointer of the document that was validated.
+func ResultErrors(result *gojsonschema.Result, prefix string) []SchemaError {
+
+	// anyOf failures also report the errors of one of the schemas,
+	// which is misleading as the field did not match any of them.
+	// So only the anyOf error is kept for that field.
+	anyOf := make(map[string]bool)
+	for _, resErr := range result.Errors() {
+		if resErr.Type() == "number_any_of" {
+			anyOf[errorPointer(resErr)] = true
+		}
+	}
+
+	schemaErrs := make([]SchemaError, 0, len(result.Errors()))
+	for _, resErr := range result.Errors() {
+		pointer := errorPointer(resErr)
+		if anyOf[pointer] && resErr.Type() != "number_any_of" {
+			continue
+		}
+
+		desc := resErr.Description()
+		if resErr.Type() == "number_any_of" {
+			// give the value as the description has no detail
+			found, _ := json.Marshal(resErr.Value())
+			desc += fmt.Sprintf(", found %s", found)
+		}
+
+		schemaErrs = append(schemaErrs, SchemaError{Pointer: prefix + pointer, Description: desc})
+	}
+
+	// the errors are found in a random order for objects
+	sort.SliceStable(schemaErrs, func(i, j int) bool {
+		return schemaErrs[i].Pointer < schemaErrs[j].Pointer
+	})
+
+	return schemaErrs
+}
+
+// errorPointer converts the context of a schema error to a JSON pointer.
+// Errors about properties are reported against their parent object,
+// so the property is added to give the precise field.
+func errorPointer(resErr gojsonschema.ResultError) string {
+	pointer := strings.TrimPrefix(resErr.Context().String("/"), "(root)")
+
+	switch resErr.Type() {
+	case "additional_property_not_allowed", "required":
+		if property, ok := resErr.Details()["property"].(string); ok {
+			pointer += "/" + property
+		}
+	}
+
+	if pointer == "" {
+		return "/"
+	}
+
+	return pointer
+}
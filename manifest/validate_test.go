@@ -0,0 +1,57 @@
+package manifest
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConfigValidation(t *testing.T) {
+
+	valid := []byte(`{"MRXVersion": "1", "StreamProperties": {"0": {"FrameRate": "24/1", "Type": "gps"}}}`)
+	typo := []byte(`{"MrxVersion": "1", "StreamProperties": {"0": {"Framerate": "25/1"}, "1": {"FrameRate": "25"}}}`)
+
+	validErr := ConfigValidator(valid)
+	typoErr := ConfigValidator(typo)
+
+	Convey("Checking configurations are validated against the schema", t, func() {
+		Convey("using a valid configuration", func() {
+			Convey("no error is returned", func() {
+				So(validErr, ShouldBeNil)
+			})
+		})
+		Convey("using a configuration with a misspelt field and a bad frame rate", func() {
+			Convey("the JSON pointer of each invalid field is returned", func() {
+				So(typoErr, ShouldNotBeNil)
+				So(SchemaErrors(typoErr), ShouldResemble, []SchemaError{
+					{Pointer: "/StreamProperties/0/Framerate", Description: "Additional property Framerate is not allowed"},
+					{Pointer: "/StreamProperties/1/FrameRate", Description: `Must validate at least one schema (anyOf), found "25"`},
+				})
+			})
+		})
+	})
+}
+
+func TestRoundTripValidation(t *testing.T) {
+
+	noUMID := []byte(`{"Configuration": {"MRXVersion": "1"}, "Manifest": {"MRXTool": "test"}}`)
+
+	manErr := RoundTripValidator(noUMID, true)
+	configOnlyErr := RoundTripValidator(noUMID, false)
+	badJSONErr := RoundTripValidator([]byte(`{"UMID"`), true)
+
+	Convey("Checking roundtrips are validated against the schemas", t, func() {
+		Convey("using a roundtrip where the manifest has no UMID", func() {
+			Convey("the manifest error is found from the root of the roundtrip, unless only the configuration is checked", func() {
+				So(SchemaErrors(manErr), ShouldResemble, []SchemaError{{Pointer: "/Manifest/UMID", Description: "UMID is required"}})
+				So(configOnlyErr, ShouldBeNil)
+			})
+		})
+		Convey("using invalid json", func() {
+			Convey("an error is returned that is not a schema error", func() {
+				So(badJSONErr, ShouldNotBeNil)
+				So(SchemaErrors(badJSONErr), ShouldBeNil)
+			})
+		})
+	})
+}
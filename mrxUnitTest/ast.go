@@ -1036,10 +1036,47 @@ func DecodeGroupNode(doc io.ReadSeeker, node *Node, primer map[string]string) (m
 // where the key of the map is the ul of the field and the any is the decoded value.
 // Any unknown fields will not be decoded and are skipped from the returned values.
 func DecodeGroup(group *klv.KLV, primer map[string]string) (map[string]any, error) {
+	name, fields, err := DecodeGroupFields(group, primer)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		return nil, fmt.Errorf("no group for the key %s was found", fullName(group.Key))
+	}
+
+	output := make(map[string]any)
+	for _, field := range fields {
+		if field.Name != "" {
+			output[field.Name] = field.Value
+		}
+	}
+
+	return output, nil
+}
+
+// GroupField is a single field of a group.
+type GroupField struct {
+	// Key is the full UL of the field
+	Key string
+	// Name is the name of the field, it is empty if the field is unknown
+	Name string
+	// Value is the decoded value of the field, it is nil if
+	// the field is unknown or could not be decoded.
+	Value any
+	// Raw is the undecoded value of the field
+	Raw []byte
+}
+
+// DecodeGroupFields decodes a group KLV into the name of the group and
+// its fields, in the order they are in the group.
+// If the group is unknown the name is empty and the fields are not decoded.
+// Any fields that run past the end of the group are not returned.
+func DecodeGroupFields(group *klv.KLV, primer map[string]string) (string, []GroupField, error) {
 	dec, skip := decodeBuilder(group.Key[5])
 
 	if skip {
-		return nil, fmt.Errorf("unable to decode essence, unknown decode method byte %0x", group.Key[5])
+		return "", nil, fmt.Errorf("unable to decode essence, unknown decode method byte %0x", group.Key[5])
 	}
 
 	decoders, ok := mxf2go.Groups["urn:smpte:ul:"+fullName(group.Key)]
@@ -1051,32 +1088,38 @@ func DecodeGroup(group *klv.KLV, primer map[string]string) (map[string]any, erro
 		decoders, ok = mxf2go.Groups["urn:smpte:ul:"+fullNameMask(group.Key, 5, 13)]
 	}
 
-	if !ok {
-		return nil, fmt.Errorf("no group for the key %s was found", fullName(group.Key))
-	}
-
-	output := make(map[string]any)
+	var fields []GroupField
 	pos := 0
 
-	for pos < len(group.Value) {
+	for pos+dec.keyLen+dec.lengthLen <= len(group.Value) {
 		key, klength := dec.keyFunc(group.Value[pos : pos+dec.keyLen])
 		length, lenlength := dec.lengthFunc(group.Value[pos+dec.keyLen : pos+dec.keyLen+dec.lengthLen])
 		if klength != 16 {
 			key = primer[key]
 		}
-		decodeF, ok := decoders.Group["urn:smpte:ul:"+key]
 
-		if ok {
+		start := pos + dec.keyLen + dec.lengthLen
+		if start+length > len(group.Value) {
+			break
+		}
 
-			b, _ := decodeF.Decode(group.Value[pos+dec.keyLen+dec.lengthLen : pos+dec.keyLen+dec.lengthLen+length])
+		field := GroupField{Key: key, Raw: group.Value[start : start+length]}
+		decodeF, found := decoders.Group["urn:smpte:ul:"+key]
 
-			output[decodeF.UL] = b
+		if found {
+			field.Name = decodeF.UL
+			field.Value, _ = decodeF.Decode(field.Raw)
 		}
 
+		fields = append(fields, field)
 		pos += klength + length + lenlength
 	}
 
-	return output, nil
+	if !ok {
+		return "", fields, nil
+	}
+
+	return decoders.Name, fields, nil
 }
 
 // fullNameMask mask the specified bytes in a key as 7f
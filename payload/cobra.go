@@ -0,0 +1,92 @@
+package payload
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var validateIn string
+var validateSchemas string
+var validateJSON bool
+
+func init() {
+	ValidateCmd.Flags().StringVar(&validateIn, "input", "", "identifies the mrx file to be validated")
+	ValidateCmd.Flags().StringVar(&validateSchemas, "schemas", "", "the schema registry folder of the namespace schemas")
+	ValidateCmd.Flags().BoolVar(&validateJSON, "json", false, "a flag for the output format to be json, instead of the default yaml.")
+}
+
+var ValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the metadata payloads of an mrx file against their namespace schemas",
+	Long: `The validate flag checks every text payload of an mrx file, against the JSON schema
+of the namespace of its stream. The namespaces are taken from the configuration in the manifest.
+
+The schemas are found in a local schema registry folder, given by the --schemas flag.
+The schema of a namespace is found by either
+- the namespace or its MRX ID being in the registry.json index of the folder,
+e.g. {"MRX.123.456.789.gps": "gps/schema.json"}
+- a file named after the MRX ID in the folder, e.g. MRX.123.456.789.gps.json
+where the MRX ID is the last part of the namespace.
+Streams without a schema are not checked.
+
+The errors are printed as yaml, with the following fields
+- Stream is the position of the stream in the mrx file
+- Frame is the position of the payload in the stream
+- NameSpace is the namespace of the stream
+- Path is the JSON pointer of the invalid field in the payload
+- Description is the reason the field is not valid`,
+
+	RunE: Validate,
+}
+
+// Validate checks the payloads of an mrx file against the schema registry.
+func Validate(_ *cobra.Command, _ []string) error {
+
+	if validateIn == "" {
+		return fmt.Errorf("no input file chosen please use the --input flag")
+	}
+
+	if validateSchemas == "" {
+		return fmt.Errorf("no schema registry chosen please use the --schemas flag")
+	}
+
+	reg, err := LoadRegistry(validateSchemas)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(validateIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	violations, err := ValidateMRX(f, reg)
+	if err != nil {
+		return err
+	}
+
+	if len(violations) == 0 {
+		fmt.Printf("%v matches the namespace schemas\n", validateIn)
+		return nil
+	}
+
+	var out []byte
+	if validateJSON {
+		out, err = json.MarshalIndent(violations, "", "    ")
+	} else {
+		out, err = yaml.Marshal(violations)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(out))
+
+	return fmt.Errorf("%v payload errors were found in %v", len(violations), validateIn)
+}
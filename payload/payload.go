@@ -0,0 +1,217 @@
+// Package payload handles checking the metadata payloads of a stream,
+// against the JSON schema promised by the namespace of the stream.
+package payload
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/metarex-media/mrx-tool/decode"
+	"github.com/metarex-media/mrx-tool/manifest"
+	"github.com/metarex-media/mrx-tool/register"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// RegistryIndex is the optional file in a registry folder, that maps
+// namespaces or MRX IDs to schema files in the folder.
+const RegistryIndex = "registry.json"
+
+// Registry is a local folder of JSON schemas for namespaces.
+//
+// A schema for a namespace is found by either, the namespace
+// or the MRX ID of the namespace being in the registry.json index
+// e.g. {"MRX.123.456.789.gps": "gps/schema.json"}. Or by a file
+// in the folder named after the MRX ID e.g. MRX.123.456.789.gps.json
+type Registry struct {
+	folder  string
+	index   map[string]string
+	schemas map[string]*gojsonschema.Schema
+}
+
+// LoadRegistry loads the schema registry from a folder.
+func LoadRegistry(folder string) (*Registry, error) {
+
+	info, err := os.Stat(folder)
+	if err != nil {
+		return nil, fmt.Errorf("error opening the schema registry: %v", err)
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("error opening the schema registry: %v is not a folder", folder)
+	}
+
+	reg := &Registry{folder: folder, index: make(map[string]string), schemas: make(map[string]*gojsonschema.Schema)}
+
+	indexBytes, err := os.ReadFile(filepath.Join(folder, RegistryIndex))
+	switch {
+	case err == nil:
+		err = json.Unmarshal(indexBytes, &reg.index)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %v: %v", RegistryIndex, err)
+		}
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("error reading %v: %v", RegistryIndex, err)
+	}
+
+	return reg, nil
+}
+
+// Schema returns the schema for a namespace. If there is no schema
+// for the namespace then nil is returned.
+func (r *Registry) Schema(nameSpace string) (*gojsonschema.Schema, error) {
+
+	if nameSpace == "" {
+		return nil, nil
+	}
+
+	if schema, ok := r.schemas[nameSpace]; ok {
+		return schema, nil
+	}
+
+	schemaFile := r.schemaFile(nameSpace)
+	if schemaFile == "" {
+		r.schemas[nameSpace] = nil
+		return nil, nil
+	}
+
+	absPath, err := filepath.Abs(schemaFile)
+	if err != nil {
+		return nil, fmt.Errorf("error finding the schema for %v: %v", nameSpace, err)
+	}
+
+	// use a reference loader so schemas can reference
+	// other schemas in the registry
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewReferenceLoader("file://" + filepath.ToSlash(absPath)))
+	if err != nil {
+		return nil, fmt.Errorf("error loading the schema %v for %v: %v", schemaFile, nameSpace, err)
+	}
+
+	r.schemas[nameSpace] = schema
+
+	return schema, nil
+}
+
+// schemaFile finds the schema file of the namespace,
+// an empty string is returned if there is no file.
+func (r *Registry) schemaFile(nameSpace string) string {
+
+	for _, name := range []string{nameSpace, register.MRXID(nameSpace)} {
+		if file, ok := r.index[name]; ok {
+			return filepath.Join(r.folder, file)
+		}
+	}
+
+	schemaFile := filepath.Join(r.folder, register.MRXID(nameSpace)+".json")
+	if _, err := os.Stat(schemaFile); err == nil {
+		return schemaFile
+	}
+
+	return ""
+}
+
+// Violation is a single error of a payload
+// not matching the schema of its namespace.
+type Violation struct {
+	Stream      int    `yaml:"Stream" json:"Stream"`
+	Frame       int    `yaml:"Frame" json:"Frame"`
+	NameSpace   string `yaml:"NameSpace" json:"NameSpace"`
+	Pointer     string `yaml:"Path" json:"Path"`
+	Description string `yaml:"Description" json:"Description"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("stream %v frame %v (%v) %v: %v", v.Stream, v.Frame, v.NameSpace, v.Pointer, v.Description)
+}
+
+func (v Violation) Error() string {
+	return v.String()
+}
+
+// Check validates a payload against the schema, any errors
+// are returned as violations for that stream and frame.
+func Check(schema *gojsonschema.Schema, payload []byte, stream, frame int, nameSpace string) []Violation {
+
+	result, err := schema.Validate(gojsonschema.NewBytesLoader(payload))
+	if err != nil {
+		// the payload is not json so could not be checked
+		return []Violation{{Stream: stream, Frame: frame, NameSpace: nameSpace, Pointer: "/",
+			Description: fmt.Sprintf("the payload could not be read as json: %v", err)}}
+	}
+
+	var violations []Violation
+	for _, schemaErr := range manifest.ResultErrors(result, "") {
+		violations = append(violations, Violation{Stream: stream, Frame: frame, NameSpace: nameSpace,
+			Pointer: schemaErr.Pointer, Description: schemaErr.Description})
+	}
+
+	return violations
+}
+
+// ValidatePayload checks a payload against the schema of the namespace, so
+// the registry can check payloads as they are encoded. Every violation
+// is returned as an error, payloads of namespaces without a schema are not checked.
+func (r *Registry) ValidatePayload(payload []byte, stream, frame int, nameSpace string) ([]error, error) {
+
+	schema, err := r.Schema(nameSpace)
+	if err != nil || schema == nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, violation := range Check(schema, payload, stream, frame, nameSpace) {
+		errs = append(errs, violation)
+	}
+
+	return errs, nil
+}
+
+// ValidateMRX checks every text payload in an mrx file against
+// the schema of its namespace. The namespaces are found in the manifest
+// of the file, streams without a schema in the registry are not checked.
+func ValidateMRX(mrxStream io.Reader, reg *Registry) ([]Violation, error) {
+
+	streams, err := decode.ExtractStreamData(mrxStream)
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+	for _, stream := range streams {
+		found = found || stream.EssenceType == "manifest"
+	}
+
+	if !found {
+		return nil, fmt.Errorf("no manifest found in the mrx file, so the namespaces of the streams are unknown")
+	}
+
+	violations := []Violation{}
+	for i, stream := range streams {
+		// only text can be checked against json schemas
+		if stream.EssenceType != "TC" && stream.EssenceType != "TE" {
+			continue
+		}
+
+		schema, err := reg.Schema(stream.NameSpace)
+		if err != nil {
+			return nil, err
+		}
+
+		if schema == nil {
+			continue
+		}
+
+		for frame, data := range stream.Data {
+			// empty frames are missing data, so have no payload to check
+			if len(data) == 0 {
+				continue
+			}
+
+			violations = append(violations, Check(schema, data, i, frame, stream.NameSpace)...)
+		}
+	}
+
+	return violations, nil
+}
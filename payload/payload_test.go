@@ -0,0 +1,92 @@
+package payload
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/metarex-media/mrx-tool/decode"
+	"github.com/metarex-media/mrx-tool/manifest"
+	"github.com/metarex-media/mrx-tool/register"
+	"github.com/metarex-media/mrx-tool/rewrap"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRegistry(t *testing.T) {
+
+	reg, regErr := LoadRegistry("./testdata/registry")
+	_, missingErr := LoadRegistry("./testdata/missing")
+
+	fileSchema, fileErr := reg.Schema("https://metarex.media/reg/MRX.123.456.789.gps")
+	indexSchema, indexErr := reg.Schema("https://metarex.media/reg/MRX.123.456.789.alt")
+	noSchema, noErr := reg.Schema("https://metarex.media/reg/MRX.123.456.789.000")
+
+	Convey("Checking the schemas of namespaces are found in the registry", t, func() {
+		Convey("using a registry with an index and a schema named after an MRX ID", func() {
+			Convey("the schemas are found by both methods, and namespaces without schemas have no schema", func() {
+				So(regErr, ShouldBeNil)
+				So(missingErr, ShouldNotBeNil)
+				So(fileErr, ShouldBeNil)
+				So(fileSchema, ShouldNotBeNil)
+				So(indexErr, ShouldBeNil)
+				So(indexSchema, ShouldNotBeNil)
+				So(noErr, ShouldBeNil)
+				So(noSchema, ShouldBeNil)
+				So(register.MRXID("https://metarex.media/reg/MRX.123.456.789.gps"), ShouldEqual, "MRX.123.456.789.gps")
+			})
+		})
+	})
+}
+
+func TestCheck(t *testing.T) {
+
+	nameSpace := "https://metarex.media/reg/MRX.123.456.789.gps"
+	reg, _ := LoadRegistry("./testdata/registry")
+	schema, _ := reg.Schema(nameSpace)
+
+	valid := Check(schema, []byte(`{"latitude": 51.5, "longitude": -0.12}`), 0, 0, nameSpace)
+	invalid := Check(schema, []byte(`{"latitude": "51.5"}`), 1, 3, nameSpace)
+	notJSON := Check(schema, []byte(`latitude: 51.5`), 1, 4, nameSpace)
+
+	Convey("Checking payloads are validated against their schema", t, func() {
+		Convey("using a valid payload, an invalid payload and a payload that is not json", func() {
+			Convey("only the invalid payloads have violations, with their stream, frame and path", func() {
+				So(valid, ShouldBeNil)
+				So(invalid, ShouldResemble, []Violation{
+					{Stream: 1, Frame: 3, NameSpace: nameSpace, Pointer: "/latitude", Description: "Invalid type. Expected: number, given: string"},
+					{Stream: 1, Frame: 3, NameSpace: nameSpace, Pointer: "/longitude", Description: "longitude is required"},
+				})
+				So(len(notJSON), ShouldEqual, 1)
+				So(notJSON[0].Frame, ShouldEqual, 4)
+			})
+		})
+	})
+}
+
+func TestValidateMRX(t *testing.T) {
+
+	nameSpace := "https://metarex.media/reg/MRX.123.456.789.gps"
+	reg, _ := LoadRegistry("./testdata/registry")
+
+	// a stream with a gap of empty frames, as written by the folder encoder
+	gapped := &rewrap.Rewrapper{
+		Streams: []*decode.DataFormat{{EssenceType: "TC", Data: [][]byte{
+			[]byte(`{"latitude": 51.5, "longitude": -0.12}`), {}, {}, []byte(`{"latitude": "51.5", "longitude": -0.12}`)}}},
+		Round: manifest.RoundTrip{Config: manifest.Configuration{StreamProperties: map[int]manifest.StreamProperties{0: {NameSpace: nameSpace}}}},
+	}
+
+	var mrx bytes.Buffer
+	encodeErr := gapped.Encode(&mrx, nil)
+	violations, validateErr := ValidateMRX(&mrx, reg)
+
+	Convey("Checking the payloads of an mrx file are validated against their schema", t, func() {
+		Convey("using a stream with a gap of empty frames and an invalid payload", func() {
+			Convey("only the invalid payload is a violation, the empty frames are not checked", func() {
+				So(encodeErr, ShouldBeNil)
+				So(validateErr, ShouldBeNil)
+				So(violations, ShouldResemble, []Violation{
+					{Stream: 0, Frame: 3, NameSpace: nameSpace, Pointer: "/latitude", Description: "Invalid type. Expected: number, given: string"},
+				})
+			})
+		})
+	})
+}
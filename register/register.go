@@ -0,0 +1,115 @@
+// Package register handles resolving metadata namespaces, with an
+// offline snapshot of the Metarex register.
+package register
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Entry is a single entry of the Metarex register.
+type Entry struct {
+	MRXID       string `json:"metarexId" yaml:"MRXID"`
+	Name        string `json:"name,omitempty" yaml:"Name,omitempty"`
+	Description string `json:"description,omitempty" yaml:"Description,omitempty"`
+	MediaType   string `json:"mediaType,omitempty" yaml:"MediaType,omitempty"`
+	// Schema and Mapping are the links to the schema
+	// of the metadata and how it maps to other metadata
+	Schema  string `json:"schema,omitempty" yaml:"Schema,omitempty"`
+	Mapping string `json:"mapping,omitempty" yaml:"Mapping,omitempty"`
+}
+
+// Register is a local snapshot of the Metarex register,
+// with the entries found by their MRX ID.
+type Register struct {
+	entries map[string]Entry
+}
+
+// Load loads a snapshot of the register. The snapshot can be
+// a json file or a folder of json files, where each file contains
+// a single register entry or an array of entries.
+func Load(snapshot string) (*Register, error) {
+
+	info, err := os.Stat(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("error opening the register snapshot: %v", err)
+	}
+
+	files := []string{snapshot}
+	if info.IsDir() {
+		files, err = filepath.Glob(filepath.Join(snapshot, "*.json"))
+		if err != nil {
+			return nil, fmt.Errorf("error searching the register snapshot: %v", err)
+		}
+		// keep the order consistent so later files always overwrite earlier ones
+		sort.Strings(files)
+	}
+
+	reg := &Register{entries: make(map[string]Entry)}
+	for _, file := range files {
+		entries, err := readEntries(file)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			reg.entries[entry.MRXID] = entry
+		}
+	}
+
+	return reg, nil
+}
+
+// readEntries reads the register entries in a file
+func readEntries(file string) ([]Entry, error) {
+
+	entryBytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %v: %v", file, err)
+	}
+
+	var entries []Entry
+	if trimmed := bytes.TrimSpace(entryBytes); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(entryBytes, &entries)
+	} else {
+		var entry Entry
+		err = json.Unmarshal(entryBytes, &entry)
+		entries = append(entries, entry)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the register entries in %v: %v", file, err)
+	}
+
+	for _, entry := range entries {
+		if entry.MRXID == "" {
+			return nil, fmt.Errorf("error parsing the register entries in %v: an entry has no metarexId", file)
+		}
+	}
+
+	return entries, nil
+}
+
+// MRXID returns the MRX ID of a namespace, which is the last
+// part of the namespace e.g. https://metarex.media/reg/MRX.123.456.789.gps
+// is MRX.123.456.789.gps
+func MRXID(nameSpace string) string {
+	return nameSpace[strings.LastIndex(nameSpace, "/")+1:]
+}
+
+// Resolve finds the register entry of a namespace,
+// false is returned if the namespace is not in the register.
+func (r *Register) Resolve(nameSpace string) (Entry, bool) {
+	if r == nil || nameSpace == "" {
+		return Entry{}, false
+	}
+
+	entry, ok := r.entries[MRXID(nameSpace)]
+
+	return entry, ok
+}
@@ -0,0 +1,43 @@
+package register
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLoad(t *testing.T) {
+
+	folder, folderErr := Load("./testdata/snapshot")
+	file, fileErr := Load("./testdata/snapshot/entries.json")
+	_, noIDErr := Load("./testdata/noid.json")
+	_, missingErr := Load("./testdata/missing")
+
+	gps, gpsFound := folder.Resolve("https://metarex.media/reg/MRX.123.456.789.gps")
+	sub, subFound := file.Resolve("MRX.123.456.789.sub")
+	_, gpsInFile := file.Resolve("https://metarex.media/reg/MRX.123.456.789.gps")
+	_, emptyFound := folder.Resolve("")
+
+	Convey("Checking register snapshots are loaded and namespaces are resolved", t, func() {
+		Convey("using a folder of entries and a file with an array of entries", func() {
+			Convey("the namespaces are resolved to their entries by their MRX ID", func() {
+				So(folderErr, ShouldBeNil)
+				So(fileErr, ShouldBeNil)
+				So(gpsFound, ShouldBeTrue)
+				So(gps, ShouldResemble, Entry{MRXID: "MRX.123.456.789.gps", Name: "GPS position", Description: "The latitude and longitude of the camera",
+					MediaType: "application/json", Schema: "https://metarex.media/reg/MRX.123.456.789.gps/schema.json",
+					Mapping: "https://metarex.media/reg/MRX.123.456.789.gps/mapping.json"})
+				So(subFound, ShouldBeTrue)
+				So(sub.MediaType, ShouldEqual, "text/vtt")
+				So(gpsInFile, ShouldBeFalse)
+				So(emptyFound, ShouldBeFalse)
+			})
+		})
+		Convey("using an entry without an MRX ID and a missing snapshot", func() {
+			Convey("an error is returned", func() {
+				So(noIDErr, ShouldNotBeNil)
+				So(missingErr, ShouldNotBeNil)
+			})
+		})
+	})
+}
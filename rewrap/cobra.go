@@ -0,0 +1,428 @@
+package rewrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/metarex-media/mrx-tool/encode"
+	"github.com/metarex-media/mrx-tool/manifest"
+	"github.com/spf13/cobra"
+)
+
+var rewrapFlags, trimFlags, demuxFlags, segmentFlags encodeFlags
+var muxFlags = encodeFlags{several: true}
+var concatFlags = encodeFlags{several: true}
+
+var rewrapOverWrite string
+var trimInPoint string
+var trimOutPoint string
+var muxAlign string
+var demuxStreams string
+var segmentSeconds float64
+var segmentPlaylist string
+
+func init() {
+	rewrapFlags.register(RewrapCmd, "identifies the mrx file to be rewrapped", "the name of the file to be generated", "rewrap")
+	RewrapCmd.Flags().StringVar(&rewrapOverWrite, "overwrite", "", "a json string to overwrite some or all of the configuration of the mrx file")
+
+	trimFlags.register(TrimCmd, "identifies the mrx file to be trimmed", "the name of the file to be generated", "newcontent")
+	TrimCmd.Flags().StringVar(&trimInPoint, "in", "", "the first frame to keep, as a frame number or HH:MM:SS:FF timecode. Defaults to the start of the file")
+	TrimCmd.Flags().StringVar(&trimOutPoint, "out", "", "the frame after the last frame to keep, as a frame number or HH:MM:SS:FF timecode. Defaults to the end of the file")
+
+	muxFlags.register(MuxCmd, "the mrx files to be muxed, separated by commas e.g. tracking.mrx,lens.mrx", "the name of the file to be generated", "newcontent")
+	MuxCmd.Flags().StringVar(&muxAlign, "align", "frame", "how the files are lined up, one of frame or timecode")
+
+	demuxFlags.register(DemuxCmd, "identifies the mrx file to be demuxed", "the folder the mrx file of each stream is generated in", "newcontent")
+	DemuxCmd.Flags().StringVar(&demuxStreams, "streams", "", "the streams to be demuxed, separated by commas e.g. 0,2. Defaults to every stream")
+
+	concatFlags.register(ConcatCmd, "the mrx files to be concatenated in order, separated by commas e.g. part1.mrx,part2.mrx", "the name of the file to be generated", "newcontent")
+
+	segmentFlags.register(SegmentCmd, "identifies the mrx file to be segmented", "the folder the segments and playlist are generated in", "newcontent")
+	SegmentCmd.Flags().Float64Var(&segmentSeconds, "seconds", 10, "the duration of each segment in seconds")
+	SegmentCmd.Flags().StringVar(&segmentPlaylist, "playlist", "", "the name of the playlist json file, defaults to the name of the input file with _playlist.json in the output folder")
+}
+
+var RewrapCmd = &cobra.Command{
+	Use:   "rewrap",
+	Short: "Re-encode an mrx file with a new configuration",
+	Long: `The rewrap flag encodes the data streams of an mrx file as a new mrx file,
+without saving the metadata to files in between.
+
+The configuration of the mrx file is changed with the --overwrite flag, which
+is a json string of the configuration fields to change, e.g. to change the namespace of the first stream
+--overwrite '{"StreamProperties": {"0": {"NameSpace": "https://metarex.media/reg/MRX.123.456.789.gps"}}}'
+
+The manifest of the mrx file becomes the previous manifest of the new file,
+all of the manifest history is kept unless the --previousManifest flag is used.
+The stream and essence properties of the manifest are kept, such as the extra user metadata.
+
+The UMID of the new file is derived from the mrx file, using the --umidRule flag.
+- rewrap keeps the material number and increments the instance number (the default)
+- newcontent generates a new material number, with the source package referencing the original
+- new ignores the previous UMID`,
+
+	RunE: Run,
+}
+
+// Run rewraps the input mrx file with the command line options
+func Run(_ *cobra.Command, _ []string) error {
+
+	var update manifest.Configuration
+	if rewrapOverWrite != "" {
+		err := manifest.ConfigValidator([]byte(rewrapOverWrite))
+		if err != nil {
+			return fmt.Errorf("error validating \"%s\" : %v", rewrapOverWrite, err)
+		}
+
+		err = json.Unmarshal([]byte(rewrapOverWrite), &update)
+		if err != nil {
+			return fmt.Errorf("error parsing \"%s\" : %v", rewrapOverWrite, err)
+		}
+	}
+
+	return rewrapFlags.run(func(sources []*Rewrapper, options *encode.MrxEncodeOptions) (*Rewrapper, error) {
+		options.ConfigOverWrite = update
+		return sources[0], nil
+	})
+}
+
+var TrimCmd = &cobra.Command{
+	Use:   "trim",
+	Short: "Cut a range of frames from an mrx file",
+	Long: `The trim flag encodes a range of frames of an mrx file as a new mrx file.
+
+The range is given by the --in and --out flags, the in frame is kept and
+the out frame is not, in the same way as the cut points of an edit decision list.
+The points are either frame numbers from the start of the file e.g. --in 10 --out 20,
+or HH:MM:SS:FF timecodes from the start timecode of the file e.g. --in 01:00:00:10.
+Frames and timecodes are at the frame rate of the first clocked stream.
+
+Every clocked stream is trimmed to the range and the clip wrapped streams are kept as they are.
+The start timecode of the new file is the in point, and the trim is recorded
+as the edit of the previous manifest in the manifest history.
+
+The UMID of the new file is derived from the mrx file, using the --umidRule flag.
+- newcontent generates a new material number, with the source package referencing the original (the default)
+- rewrap keeps the material number and increments the instance number
+- new ignores the previous UMID`,
+
+	RunE: RunTrim,
+}
+
+// RunTrim trims the input mrx file with the command line options
+func RunTrim(_ *cobra.Command, _ []string) error {
+
+	return trimFlags.run(func(sources []*Rewrapper, _ *encode.MrxEncodeOptions) (*Rewrapper, error) {
+		return sources[0], sources[0].Trim(trimInPoint, trimOutPoint)
+	})
+}
+
+var MuxCmd = &cobra.Command{
+	Use:   "mux",
+	Short: "Combine the streams of several mrx files into one mrx file",
+	Long: `The mux flag combines the data streams of several mrx files into a single mrx file,
+such as tracking, lens and IMU data of the same shot from different devices.
+
+The files are given with the --input flag, separated by commas, and
+their streams are muxed in the order of the files.
+The files are lined up with the --align flag.
+- frame lines up the first frame of every file (the default)
+- timecode lines up the files by their start timecodes, the files that start after
+the earliest file begin with empty frames
+
+The clocked streams must have frame rates that are whole multiples of the frame rate of the first clocked stream.
+The configuration and the stream and essence properties of every stream are kept.
+The manifest of the first file becomes the previous manifest of the new file, and the manifests
+of the other files follow it in the manifest history. Each manifest records the streams it became as its edit.`,
+
+	RunE: RunMux,
+}
+
+// RunMux muxes the input mrx files with the command line options
+func RunMux(_ *cobra.Command, _ []string) error {
+
+	align, err := ParseAlignment(muxAlign)
+	if err != nil {
+		return err
+	}
+
+	return muxFlags.run(func(sources []*Rewrapper, _ *encode.MrxEncodeOptions) (*Rewrapper, error) {
+		return Mux(sources, align)
+	})
+}
+
+var DemuxCmd = &cobra.Command{
+	Use:   "demux",
+	Short: "Extract streams of an mrx file into their own mrx files",
+	Long: `The demux flag extracts data streams of an mrx file, each into its own mrx file.
+
+The streams are chosen with the --streams flag, separated by commas e.g. --streams 0,2,
+every stream is extracted if no streams are chosen. The mrx files are generated in the
+--output folder and are named after the input file and the stream, e.g. shot_stream0.mrx.
+
+The configuration, the start timecode and the stream and essence properties of each stream are kept.
+The manifest of the mrx file becomes the previous manifest of each new file,
+with the streams that were extracted as its edit.`,
+
+	RunE: RunDemux,
+}
+
+// RunDemux demuxes the input mrx file with the command line options
+func RunDemux(_ *cobra.Command, _ []string) error {
+
+	sources, options, err := demuxFlags.open()
+	if err != nil {
+		return err
+	}
+	source := sources[0]
+
+	streams := make([]int, 0)
+	if demuxStreams == "" {
+		for i := range source.Streams {
+			streams = append(streams, i)
+		}
+	} else {
+		for _, stream := range strings.Split(strings.ReplaceAll(demuxStreams, " ", ""), ",") {
+			streamNo, err := strconv.Atoi(stream)
+			if err != nil {
+				return fmt.Errorf("error parsing the stream %v of \"%s\": %v", stream, demuxStreams, err)
+			}
+
+			streams = append(streams, streamNo)
+		}
+	}
+
+	err = os.MkdirAll(demuxFlags.output, 0777)
+	if err != nil {
+		return err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(demuxFlags.input), filepath.Ext(demuxFlags.input))
+	for _, stream := range streams {
+		demuxed, err := source.Demux([]int{stream})
+		if err != nil {
+			return err
+		}
+
+		err = encodeFile(demuxed, filepath.Join(demuxFlags.output, fmt.Sprintf("%v_stream%v.mrx", name, stream)), options)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var ConcatCmd = &cobra.Command{
+	Use:   "concat",
+	Short: "Join mrx files end to end into one mrx file",
+	Long: `The concat flag appends the clocked streams of several mrx files end to end, into one continuous mrx file,
+such as a recording that was split into several files by the capture device.
+
+The files are given with the --input flag, separated by commas, in the order they are joined.
+Every file must have the same clocked streams as the first file, with the same essence types, namespaces and frame rates.
+Files with streams of different lengths are padded with empty frames to their longest stream.
+
+The clip wrapped streams are merged, so a clip wrapped stream that is the same in every file is only kept once.
+The start timecode of the first file is kept. The manifest of the first file becomes the previous manifest
+of the new file, and the manifests of the other files follow it in the manifest history.
+Each manifest records the frames it became as its edit.`,
+
+	RunE: RunConcat,
+}
+
+// RunConcat concatenates the input mrx files with the command line options
+func RunConcat(_ *cobra.Command, _ []string) error {
+
+	return concatFlags.run(func(sources []*Rewrapper, _ *encode.MrxEncodeOptions) (*Rewrapper, error) {
+		return Concat(sources)
+	})
+}
+
+var SegmentCmd = &cobra.Command{
+	Use:   "segment",
+	Short: "Split an mrx file into segments of a fixed duration",
+	Long: `The segment flag splits an mrx file into self contained mrx files of the same duration,
+such as for delivering the metadata alongside segmented video, or processing a long recording in parallel.
+
+The duration of each segment is given in seconds with the --seconds flag, the last segment may be shorter.
+Each segment has its own header and manifest, the clocked streams are trimmed to the frames of the segment
+and every clip wrapped stream is kept. The timecode of each segment continues from the previous segment.
+
+The segments are generated in the --output folder and are named after the input file and the segment number,
+e.g. shot_segment0001.mrx. A json playlist is generated with them, listing the file, start timecode
+and frames of each segment, where the end frame is the frame after the last frame of the segment.
+
+The whole mrx file is decoded into memory before it is segmented, so the file must fit in memory.
+The segments share the decoded data streams, so they do not use any more memory as they are encoded.`,
+
+	RunE: RunSegment,
+}
+
+// RunSegment segments the input mrx file with the command line options
+func RunSegment(_ *cobra.Command, _ []string) error {
+
+	sources, options, err := segmentFlags.open()
+	if err != nil {
+		return err
+	}
+
+	playlist, err := sources[0].Segment(segmentSeconds)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(segmentFlags.output, 0777)
+	if err != nil {
+		return err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(segmentFlags.input), filepath.Ext(segmentFlags.input))
+	for i, segment := range playlist.Segments {
+		// the playlist is next to the segments, so only has their names
+		playlist.Segments[i].File = fmt.Sprintf("%v_segment%04d.mrx", name, i+1)
+
+		err = encodeFile(segment.Rewrapper, filepath.Join(segmentFlags.output, playlist.Segments[i].File), options)
+		if err != nil {
+			return err
+		}
+	}
+
+	playlistBytes, err := json.MarshalIndent(playlist, "", "    ")
+	if err != nil {
+		return fmt.Errorf("error encoding the playlist: %v", err)
+	}
+
+	if segmentPlaylist == "" {
+		segmentPlaylist = filepath.Join(segmentFlags.output, name+"_playlist.json")
+	}
+
+	err = os.WriteFile(segmentPlaylist, playlistBytes, 0644)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%v has been generated \n", segmentPlaylist)
+
+	return nil
+}
+
+// encodeFlags are the input, output and encoding
+// flags that every rewrap command has.
+type encodeFlags struct {
+	input         string
+	output        string
+	manifestCount int
+	umidRule      string
+	// several is set if the input is several
+	// mrx files separated by commas
+	several bool
+}
+
+// register adds the flags to the command,
+// with the usage of the input and output and the default UMID rule.
+func (e *encodeFlags) register(cmd *cobra.Command, inputUsage, outputUsage, umidRule string) {
+
+	umidUsage := "how the UMID is derived from the manifest of the mrx file, one of new, rewrap or newcontent"
+	if e.several {
+		umidUsage = "how the UMID is derived from the manifest of the first mrx file, one of new, rewrap or newcontent"
+	}
+
+	cmd.Flags().StringVar(&e.input, "input", "", inputUsage)
+	cmd.Flags().StringVar(&e.output, "output", "", outputUsage)
+	cmd.Flags().IntVar(&e.manifestCount, "previousManifest", -1, "The count of previous manifests to be included in the manifest, from 0 upwards. -1 is show all")
+	cmd.Flags().StringVar(&e.umidRule, "umidRule", umidRule, umidUsage)
+}
+
+// open checks the flags and decodes the input mrx files,
+// returning them with the encode options of the flags.
+func (e *encodeFlags) open() ([]*Rewrapper, *encode.MrxEncodeOptions, error) {
+
+	switch {
+	case e.input == "" && e.several:
+		return nil, nil, fmt.Errorf("no input files chosen please use the --input flag")
+	case e.input == "":
+		return nil, nil, fmt.Errorf("no input file chosen please use the --input flag")
+	case e.output == "":
+		return nil, nil, fmt.Errorf("no output destination chosen please use the --output flag")
+	}
+
+	derivation, err := encode.ParseDerivation(e.umidRule)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !e.several {
+		source, err := openRewrapper(e.input)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return []*Rewrapper{source}, &encode.MrxEncodeOptions{ManifestHistoryCount: e.manifestCount, Derivation: derivation}, nil
+	}
+
+	inputs := strings.Split(e.input, ",")
+	sources := make([]*Rewrapper, len(inputs))
+	for i, input := range inputs {
+		sources[i], err = openRewrapper(strings.TrimSpace(input))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading %v: %v", input, err)
+		}
+	}
+
+	return sources, &encode.MrxEncodeOptions{ManifestHistoryCount: e.manifestCount, Derivation: derivation}, nil
+}
+
+// run decodes the input mrx files, edits them into one mrx file then
+// encodes it to the output file. The edit can change the encode options.
+func (e *encodeFlags) run(edit func(sources []*Rewrapper, options *encode.MrxEncodeOptions) (*Rewrapper, error)) error {
+
+	// the inputs are decoded before the output is made,
+	// so the output can not overwrite the inputs
+	sources, options, err := e.open()
+	if err != nil {
+		return err
+	}
+
+	edited, err := edit(sources, options)
+	if err != nil {
+		return err
+	}
+
+	return encodeFile(edited, e.output, options)
+}
+
+// openRewrapper decodes the mrx file at path
+func openRewrapper(path string) (*Rewrapper, error) {
+
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	return NewRewrapper(in)
+}
+
+// encodeFile encodes the rewrapper to a new file at path
+func encodeFile(r *Rewrapper, path string, options *encode.MrxEncodeOptions) error {
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	err = r.Encode(out, options)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%v has been generated \n", path)
+
+	return nil
+}
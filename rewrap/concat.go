@@ -0,0 +1,160 @@
+package rewrap
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	"github.com/metarex-media/mrx-tool/manifest"
+)
+
+// Concat appends the clocked streams of the sources end to end, in the order
+// of the sources, as one continuous rewrapper. Every source must have the same
+// clocked streams as the first, with matching essence types, namespaces and frame rates.
+// Sources with streams of different lengths are padded with empty frames
+// to their longest stream, so the frames of the next source stay lined up.
+//
+// The clip wrapped streams are merged, a clip wrapped stream that is the same as
+// one from an earlier source is only kept once. The start timecode of the first
+// source is kept, and the manifests of the sources are kept in the manifest history,
+// with the frames each source became as its Edit.
+func Concat(sources []*Rewrapper) (*Rewrapper, error) {
+
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("error there are no mrx files to concatenate")
+	}
+
+	first := sources[0]
+	_, baseRate, err := first.baseStream()
+	if err != nil {
+		return nil, fmt.Errorf("error concatenating the first mrx file: %v", err)
+	}
+
+	concat := &Rewrapper{Round: manifest.RoundTrip{Config: manifest.Configuration{Version: first.Round.Config.Version,
+		StartTimecode: first.Round.Config.StartTimecode, StreamProperties: make(map[int]manifest.StreamProperties)}}}
+
+	// the clocked streams of the first file are the layout every file follows
+	layout := first.clockedStreams()
+	multipliers := make([]int, len(layout))
+	for i, stream := range layout {
+		properties := first.Round.Config.Stream(stream)
+
+		multipliers[i] = multipleOf(properties.FrameRate, baseRate)
+		if multipliers[i] == 0 {
+			return nil, fmt.Errorf("error stream %v of mrx file 0 has a frame rate of %v, which is not a whole multiple of the base frame rate %v",
+				stream, properties.FrameRate, baseRate)
+		}
+
+		concatStream := *first.Streams[stream]
+		concatStream.Data = nil
+		concat.Round.Config.StreamProperties[i] = properties
+		concat.Streams = append(concat.Streams, &concatStream)
+		concat.Properties = append(concat.Properties, manifest.Overview{Common: first.overview(stream).Common})
+	}
+
+	edits := make([]string, len(sources))
+	frame := 0
+	var clips []int
+	for i, source := range sources {
+		clockedStreams := source.clockedStreams()
+		if len(clockedStreams) != len(layout) {
+			return nil, fmt.Errorf("error mrx file %v has %v clocked streams, instead of the %v of the first mrx file", i, len(clockedStreams), len(layout))
+		}
+
+		// the length of the file in frames of the base frame rate
+		length := 0
+		for j, stream := range clockedStreams {
+			if err := matchStream(first, layout[j], source, stream); err != nil {
+				return nil, fmt.Errorf("error clocked stream %v of mrx file %v does not match the first mrx file: %v", j, i, err)
+			}
+
+			length = max(length, (len(source.Streams[stream].Data)+multipliers[j]-1)/multipliers[j])
+		}
+
+		for j, stream := range clockedStreams {
+			// pad the shorter streams with empty frames
+			size := length * multipliers[j]
+			data := source.Streams[stream].Data
+			essence := cut(source.overview(stream).Essence, 0, size)
+
+			concat.Streams[j].Data = append(append(concat.Streams[j].Data, data...), make([][]byte, size-len(data))...)
+			concat.Properties[j].Essence = append(append(concat.Properties[j].Essence, essence...),
+				make([]manifest.EssenceProperties, size-len(essence))...)
+		}
+
+		edits[i] = fmt.Sprintf("concat as frames %v to %v", frame, frame+length)
+		frame += length
+
+		for stream, data := range source.Streams {
+			if clocked(data.EssenceType) || slices.ContainsFunc(clips, func(clip int) bool { return sameClip(concat, clip, source, stream) }) {
+				continue
+			}
+
+			clips = append(clips, len(concat.Streams))
+			clipStream := *data
+			concat.Round.Config.StreamProperties[len(concat.Streams)] = source.Round.Config.Stream(stream)
+			concat.Streams = append(concat.Streams, &clipStream)
+			overview := source.overview(stream)
+			concat.Properties = append(concat.Properties, manifest.Overview{Common: overview.Common, Essence: slices.Clone(overview.Essence)})
+		}
+	}
+
+	concat.Round.Manifest, concat.Edit = sourceManifest(sources, edits)
+
+	return concat, nil
+}
+
+// clockedStreams returns the positions of the clocked streams
+func (r *Rewrapper) clockedStreams() []int {
+
+	var streams []int
+	for i, stream := range r.Streams {
+		if clocked(stream.EssenceType) {
+			streams = append(streams, i)
+		}
+	}
+
+	return streams
+}
+
+// overview returns the stream and essence properties of a stream
+func (r *Rewrapper) overview(stream int) manifest.Overview {
+
+	if stream < len(r.Properties) {
+		return r.Properties[stream]
+	}
+
+	return manifest.Overview{}
+}
+
+// matchStream checks a stream of a source has the same essence
+// type, namespace and frame rate as a stream of the first source.
+func matchStream(first *Rewrapper, firstStream int, source *Rewrapper, stream int) error {
+
+	if want, got := first.Streams[firstStream].EssenceType, source.Streams[stream].EssenceType; want != got {
+		return fmt.Errorf("the essence type is %v instead of %v", got, want)
+	}
+
+	if want, got := first.Round.Config.StreamNameSpace(firstStream), source.Round.Config.StreamNameSpace(stream); want != got {
+		return fmt.Errorf("the namespace is %v instead of %v", got, want)
+	}
+
+	if want, got := first.Round.Config.StreamFrameRate(firstStream), source.Round.Config.StreamFrameRate(stream); want != got {
+		return fmt.Errorf("the frame rate is %v instead of %v", got, want)
+	}
+
+	return nil
+}
+
+// sameClip checks if a clip wrapped stream of a source is the same as a
+// clip wrapped stream that has been concatenated, with the same
+// essence type, namespace and data.
+func sameClip(concat *Rewrapper, clip int, source *Rewrapper, stream int) bool {
+
+	if concat.Streams[clip].EssenceType != source.Streams[stream].EssenceType ||
+		concat.Round.Config.StreamNameSpace(clip) != source.Round.Config.StreamNameSpace(stream) {
+		return false
+	}
+
+	return slices.EqualFunc(concat.Streams[clip].Data, source.Streams[stream].Data, bytes.Equal)
+}
@@ -0,0 +1,93 @@
+package rewrap
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/metarex-media/mrx-tool/decode"
+	"github.com/metarex-media/mrx-tool/encode"
+	"github.com/metarex-media/mrx-tool/manifest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConcat(t *testing.T) {
+
+	mrxBytes, _ := os.ReadFile("../decode/testdata/namespaces.mrx")
+	original, _ := decode.ExtractStreamData(bytes.NewReader(mrxBytes))
+	originalRound := roundTrip(mrxBytes)
+
+	// split the file in two and join it back together
+	parts := make([]*Rewrapper, 2)
+	for i, trim := range [][2]string{{"", "1"}, {"1", ""}} {
+		part, _ := NewRewrapper(bytes.NewReader(mrxBytes))
+		part.Trim(trim[0], trim[1])
+		var partFile bytes.Buffer
+		part.Encode(&partFile, &encode.MrxEncodeOptions{ManifestHistoryCount: -1})
+		parts[i], _ = NewRewrapper(bytes.NewReader(partFile.Bytes()))
+	}
+
+	concat, concatErr := Concat(parts)
+	var concatFile bytes.Buffer
+	encodeErr := concat.Encode(&concatFile, &encode.MrxEncodeOptions{ManifestHistoryCount: -1})
+	streams, _ := decode.ExtractStreamData(bytes.NewReader(concatFile.Bytes()))
+	round := roundTrip(concatFile.Bytes())
+
+	// clip wrapped streams that are different are both kept
+	source, _ := NewRewrapper(bytes.NewReader(mrxBytes))
+	changed, _ := NewRewrapper(bytes.NewReader(mrxBytes))
+	changed.Streams[1].Data = [][]byte{[]byte(`{"altitude": 10}`)}
+	clips, clipsErr := Concat([]*Rewrapper{source, changed})
+
+	// streams of different lengths are padded to the longest
+	uneven, _ := Mux([]*Rewrapper{parts[1], source}, AlignFrame)
+	padded, paddedErr := Concat([]*Rewrapper{uneven, uneven})
+
+	renamed, _ := NewRewrapper(bytes.NewReader(mrxBytes))
+	renamed.Round.Config.StreamProperties[0] = manifest.StreamProperties{NameSpace: "https://example.com/ns", FrameRate: "24/1"}
+	_, nameSpaceErr := Concat([]*Rewrapper{source, renamed})
+	clipOnly, _ := source.Demux([]int{1})
+	_, layoutErr := Concat([]*Rewrapper{source, clipOnly})
+	_, emptyErr := Concat(nil)
+
+	Convey("Checking mrx files are concatenated end to end", t, func() {
+		Convey("using the two halves of a split mrx file", func() {
+			Convey("the original streams are made again, with each half in the manifest history", func() {
+				So(concatErr, ShouldBeNil)
+				So(encodeErr, ShouldBeNil)
+				So(len(streams), ShouldEqual, len(original))
+				So(streams[0].Data, ShouldResemble, original[0].Data)
+				So(streams[1].Data, ShouldResemble, original[1].Data)
+				So(round.Config.StartTimecode, ShouldEqual, "00:00:00:00")
+				So(round.Manifest.DataStreams[0].Essence, ShouldResemble, originalRound.Manifest.DataStreams[0].Essence)
+				So(round.Manifest.History[0].Edit, ShouldEqual, "concat as frames 0 to 1")
+				So(round.Manifest.History[1].Edit, ShouldEqual, "concat as frames 1 to 3")
+				So(round.Manifest.History[2].Edit, ShouldEqual, "trim of frames 1 to 3, from 00:00:00:01 to 00:00:00:03")
+			})
+		})
+		Convey("using files with different clip wrapped streams", func() {
+			Convey("both clip wrapped streams are kept", func() {
+				So(clipsErr, ShouldBeNil)
+				So(len(clips.Streams), ShouldEqual, 3)
+				So(len(clips.Streams[0].Data), ShouldEqual, 6)
+				So(clips.Streams[2].Data, ShouldResemble, [][]byte{[]byte(`{"altitude": 10}`)})
+			})
+		})
+		Convey("using files with clocked streams of different lengths", func() {
+			Convey("the shorter streams are padded with empty frames", func() {
+				So(paddedErr, ShouldBeNil)
+				So(padded.Streams[0].Data, ShouldResemble, [][]byte{original[0].Data[1], original[0].Data[2], nil, original[0].Data[1], original[0].Data[2], nil})
+				So(len(padded.Properties[0].Essence), ShouldEqual, 6)
+				So(len(padded.Streams[1].Data), ShouldEqual, 6)
+			})
+		})
+		Convey("using files with different stream layouts", func() {
+			Convey("an error is returned", func() {
+				So(nameSpaceErr, ShouldResemble, fmt.Errorf("error clocked stream 0 of mrx file 1 does not match the first mrx file: the namespace is https://example.com/ns instead of https://metarex.media/reg/MRX.123.456.789.gps"))
+				So(layoutErr, ShouldResemble, fmt.Errorf("error mrx file 1 has 0 clocked streams, instead of the 1 of the first mrx file"))
+				So(emptyErr, ShouldResemble, fmt.Errorf("error there are no mrx files to concatenate"))
+			})
+		})
+	})
+}
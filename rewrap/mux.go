@@ -0,0 +1,318 @@
+package rewrap
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/metarex-media/mrx-tool/decode"
+	"github.com/metarex-media/mrx-tool/manifest"
+)
+
+// Alignment is how the frames of mrx files are lined up when they are muxed
+type Alignment int
+
+const (
+	// AlignFrame lines up the first frame of every file.
+	AlignFrame Alignment = iota
+	// AlignTimecode lines up the files by their start timecodes,
+	// files that start after the earliest file begin with empty frames.
+	AlignTimecode
+)
+
+// ParseAlignment converts a string of frame or timecode
+// into an Alignment.
+func ParseAlignment(align string) (Alignment, error) {
+	switch strings.ToLower(align) {
+	case "", "frame":
+		return AlignFrame, nil
+	case "timecode":
+		return AlignTimecode, nil
+	default:
+		return AlignFrame, fmt.Errorf("unknown alignment \"%s\", please use one of frame or timecode", align)
+	}
+}
+
+// Mux combines the data streams of the sources into a single rewrapper,
+// in the order of the sources, with the clocked streams before the clip wrapped
+// streams as they are encoded. The clocked streams must have frame rates
+// that are whole multiples of the base frame rate, which is the frame rate of
+// the first clocked stream. The configuration of every stream is kept.
+//
+// The manifest of the first source with a manifest is the previous manifest of the
+// muxed file, the manifests of the other sources follow it in the manifest history.
+// Each is recorded with the streams it became as its Edit.
+func Mux(sources []*Rewrapper, align Alignment) (*Rewrapper, error) {
+
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("error there are no mrx files to mux")
+	}
+
+	muxed := &Rewrapper{Round: manifest.RoundTrip{Config: manifest.Configuration{Version: sources[0].Round.Config.Version,
+		StreamProperties: make(map[int]manifest.StreamProperties)}}}
+
+	offsets, err := muxOffsets(sources, align, &muxed.Round.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	var clockedStreams, clipStreams []muxStream
+	baseRate := ""
+	for i, source := range sources {
+		for j, stream := range source.Streams {
+
+			mux := muxStream{source: i, stream: *stream, properties: source.Round.Config.Stream(j)}
+			if j < len(source.Properties) {
+				mux.overview = source.Properties[j]
+			}
+
+			if !clocked(stream.EssenceType) {
+				mux.overview.Essence = slices.Clone(mux.overview.Essence)
+				clipStreams = append(clipStreams, mux)
+				continue
+			}
+
+			// the edit rates are checked against the first clocked stream
+			if baseRate == "" {
+				baseRate = mux.properties.FrameRate
+			}
+
+			multiplier := multipleOf(mux.properties.FrameRate, baseRate)
+			if multiplier == 0 {
+				return nil, fmt.Errorf("error stream %v of mrx file %v has a frame rate of %v, which is not a whole multiple of the base frame rate %v",
+					j, i, mux.properties.FrameRate, baseRate)
+			}
+
+			// empty frames are missing data, which
+			// is used to line up the later files
+			padding := offsets[i] * multiplier
+			mux.stream.Data = append(make([][]byte, padding), stream.Data...)
+			mux.overview.Essence = append(make([]manifest.EssenceProperties, padding), mux.overview.Essence...)
+			clockedStreams = append(clockedStreams, mux)
+		}
+	}
+
+	if len(clockedStreams)+len(clipStreams) == 0 {
+		return nil, fmt.Errorf("error no data streams were found in the mrx files")
+	}
+
+	// the streams each source became, for the manifest history
+	positions := make([][]string, len(sources))
+	for _, mux := range append(clockedStreams, clipStreams...) {
+		positions[mux.source] = append(positions[mux.source], fmt.Sprint(len(muxed.Streams)))
+		muxed.Round.Config.StreamProperties[len(muxed.Streams)] = mux.properties
+		muxed.Streams = append(muxed.Streams, &mux.stream)
+		muxed.Properties = append(muxed.Properties, mux.overview)
+	}
+
+	edits := make([]string, len(sources))
+	for i, position := range positions {
+		edits[i] = fmt.Sprintf("mux as streams %v", strings.Join(position, ", "))
+	}
+
+	muxed.Round.Manifest, muxed.Edit = sourceManifest(sources, edits)
+
+	return muxed, nil
+}
+
+// muxStream is a data stream of a source and its properties
+type muxStream struct {
+	source     int
+	stream     decode.DataFormat
+	properties manifest.StreamProperties
+	overview   manifest.Overview
+}
+
+// muxOffsets returns the number of empty frames, at the base frame rate,
+// each source starts with and sets the start timecode of the muxed file.
+func muxOffsets(sources []*Rewrapper, align Alignment, config *manifest.Configuration) ([]int, error) {
+
+	offsets := make([]int, len(sources))
+
+	base := -1
+	for i, source := range sources {
+		if _, _, err := source.baseStream(); err == nil {
+			base = i
+			break
+		}
+	}
+
+	// files of only clip wrapped streams have no timecode
+	if base == -1 {
+		return offsets, nil
+	}
+
+	if align == AlignFrame {
+		config.StartTimecode = sources[base].Round.Config.StartTimecode
+
+		return offsets, nil
+	}
+
+	_, baseRate, _ := sources[base].baseStream()
+	starts := make([]int, len(sources))
+	earliest := -1
+	for i, source := range sources {
+		// only files with clocked streams have a timecode to line up
+		if _, _, err := source.baseStream(); err != nil {
+			continue
+		}
+
+		start, err := source.startFrame(baseRate)
+		if err != nil {
+			return nil, fmt.Errorf("error finding the start of mrx file %v: %v", i, err)
+		}
+
+		starts[i] = start
+		if earliest == -1 || start < earliest {
+			earliest = start
+		}
+	}
+
+	for i, start := range starts {
+		offsets[i] = max(start-earliest, 0)
+	}
+
+	if earliest > 0 {
+		fps, _ := manifest.NominalFPS(baseRate)
+		config.StartTimecode = manifest.FormatTimecode(earliest, fps)
+	}
+
+	return offsets, nil
+}
+
+// sourceManifest returns the previous manifest of a file made from the sources,
+// which is the manifest of the first source with a manifest. The manifests of the
+// other sources are in its history. The edit of each source is what it became.
+func sourceManifest(sources []*Rewrapper, edits []string) (manifest.Manifest, string) {
+
+	var previous manifest.Manifest
+	var edit string
+	var history []manifest.TaggedManifest
+
+	for i, source := range sources {
+		// files without a manifest have no history to keep
+		if source.Round.Manifest.UMID == "" {
+			continue
+		}
+
+		if edit == "" {
+			previous, edit = source.Round.Manifest, edits[i]
+			continue
+		}
+
+		tagged := manifest.TaggedManifest{Edit: edits[i], Manifest: source.Round.Manifest}
+		tagged.History = nil
+		history = append(history, tagged)
+		history = append(history, source.Round.Manifest.History...)
+	}
+
+	previous.History = append(history, previous.History...)
+
+	return previous, edit
+}
+
+// Demux returns a rewrapper of the chosen data streams, in the order they are
+// chosen. The configuration of the streams and the manifest of the
+// mrx file are kept, and the demux is recorded as the Edit.
+func (r *Rewrapper) Demux(streams []int) (*Rewrapper, error) {
+
+	if len(streams) == 0 {
+		return nil, fmt.Errorf("error no data streams were chosen to demux")
+	}
+
+	demuxed := &Rewrapper{Round: manifest.RoundTrip{Config: manifest.Configuration{Version: r.Round.Config.Version,
+		StreamProperties: make(map[int]manifest.StreamProperties)}, Manifest: r.Round.Manifest}}
+
+	chosen := make([]string, len(streams))
+	for i, stream := range streams {
+		if stream < 0 || stream >= len(r.Streams) {
+			return nil, fmt.Errorf("error stream %v is not in the mrx file, which has %v data streams", stream, len(r.Streams))
+		}
+
+		if slices.Contains(streams[:i], stream) {
+			return nil, fmt.Errorf("error stream %v is chosen more than once", stream)
+		}
+
+		demuxStream := *r.Streams[stream]
+		properties := r.Round.Config.Stream(stream)
+
+		var overview manifest.Overview
+		if stream < len(r.Properties) {
+			overview = manifest.Overview{Common: r.Properties[stream].Common, Essence: slices.Clone(r.Properties[stream].Essence)}
+		}
+
+		demuxed.Round.Config.StreamProperties[i] = properties
+		demuxed.Streams = append(demuxed.Streams, &demuxStream)
+		demuxed.Properties = append(demuxed.Properties, overview)
+		chosen[i] = fmt.Sprint(stream)
+	}
+
+	// the start timecode is at the frame rate of the new first clocked stream
+	if _, baseRate, err := demuxed.baseStream(); err == nil {
+		start, err := r.startFrame(baseRate)
+		if err != nil {
+			return nil, err
+		}
+
+		if start > 0 {
+			fps, _ := manifest.NominalFPS(baseRate)
+			demuxed.Round.Config.StartTimecode = manifest.FormatTimecode(start, fps)
+		}
+	}
+
+	demuxed.Edit = fmt.Sprintf("demux of streams %v", strings.Join(chosen, ", "))
+
+	return demuxed, nil
+}
+
+// startFrame returns the start timecode of the mrx file,
+// as the number of frames at the base frame rate.
+func (r *Rewrapper) startFrame(baseRate string) (int, error) {
+
+	_, frameRate, err := r.baseStream()
+	if err != nil || r.Round.Config.StartTimecode == "" {
+		return 0, nil
+	}
+
+	fps, err := manifest.NominalFPS(frameRate)
+	if err != nil {
+		return 0, err
+	}
+
+	start, err := r.Round.Config.StartFrame(fps)
+	if err != nil {
+		return 0, err
+	}
+
+	// convert between the frame rates, which are multiples of each other
+	if multiplier := multipleOf(baseRate, frameRate); multiplier > 0 {
+		return start * multiplier, nil
+	}
+
+	multiplier := multipleOf(frameRate, baseRate)
+	if multiplier == 0 || start%multiplier != 0 {
+		return 0, fmt.Errorf("error the start timecode %v is not on a frame of the frame rate %v", r.Round.Config.StartTimecode, baseRate)
+	}
+
+	return start / multiplier, nil
+}
+
+// multipleOf returns how many times the frame rate is the base frame
+// rate, it is 0 if the frame rate is not a whole multiple of it.
+func multipleOf(frameRate, baseRate string) int {
+
+	var num, den, baseNum, baseDen int
+	if _, err := fmt.Sscanf(frameRate, "%v/%v", &num, &den); err != nil || num <= 0 || den <= 0 {
+		return 0
+	}
+
+	if _, err := fmt.Sscanf(baseRate, "%v/%v", &baseNum, &baseDen); err != nil || baseNum <= 0 || baseDen <= 0 {
+		return 0
+	}
+
+	if (num*baseDen)%(baseNum*den) != 0 {
+		return 0
+	}
+
+	return (num * baseDen) / (baseNum * den)
+}
@@ -0,0 +1,112 @@
+package rewrap
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/metarex-media/mrx-tool/decode"
+	"github.com/metarex-media/mrx-tool/encode"
+	"github.com/metarex-media/mrx-tool/manifest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMux(t *testing.T) {
+
+	mrxBytes, _ := os.ReadFile("../decode/testdata/namespaces.mrx")
+	original, _ := decode.ExtractStreamData(bytes.NewReader(mrxBytes))
+	originalRound := roundTrip(mrxBytes)
+
+	// split the file into its streams
+	source, _ := NewRewrapper(bytes.NewReader(mrxBytes))
+	clip, clipErr := source.Demux([]int{1})
+	var clipFile bytes.Buffer
+	clipEncodeErr := clip.Encode(&clipFile, &encode.MrxEncodeOptions{ManifestHistoryCount: -1})
+	clipStreams, _ := decode.ExtractStreamData(bytes.NewReader(clipFile.Bytes()))
+	clipRound := roundTrip(clipFile.Bytes())
+
+	// a file that starts a frame after the original
+	trimmed, _ := NewRewrapper(bytes.NewReader(mrxBytes))
+	trimmed.Trim("1", "")
+	var trimmedFile bytes.Buffer
+	trimmed.Encode(&trimmedFile, &encode.MrxEncodeOptions{ManifestHistoryCount: -1})
+	trimmedSource, _ := NewRewrapper(bytes.NewReader(trimmedFile.Bytes()))
+	clipSource, _ := NewRewrapper(bytes.NewReader(clipFile.Bytes()))
+
+	muxed, muxErr := Mux([]*Rewrapper{clipSource, trimmedSource, source}, AlignTimecode)
+	var muxFile bytes.Buffer
+	muxEncodeErr := muxed.Encode(&muxFile, &encode.MrxEncodeOptions{ManifestHistoryCount: -1})
+	muxStreams, _ := decode.ExtractStreamData(bytes.NewReader(muxFile.Bytes()))
+	muxRound := roundTrip(muxFile.Bytes())
+
+	frameMuxed, _ := Mux([]*Rewrapper{trimmedSource, source}, AlignFrame)
+	// files without clocked streams do not have a start timecode
+	lateMuxed, _ := Mux([]*Rewrapper{clipSource, trimmedSource}, AlignTimecode)
+
+	// a source at 25 fps can not be muxed with a 24 fps source
+	fast, _ := NewRewrapper(bytes.NewReader(mrxBytes))
+	fast.Round.Config.StreamProperties[0] = manifest.StreamProperties{FrameRate: "25/1"}
+	_, rateErr := Mux([]*Rewrapper{source, fast}, AlignFrame)
+	_, demuxErr := source.Demux([]int{2})
+	_, twiceErr := source.Demux([]int{0, 0})
+	_, alignErr := ParseAlignment("shot")
+
+	Convey("Checking the streams of mrx files are demuxed and muxed", t, func() {
+		Convey("using a demux of the clip wrapped stream", func() {
+			Convey("only that stream is encoded, with its configuration and the demux in the history", func() {
+				So(clipErr, ShouldBeNil)
+				So(clipEncodeErr, ShouldBeNil)
+				So(len(clipStreams), ShouldEqual, 2)
+				So(clipStreams[0].Data, ShouldResemble, original[1].Data)
+				So(clipRound.Config.StreamProperties[0].NameSpace, ShouldEqual, originalRound.Config.StreamNameSpace(1))
+				So(clipRound.Manifest.History[0].UMID, ShouldEqual, originalRound.Manifest.UMID)
+				So(clipRound.Manifest.History[0].Edit, ShouldEqual, "demux of streams 1")
+			})
+		})
+		Convey("using a timecode aligned mux of the clip stream file, a file starting at frame 1 and the original file", func() {
+			Convey("the clocked streams are first and are lined up with empty frames, and each manifest is in the history", func() {
+				So(muxErr, ShouldBeNil)
+				So(muxEncodeErr, ShouldBeNil)
+				So(len(muxStreams), ShouldEqual, 6)
+				So(muxStreams[0].Data, ShouldResemble, append([][]byte{{}}, original[0].Data[1:]...))
+				So(muxStreams[1].Data, ShouldResemble, original[0].Data)
+				for _, clip := range muxStreams[2:5] {
+					So(clip.Data, ShouldResemble, original[1].Data)
+				}
+				So(muxRound.Config.StartTimecode, ShouldEqual, "")
+				So(muxRound.Config.StreamProperties[0].NameSpace, ShouldEqual, originalRound.Config.StreamNameSpace(0))
+				So(muxRound.Config.StreamProperties[2].NameSpace, ShouldEqual, originalRound.Config.StreamNameSpace(1))
+
+				history := len(originalRound.Manifest.History)
+				So(muxRound.Manifest.History[0].UMID, ShouldEqual, clipRound.Manifest.UMID)
+				So(muxRound.Manifest.History[0].Edit, ShouldEqual, "mux as streams 2")
+				So(muxRound.Manifest.History[1].Edit, ShouldEqual, "mux as streams 0, 3")
+				So(muxRound.Manifest.History[2].Edit, ShouldEqual, "trim of frames 1 to 3, from 00:00:00:01 to 00:00:00:03")
+				So(muxRound.Manifest.History[3+history].Edit, ShouldEqual, "mux as streams 1, 4")
+				So(muxRound.Manifest.History[4+2*history].Edit, ShouldEqual, "demux of streams 1")
+			})
+		})
+		Convey("using a frame aligned mux", func() {
+			Convey("the first frames are lined up and the start timecode of the first file is kept", func() {
+				So(len(frameMuxed.Streams[0].Data), ShouldEqual, 2)
+				So(len(frameMuxed.Streams[1].Data), ShouldEqual, 3)
+				So(frameMuxed.Round.Config.StartTimecode, ShouldEqual, "00:00:00:01")
+			})
+		})
+		Convey("using a timecode aligned mux of a file without clocked streams and a file starting at frame 1", func() {
+			Convey("the muxed file starts at frame 1, without empty frames", func() {
+				So(len(lateMuxed.Streams[0].Data), ShouldEqual, 2)
+				So(lateMuxed.Round.Config.StartTimecode, ShouldEqual, "00:00:00:01")
+			})
+		})
+		Convey("using streams with different edit rates, streams that are not in the file and unknown alignments", func() {
+			Convey("an error is returned", func() {
+				So(rateErr, ShouldResemble, fmt.Errorf("error stream 0 of mrx file 1 has a frame rate of 25/1, which is not a whole multiple of the base frame rate 24/1"))
+				So(demuxErr, ShouldResemble, fmt.Errorf("error stream 2 is not in the mrx file, which has 2 data streams"))
+				So(twiceErr, ShouldResemble, fmt.Errorf("error stream 0 is chosen more than once"))
+				So(alignErr, ShouldResemble, fmt.Errorf("unknown alignment \"shot\", please use one of frame or timecode"))
+			})
+		})
+	})
+}
@@ -0,0 +1,183 @@
+// Package rewrap re-encodes mrx files, without extracting their essence to files
+package rewrap
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/metarex-media/mrx-tool/decode"
+	"github.com/metarex-media/mrx-tool/encode"
+	"github.com/metarex-media/mrx-tool/manifest"
+)
+
+// Rewrapper is an encode.Encoder of the data streams of an mrx file,
+// so the file can be encoded again with a new configuration.
+// The data streams are held in memory, so no temporary files are used.
+type Rewrapper struct {
+	// Streams are the data streams of the mrx
+	// file, in the order they are encoded
+	Streams []*decode.DataFormat
+	// Properties are the stream and essence properties of each
+	// data stream, from the manifest of the mrx file.
+	Properties []manifest.Overview
+	// Round is the configuration and manifest of the mrx file,
+	// it is empty if the file has no manifest. The manifest is the
+	// previous manifest of the new file, so it is not changed by edits.
+	Round manifest.RoundTrip
+	// Edit is the edit made to the data streams, such as a trim,
+	// which is recorded in the manifest history when it is encoded.
+	Edit string
+}
+
+// the essence keys of the essence types of the data streams
+var essenceKeys = map[string]encode.EssenceKey{
+	"TC": encode.TextFrame,
+	"TE": encode.TextClip,
+	"BC": encode.BinaryFrame,
+	"BE": encode.BinaryClip,
+}
+
+// NewRewrapper decodes the data streams and manifest of an mrx file
+func NewRewrapper(mrx io.Reader) (*Rewrapper, error) {
+
+	streams, err := decode.ExtractStreamData(mrx)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding the mrx file: %v", err)
+	}
+
+	rewrap := &Rewrapper{Streams: make([]*decode.DataFormat, 0, len(streams))}
+	for _, stream := range streams {
+		if stream.EssenceType != "manifest" {
+			rewrap.Streams = append(rewrap.Streams, stream)
+			continue
+		}
+
+		// the last manifest is the manifest of the file
+		if len(stream.Data) > 0 {
+			if err := json.Unmarshal(stream.Data[len(stream.Data)-1], &rewrap.Round); err != nil {
+				return nil, fmt.Errorf("error parsing the manifest of the mrx file: %v", err)
+			}
+		}
+	}
+
+	if len(rewrap.Streams) == 0 {
+		return nil, fmt.Errorf("error no data streams were found in the mrx file")
+	}
+
+	rewrap.Properties = make([]manifest.Overview, len(rewrap.Streams))
+	for i, overview := range rewrap.Round.Manifest.DataStreams {
+		if i < len(rewrap.Properties) {
+			rewrap.Properties[i] = manifest.Overview{Common: overview.Common, Essence: slices.Clone(overview.Essence)}
+		}
+	}
+
+	return rewrap, nil
+}
+
+// Rewrap re-encodes an mrx file to w, the options change the configuration
+// and choose how much of the manifest history is kept.
+func Rewrap(mrx io.Reader, w io.Writer, options *encode.MrxEncodeOptions) error {
+
+	rewrap, err := NewRewrapper(mrx)
+	if err != nil {
+		return err
+	}
+
+	return rewrap.Encode(w, options)
+}
+
+// Encode encodes the data streams as a new mrx file
+func (r *Rewrapper) Encode(w io.Writer, options *encode.MrxEncodeOptions) error {
+
+	encodeOptions := encode.MrxEncodeOptions{}
+	if options != nil {
+		encodeOptions = *options
+	}
+
+	if encodeOptions.Edit == "" {
+		encodeOptions.Edit = r.Edit
+	}
+
+	mw := encode.NewMRXWriter()
+	mw.UpdateEncoder(r)
+
+	return mw.Encode(w, &encodeOptions)
+}
+
+// GetStreamInformation returns the essence keys of the data streams
+func (r *Rewrapper) GetStreamInformation() (encode.StreamInformation, error) {
+
+	keys := make([]encode.EssenceKey, len(r.Streams))
+	for i, stream := range r.Streams {
+		key, ok := essenceKeys[stream.EssenceType]
+		if !ok {
+			return encode.StreamInformation{}, fmt.Errorf("error stream %v has an unknown essence type of %v", i, stream.EssenceType)
+		}
+
+		keys[i] = key
+	}
+
+	return encode.StreamInformation{EssenceKeys: keys}, nil
+}
+
+// GetRoundTrip returns a copy of the configuration and manifest of the
+// mrx file, the manifest becomes the previous manifest of the new file.
+func (r *Rewrapper) GetRoundTrip() (*manifest.RoundTrip, error) {
+
+	// the encoder changes the roundtrip, so the
+	// rewrapper can be encoded more than once
+	roundBytes, err := json.Marshal(r.Round)
+	if err != nil {
+		return nil, err
+	}
+
+	var round manifest.RoundTrip
+	err = json.Unmarshal(roundBytes, &round)
+
+	return &round, err
+}
+
+// EssenceChannels sends each data stream to the encoder,
+// with the stream and essence properties of the data stream.
+func (r *Rewrapper) EssenceChannels(essChan chan *encode.ChannelPackets) error {
+
+	// close the channels once they've been written to
+	defer close(essChan)
+
+	for i, stream := range r.Streams {
+
+		var overview manifest.Overview
+		if i < len(r.Properties) {
+			overview = r.Properties[i]
+		}
+
+		dataTrain := make(chan *encode.DataCarriage, len(stream.Data))
+		for frame, data := range stream.Data {
+			dataTrain <- carriage(data, overview.Essence, frame)
+		}
+		close(dataTrain)
+
+		essChan <- &encode.ChannelPackets{Packets: dataTrain, OverViewData: overview.Common}
+	}
+
+	return nil
+}
+
+// carriage returns the data of a frame, with the essence
+// properties of the frame if they are in the manifest.
+func carriage(data []byte, properties []manifest.EssenceProperties, frame int) *encode.DataCarriage {
+
+	var metadata manifest.EssenceProperties
+	if frame < len(properties) {
+		metadata = properties[frame]
+	}
+
+	has := sha256.New()
+	has.Write(data)
+	metadata.Hash = fmt.Sprintf("%64x", has.Sum(nil))
+
+	return &encode.DataCarriage{Data: &data, MetaData: &metadata}
+}
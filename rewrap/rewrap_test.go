@@ -0,0 +1,86 @@
+package rewrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/metarex-media/mrx-tool/decode"
+	"github.com/metarex-media/mrx-tool/encode"
+	"github.com/metarex-media/mrx-tool/manifest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRewrap(t *testing.T) {
+
+	mrxBytes, _ := os.ReadFile("../decode/testdata/namespaces.mrx")
+	original, _ := decode.ExtractStreamData(bytes.NewReader(mrxBytes))
+	originalRound := roundTrip(mrxBytes)
+
+	// change the namespace of the first stream, keeping the manifest history
+	update := manifest.Configuration{StreamProperties: map[int]manifest.StreamProperties{0: {NameSpace: "https://example.com/ns"}}}
+	var rewrapped bytes.Buffer
+	rewrapErr := Rewrap(bytes.NewReader(mrxBytes), &rewrapped, &encode.MrxEncodeOptions{ConfigOverWrite: update,
+		ManifestHistoryCount: -1, Derivation: encode.DeriveRewrap})
+	streams, streamErr := decode.ExtractStreamData(bytes.NewReader(rewrapped.Bytes()))
+	round := roundTrip(rewrapped.Bytes())
+
+	// the rewrapper can be encoded more than once
+	rewrapper, rewrapperErr := NewRewrapper(bytes.NewReader(mrxBytes))
+	var first, second bytes.Buffer
+	firstErr := rewrapper.Encode(&first, &encode.MrxEncodeOptions{ConfigOverWrite: update})
+	secondErr := rewrapper.Encode(&second, nil)
+	secondStreams, _ := decode.ExtractStreamData(bytes.NewReader(second.Bytes()))
+
+	notMRX, _ := os.Open("../decode/testdata/notanmrx.yaml")
+	defer notMRX.Close()
+	notMRXErr := Rewrap(notMRX, &bytes.Buffer{}, nil)
+
+	Convey("Checking mrx files are rewrapped with configuration changes", t, func() {
+		Convey("using a new namespace for the first stream of an mrx file with a manifest", func() {
+			Convey("the essence is unchanged, with the new namespace and the previous manifest in the history", func() {
+				So(rewrapErr, ShouldBeNil)
+				So(streamErr, ShouldBeNil)
+				So(len(streams), ShouldEqual, len(original))
+				for i := range original[:len(original)-1] {
+					So(streams[i].EssenceType, ShouldEqual, original[i].EssenceType)
+					So(streams[i].Data, ShouldResemble, original[i].Data)
+				}
+				So(streams[0].NameSpace, ShouldEqual, "https://example.com/ns")
+				So(streams[1].NameSpace, ShouldEqual, original[1].NameSpace)
+
+				So(len(round.Manifest.History), ShouldEqual, len(originalRound.Manifest.History)+1)
+				So(round.Manifest.History[0].UMID, ShouldEqual, originalRound.Manifest.UMID)
+				// only the instance number of the UMID changes
+				So(round.Manifest.UMID, ShouldNotEqual, originalRound.Manifest.UMID)
+				So(round.Manifest.UMID[32:], ShouldEqual, originalRound.Manifest.UMID[32:])
+				So(round.Manifest.DataStreams[0].Common, ShouldResemble, originalRound.Manifest.DataStreams[0].Common)
+				So(round.Manifest.DataStreams[0].Essence, ShouldResemble, originalRound.Manifest.DataStreams[0].Essence)
+			})
+		})
+		Convey("using the same rewrapper to encode more than one file", func() {
+			Convey("the configuration changes of one file are not in the next", func() {
+				So(rewrapperErr, ShouldBeNil)
+				So(firstErr, ShouldBeNil)
+				So(secondErr, ShouldBeNil)
+				So(secondStreams[0].NameSpace, ShouldEqual, original[0].NameSpace)
+			})
+		})
+		Convey("using a file that is not an mrx file", func() {
+			Convey("an error is returned", func() {
+				So(notMRXErr, ShouldResemble, fmt.Errorf("error decoding the mrx file: Buffer stream unexpectedly closed, was expecting at least 18 more bytes"))
+			})
+		})
+	})
+}
+
+// roundTrip returns the manifest of an mrx file
+func roundTrip(mrx []byte) manifest.RoundTrip {
+	var round manifest.RoundTrip
+	roundBytes, _ := decode.ExtractManifest(bytes.NewReader(mrx))
+	json.Unmarshal(roundBytes, &round)
+
+	return round
+}
@@ -0,0 +1,87 @@
+package rewrap
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Playlist lists the segments of a segmented mrx file
+type Playlist struct {
+	// SourceUMID is the UMID of the mrx file that was segmented
+	SourceUMID string `json:"SourceUMID,omitempty"`
+	// FrameRate is the frame rate of the first clocked stream,
+	// which the frames and timecodes of the segments are at.
+	FrameRate string
+	// SegmentFrames is the number of frames in each
+	// segment, the last segment may have less.
+	SegmentFrames int
+	Segments      []Segment
+}
+
+// Segment is a self contained part of a segmented mrx file
+type Segment struct {
+	// File is the name of the mrx file of the segment
+	File string `json:"File,omitempty"`
+	// StartTimecode is the HH:MM:SS:FF timecode of the first frame
+	StartTimecode string
+	// FirstFrame is the first frame of the segment, and EndFrame is the frame after the
+	// last frame of the segment. They are from the start of the segmented file.
+	FirstFrame int
+	EndFrame   int
+	// Rewrapper has the data streams of the segment
+	Rewrapper *Rewrapper `json:"-"`
+}
+
+// Segment splits the data streams into segments of seconds long, each segment
+// is a trim of the clocked streams with every clip wrapped stream, so it can be
+// encoded as its own mrx file. The timecode continues from segment to segment.
+// The segments share the data streams of r, which are all held in memory.
+func (r *Rewrapper) Segment(seconds float64) (*Playlist, error) {
+
+	base, frameRate, err := r.baseStream()
+	if err != nil {
+		return nil, err
+	}
+
+	var num, den int
+	if _, err := fmt.Sscanf(frameRate, "%v/%v", &num, &den); err != nil || num <= 0 || den <= 0 {
+		return nil, fmt.Errorf("error parsing the frame rate %v", frameRate)
+	}
+
+	size := int(math.Round(seconds * float64(num) / float64(den)))
+	if size < 1 {
+		return nil, fmt.Errorf("error the segment duration of %v seconds is less than a frame at %v fps", seconds, frameRate)
+	}
+
+	playlist := &Playlist{SourceUMID: r.Round.Manifest.UMID, FrameRate: frameRate, SegmentFrames: size}
+	length := len(r.Streams[base].Data)
+	count := (length + size - 1) / size
+
+	for first := 0; first < length; first += size {
+		segment := r.clone()
+		err := segment.Trim(fmt.Sprint(first), fmt.Sprint(first+size))
+		if err != nil {
+			return nil, fmt.Errorf("error making the segment of frames %v to %v: %v", first, first+size, err)
+		}
+
+		segment.Edit = fmt.Sprintf("segment %v of %v, %v", len(playlist.Segments)+1, count, segment.Edit)
+		playlist.Segments = append(playlist.Segments, Segment{StartTimecode: segment.Round.Config.StartTimecode,
+			FirstFrame: first, EndFrame: min(first+size, length), Rewrapper: segment})
+	}
+
+	return playlist, nil
+}
+
+// clone returns a copy of the rewrapper, that can be
+// edited without changing the data streams of r.
+func (r *Rewrapper) clone() *Rewrapper {
+
+	clone := &Rewrapper{Round: r.Round, Edit: r.Edit, Properties: slices.Clone(r.Properties)}
+	for _, stream := range r.Streams {
+		cloneStream := *stream
+		clone.Streams = append(clone.Streams, &cloneStream)
+	}
+
+	return clone
+}
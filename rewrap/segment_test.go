@@ -0,0 +1,65 @@
+package rewrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/metarex-media/mrx-tool/decode"
+	"github.com/metarex-media/mrx-tool/encode"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSegment(t *testing.T) {
+
+	mrxBytes, _ := os.ReadFile("../decode/testdata/namespaces.mrx")
+	original, _ := decode.ExtractStreamData(bytes.NewReader(mrxBytes))
+	originalRound := roundTrip(mrxBytes)
+
+	// segments of 2 frames at 24 fps
+	source, _ := NewRewrapper(bytes.NewReader(mrxBytes))
+	playlist, segmentErr := source.Segment(2.0 / 24)
+	playlistBytes, _ := json.Marshal(playlist)
+
+	var last bytes.Buffer
+	encodeErr := playlist.Segments[1].Rewrapper.Encode(&last, &encode.MrxEncodeOptions{ManifestHistoryCount: -1})
+	lastStreams, _ := decode.ExtractStreamData(bytes.NewReader(last.Bytes()))
+	lastRound := roundTrip(last.Bytes())
+
+	_, shortErr := source.Segment(0.01)
+	clipOnly, _ := source.Demux([]int{1})
+	_, clipErr := clipOnly.Segment(1)
+
+	Convey("Checking mrx files are split into segments", t, func() {
+		Convey("using segments of 2 frames for a 3 frame file", func() {
+			Convey("there are 2 segments with continuing timecodes, which keep the clip wrapped stream", func() {
+				So(segmentErr, ShouldBeNil)
+				So(playlist.SourceUMID, ShouldEqual, originalRound.Manifest.UMID)
+				So(playlist.SegmentFrames, ShouldEqual, 2)
+				So(len(playlist.Segments), ShouldEqual, 2)
+				So(playlist.Segments[0].StartTimecode, ShouldEqual, "00:00:00:00")
+				So([]int{playlist.Segments[0].FirstFrame, playlist.Segments[0].EndFrame}, ShouldResemble, []int{0, 2})
+				So(playlist.Segments[1].StartTimecode, ShouldEqual, "00:00:00:02")
+				So([]int{playlist.Segments[1].FirstFrame, playlist.Segments[1].EndFrame}, ShouldResemble, []int{2, 3})
+				So(string(playlistBytes), ShouldNotContainSubstring, "Rewrapper")
+				// the segmented file is not changed
+				So(len(source.Streams[0].Data), ShouldEqual, 3)
+			})
+			Convey("each segment is encoded as its own mrx file, with the segment in the history", func() {
+				So(encodeErr, ShouldBeNil)
+				So(lastStreams[0].Data, ShouldResemble, original[0].Data[2:])
+				So(lastStreams[1].Data, ShouldResemble, original[1].Data)
+				So(lastRound.Config.StartTimecode, ShouldEqual, "00:00:00:02")
+				So(lastRound.Manifest.History[0].Edit, ShouldEqual, "segment 2 of 2, trim of frames 2 to 3, from 00:00:00:02 to 00:00:00:03")
+			})
+		})
+		Convey("using segments shorter than a frame and a file without clocked streams", func() {
+			Convey("an error is returned", func() {
+				So(shortErr, ShouldResemble, fmt.Errorf("error the segment duration of 0.01 seconds is less than a frame at 24/1 fps"))
+				So(clipErr, ShouldResemble, fmt.Errorf("error there are no clocked data streams"))
+			})
+		})
+	})
+}
@@ -0,0 +1,153 @@
+package rewrap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/metarex-media/mrx-tool/manifest"
+)
+
+// Trim cuts the clocked data streams down to the frames from in, up to but
+// not including out, which is how edit decision lists give their cut points.
+// in and out are frame numbers from the start of the file, or HH:MM:SS:FF
+// timecodes from the start timecode of the file, at the frame rate of the first
+// clocked stream. An empty in is the start of the file and an empty out is the end.
+// The clip wrapped streams are kept as they are, the start timecode
+// is moved to the in point and the trim is recorded as the Edit.
+func (r *Rewrapper) Trim(in, out string) error {
+
+	base, frameRate, err := r.baseStream()
+	if err != nil {
+		return err
+	}
+
+	fps, err := manifest.NominalFPS(frameRate)
+	if err != nil {
+		return err
+	}
+
+	start, err := r.Round.Config.StartFrame(fps)
+	if err != nil {
+		return err
+	}
+
+	// the length of the file is the length of the first clocked stream
+	length := len(r.Streams[base].Data)
+
+	first, err := trimPoint(in, fps, start, 0)
+	if err != nil {
+		return err
+	}
+
+	last, err := trimPoint(out, fps, start, length)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case first >= length:
+		return fmt.Errorf("error the in point %v is after the end of the file, which has %v frames", in, length)
+	case last <= first:
+		return fmt.Errorf("error the trim from %v to %v has no frames", in, out)
+	case last > length:
+		last = length
+	}
+
+	for i, stream := range r.Streams {
+		if !clocked(stream.EssenceType) {
+			continue
+		}
+
+		// streams at a multiple of the base frame rate
+		// have more than one frame per edit unit
+		multiplier, err := r.frameMultiplier(i, frameRate)
+		if err != nil {
+			return err
+		}
+
+		stream.Data = cut(stream.Data, first*multiplier, last*multiplier)
+		if i < len(r.Properties) {
+			r.Properties[i].Essence = cut(r.Properties[i].Essence, first*multiplier, last*multiplier)
+		}
+	}
+
+	r.Round.Config.StartTimecode = manifest.FormatTimecode(start+first, fps)
+	r.Edit = fmt.Sprintf("trim of frames %v to %v, from %v to %v", first, last,
+		manifest.FormatTimecode(start+first, fps), manifest.FormatTimecode(start+last, fps))
+
+	return nil
+}
+
+// baseStream returns the first clocked stream and its frame rate,
+// which the frame rates of the other streams are multiples of.
+func (r *Rewrapper) baseStream() (int, string, error) {
+
+	for i, stream := range r.Streams {
+		if clocked(stream.EssenceType) {
+			return i, r.Round.Config.StreamFrameRate(i), nil
+		}
+	}
+
+	return 0, "", fmt.Errorf("error there are no clocked data streams")
+}
+
+// frameMultiplier returns the number of frames of
+// a stream in each frame of the base frame rate
+func (r *Rewrapper) frameMultiplier(stream int, baseRate string) (int, error) {
+
+	var baseNum, baseDen, num, den int
+	if _, err := fmt.Sscanf(baseRate, "%v/%v", &baseNum, &baseDen); err != nil || baseNum <= 0 {
+		return 0, fmt.Errorf("error parsing the frame rate %v", baseRate)
+	}
+
+	frameRate := r.Round.Config.StreamFrameRate(stream)
+	if _, err := fmt.Sscanf(frameRate, "%v/%v", &num, &den); err != nil || num <= 0 {
+		return 0, fmt.Errorf("error parsing the frame rate %v of stream %v", frameRate, stream)
+	}
+
+	return max(num/baseNum, 1), nil
+}
+
+// trimPoint converts a frame number or timecode to a frame
+// number from the start of the file. empty is used for an empty point.
+func trimPoint(point string, fps, start, empty int) (int, error) {
+
+	point = strings.TrimSpace(point)
+	if point == "" {
+		return empty, nil
+	}
+
+	if !strings.Contains(point, ":") {
+		frame, err := strconv.Atoi(point)
+		if err != nil || frame < 0 {
+			return 0, fmt.Errorf("error parsing the trim point %v, expected a frame number or HH:MM:SS:FF timecode", point)
+		}
+
+		return frame, nil
+	}
+
+	frame, err := manifest.ParseTimecode(point, fps)
+	if err != nil {
+		return 0, err
+	}
+
+	if frame < start {
+		return 0, fmt.Errorf("error the timecode %v is before the start timecode %v of the file", point, manifest.FormatTimecode(start, fps))
+	}
+
+	return frame - start, nil
+}
+
+// clocked checks if the essence type is frame wrapped
+func clocked(essenceType string) bool {
+	return essenceType == "TC" || essenceType == "BC"
+}
+
+// cut returns the items from first up to last,
+// which are limited to the length of the items.
+func cut[T any](items []T, first, last int) []T {
+	first, last = min(first, len(items)), min(last, len(items))
+
+	return items[first:last]
+}
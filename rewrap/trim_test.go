@@ -0,0 +1,75 @@
+package rewrap
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/metarex-media/mrx-tool/decode"
+	"github.com/metarex-media/mrx-tool/encode"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTrim(t *testing.T) {
+
+	mrxBytes, _ := os.ReadFile("../decode/testdata/namespaces.mrx")
+	original, _ := decode.ExtractStreamData(bytes.NewReader(mrxBytes))
+	originalRound := roundTrip(mrxBytes)
+
+	// keep the last two frames of the 3 frame file
+	trimmer, _ := NewRewrapper(bytes.NewReader(mrxBytes))
+	trimErr := trimmer.Trim("1", "")
+	var trimmed bytes.Buffer
+	encodeErr := trimmer.Encode(&trimmed, &encode.MrxEncodeOptions{ManifestHistoryCount: -1, Derivation: encode.DeriveNewContent})
+	streams, _ := decode.ExtractStreamData(bytes.NewReader(trimmed.Bytes()))
+	round := roundTrip(trimmed.Bytes())
+
+	// timecodes are from the start timecode of the trimmed file
+	retrimmer, _ := NewRewrapper(bytes.NewReader(trimmed.Bytes()))
+	retrimErr := retrimmer.Trim("00:00:00:02", "00:00:00:03")
+	var retrimmed bytes.Buffer
+	retrimmer.Encode(&retrimmed, &encode.MrxEncodeOptions{ManifestHistoryCount: -1})
+	retrimStreams, _ := decode.ExtractStreamData(bytes.NewReader(retrimmed.Bytes()))
+	retrimRound := roundTrip(retrimmed.Bytes())
+
+	badTrimmer, _ := NewRewrapper(bytes.NewReader(trimmed.Bytes()))
+	beforeStartErr := badTrimmer.Trim("00:00:00:00", "")
+	afterEndErr := badTrimmer.Trim("5", "")
+	emptyErr := badTrimmer.Trim("1", "1")
+	badPointErr := badTrimmer.Trim("one", "")
+
+	Convey("Checking mrx files are trimmed to a range of frames", t, func() {
+		Convey("using an in point of frame 1 and no out point", func() {
+			Convey("the clocked stream loses the first frame, the clip stream is kept and the trim is in the history", func() {
+				So(trimErr, ShouldBeNil)
+				So(encodeErr, ShouldBeNil)
+				So(streams[0].Data, ShouldResemble, original[0].Data[1:])
+				So(streams[1].Data, ShouldResemble, original[1].Data)
+				So(round.Manifest.DataStreams[0].Essence, ShouldResemble, originalRound.Manifest.DataStreams[0].Essence[1:])
+				So(round.Config.StartTimecode, ShouldEqual, "00:00:00:01")
+				So(round.Manifest.History[0].UMID, ShouldEqual, originalRound.Manifest.UMID)
+				So(round.Manifest.History[0].Edit, ShouldEqual, "trim of frames 1 to 3, from 00:00:00:01 to 00:00:00:03")
+				// the source manifest is kept as it was
+				So(round.Manifest.History[0].Manifest.DataStreams, ShouldResemble, originalRound.Manifest.DataStreams)
+			})
+		})
+		Convey("using timecodes to trim a file with a start timecode", func() {
+			Convey("the timecodes are found from the start timecode", func() {
+				So(retrimErr, ShouldBeNil)
+				So(retrimStreams[0].Data, ShouldResemble, original[0].Data[2:])
+				So(retrimRound.Config.StartTimecode, ShouldEqual, "00:00:00:02")
+				So(len(retrimRound.Manifest.History), ShouldEqual, 2)
+				So(retrimRound.Manifest.History[0].Edit, ShouldEqual, "trim of frames 1 to 2, from 00:00:00:02 to 00:00:00:03")
+			})
+		})
+		Convey("using trim points outside of the file or that are not frames", func() {
+			Convey("an error is returned", func() {
+				So(beforeStartErr, ShouldResemble, fmt.Errorf("error the timecode 00:00:00:00 is before the start timecode 00:00:00:01 of the file"))
+				So(afterEndErr, ShouldResemble, fmt.Errorf("error the in point 5 is after the end of the file, which has 2 frames"))
+				So(emptyErr, ShouldResemble, fmt.Errorf("error the trim from 1 to 1 has no frames"))
+				So(badPointErr, ShouldResemble, fmt.Errorf("error parsing the trim point one, expected a frame number or HH:MM:SS:FF timecode"))
+			})
+		})
+	})
+}